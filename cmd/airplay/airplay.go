@@ -23,8 +23,8 @@ var (
 	ctx       context.Context
 	cancelCtx context.CancelFunc
 
-	cfg            = &config.Config{}
-	youtubeFetcher *sources.YoutubeFetcher
+	cfg          = &config.Config{}
+	songProvider *sources.Registry
 
 	storage *discord.InMemoryInteractionStorage
 )
@@ -38,6 +38,13 @@ func main() {
 	loggerCfg.EncoderConfig.EncodeTime = zapcore.RFC3339TimeEncoder
 	logger, _ = loggerCfg.Build()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate-store" {
+		if err := migrateStore(os.Args[2:]); err != nil {
+			logger.Fatal("failed to migrate store", zap.Error(err))
+		}
+		return
+	}
+
 	ctx, cancelCtx = context.WithCancel(context.Background())
 	defer cancelCtx()
 
@@ -49,24 +56,39 @@ func main() {
 
 	storage = discord.NewInMemoryStorage()
 
-	youtubeFetcherOpts := []sources.Option{}
-	if cfg.YtDlp.Proxy != "" {
-		youtubeFetcherOpts = append(youtubeFetcherOpts, sources.WithProxy(cfg.YtDlp.Proxy))
+	var err error
+	songProvider, err = sources.NewRegistryFromConfig(ctx, cfg)
+	if err != nil {
+		logger.Fatal("failed to create song sources", zap.Error(err))
 	}
-	youtubeFetcher = sources.NewYoutubeFetcher(youtubeFetcherOpts...)
+	if ytDlp := songProvider.Diagnostics().YtDlp; ytDlp != nil {
+		logger.Info("detected yt-dlp", zap.String("binary", ytDlp.Binary), zap.String("version", ytDlp.Version))
+	}
+	logPipelinesOnSignal()
 
 	playlistGenerator := sources.NewChatGPTPlaylistGenerator(cfg.OpenAIToken)
 
-	handler := discord.NewInteractionHandler(ctx, cfg.DiscordToken, youtubeFetcher, playlistGenerator, storage, cfg).WithLogger(logger.Named("interactionHandler"))
+	handler := discord.NewInteractionHandler(ctx, cfg.DiscordToken, songProvider, playlistGenerator, storage, cfg).WithLogger(logger.Named("interactionHandler"))
 	commandHandler := discord.NewSlashCommandRouter(cfg.CommandPrefix).
 		PlayHandler(handler.PlaySong).
+		PlayAutocompleteHandler(handler.PlayAutocomplete).
 		SkipHandler(handler.SkipSong).
 		StopHandler(handler.StopPlaying).
 		ListHandler(handler.ListPlaylist).
 		RemoveHandler(handler.RemoveSong).
+		MoveHandler(handler.MoveSong).
+		ShuffleHandler(handler.ShufflePlaylist).
 		PlayingNowHandler(handler.GetPlayingSong).
 		DJHandler(handler.CreatePlaylist).
-		AddSongOrPlaylistHandler(handler.AddSongOrPlaylist)
+		ExportHandler(handler.ExportPlaylist).
+		ImportHandler(handler.ImportPlaylist).
+		SettingsHandler(handler.Settings).
+		SearchHandler(handler.SearchSongs).
+		FailedHandler(handler.ListFailedSongs).
+		DiagnosticsHandler(handler.Diagnostics).
+		ChapterHandler(handler.SeekChapter).
+		AddSongOrPlaylistHandler(handler.AddSongOrPlaylist).
+		SearchResultHandler(handler.AddSearchResults)
 
 	dg, err := discordgo.New("Bot " + cfg.DiscordToken)
 	if err != nil {
@@ -80,7 +102,12 @@ func main() {
 	dg.AddHandler(func(s *discordgo.Session, i *discordgo.InteractionCreate) {
 		switch i.Type {
 		case discordgo.InteractionMessageComponent:
-			if h, ok := commandHandler.GetComponentHandlers()[i.MessageComponentData().CustomID]; ok {
+			if h, ok := commandHandler.GetComponentHandlers()[discord.ComponentName(i.MessageComponentData().CustomID)]; ok {
+				h(s, i)
+			}
+
+		case discordgo.InteractionApplicationCommandAutocomplete:
+			if h, ok := commandHandler.GetAutocompleteHandlers()[i.ApplicationCommandData().Name]; ok {
 				h(s, i)
 			}
 
@@ -0,0 +1,24 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+)
+
+// logPipelinesOnSignal logs the running audio pipelines, when the process
+// receives SIGUSR1.
+func logPipelinesOnSignal() {
+	sc := make(chan os.Signal, 1)
+	signal.Notify(sc, syscall.SIGUSR1)
+
+	go func() {
+		for range sc {
+			logger.Info("running audio pipelines", zap.Any("pipelines", songProvider.Pipelines()))
+		}
+	}()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot/store"
+	"go.uber.org/zap"
+)
+
+// migrateStore copies the player state of every guild from one store backend
+// to another, e.g. `airplay migrate-store --from file:./playlist --to file:./new`.
+func migrateStore(args []string) error {
+	flags := flag.NewFlagSet("migrate-store", flag.ContinueOnError)
+	from := flags.String("from", "", "source store, e.g. file:./playlist")
+	to := flags.String("to", "", "destination store, e.g. file:./playlist-new")
+	dryRun := flags.Bool("dry-run", false, "only print what would be migrated")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: airplay migrate-store --from <store> --to <store> [--dry-run]\n\n")
+		fmt.Fprintf(flags.Output(), "supported stores: %s (sqlite is not supported)\n\n", strings.Join(store.SupportedBackends, ", "))
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if *from == "" || *to == "" {
+		return fmt.Errorf("both --from and --to are required, supported stores are %s", strings.Join(store.SupportedBackends, " and "))
+	}
+
+	src, err := store.ParseBackend(*from)
+	if err != nil {
+		return fmt.Errorf("while parsing source store: %w", err)
+	}
+
+	dst, err := store.ParseBackend(*to)
+	if err != nil {
+		return fmt.Errorf("while parsing destination store: %w", err)
+	}
+
+	// restoring into the source would overwrite the state while reading it
+	same, err := store.SameBackend(src, dst)
+	if err != nil {
+		return fmt.Errorf("while comparing stores: %w", err)
+	}
+	if same {
+		return fmt.Errorf("source and destination are the same")
+	}
+
+	guilds, err := src.ListGuilds()
+	if err != nil {
+		return fmt.Errorf("while listing guilds: %w", err)
+	}
+
+	logger.Info("migrating store", zap.String("from", *from), zap.String("to", *to), zap.Int("guilds", len(guilds)), zap.Bool("dryRun", *dryRun))
+
+	for _, guildID := range guilds {
+		guildLogger := logger.With(zap.String("guildID", guildID))
+
+		srcState, err := src.GuildPlayerState(guildID)
+		if err != nil {
+			return fmt.Errorf("while opening source state of guild %s: %w", guildID, err)
+		}
+
+		snapshot, err := store.TakeSnapshot(srcState)
+		if err != nil {
+			return fmt.Errorf("while reading source state of guild %s: %w", guildID, err)
+		}
+
+		guildLogger.Info("migrating guild", zap.Int("songs", len(snapshot.Songs)), zap.Bool("currentSong", snapshot.CurrentSong != nil))
+
+		if *dryRun {
+			printSnapshot(guildID, snapshot)
+			continue
+		}
+
+		dstState, err := dst.GuildPlayerState(guildID)
+		if err != nil {
+			return fmt.Errorf("while opening destination state of guild %s: %w", guildID, err)
+		}
+
+		if err := store.RestoreSnapshot(dstState, snapshot); err != nil {
+			return fmt.Errorf("while writing destination state of guild %s: %w", guildID, err)
+		}
+
+		migrated, err := store.TakeSnapshot(dstState)
+		if err != nil {
+			return fmt.Errorf("while verifying destination state of guild %s: %w", guildID, err)
+		}
+
+		if !snapshot.Equal(migrated) {
+			return fmt.Errorf("verification failed for guild %s: destination state differs from source", guildID)
+		}
+	}
+
+	logger.Info("store migration finished")
+	return nil
+}
+
+// printSnapshot prints the state of the guild, which would be migrated.
+func printSnapshot(guildID string, snapshot *store.GuildSnapshot) {
+	fmt.Printf("guild %s\n", guildID)
+	fmt.Printf("  voice channel: %s\n", snapshot.VoiceChannel)
+	fmt.Printf("  text channel: %s\n", snapshot.TextChannel)
+
+	if snapshot.CurrentSong != nil {
+		fmt.Printf("  current song: %s (%s) at %s\n", snapshot.CurrentSong.GetHumanName(), snapshot.CurrentSong.URL, snapshot.CurrentSong.Position)
+	} else {
+		fmt.Printf("  current song: none\n")
+	}
+
+	fmt.Printf("  queue: %d songs\n", len(snapshot.Songs))
+	for i, song := range snapshot.Songs {
+		fmt.Printf("    %d. %s (%s)\n", i+1, song.GetHumanName(), song.URL)
+	}
+}
@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Playback errors, which the audio sources classify their failures as.
+var (
+	ErrGeoBlocked      = errors.New("not available in this country")
+	ErrAgeRestricted   = errors.New("age-restricted")
+	ErrRemoved         = errors.New("removed or private")
+	ErrLoginRequired   = errors.New("login required")
+	ErrNetwork         = errors.New("network error")
+	ErrIncompleteAudio = errors.New("audio ended before the song")
+)
+
+// IsPermanentAudioError tells, if playing the song again cannot succeed.
+func IsPermanentAudioError(err error) bool {
+	return errors.Is(err, ErrGeoBlocked) || errors.Is(err, ErrAgeRestricted) || errors.Is(err, ErrRemoved) || errors.Is(err, ErrLoginRequired)
+}
+
+const (
+	frameDuration         = 20 * time.Millisecond
+	audioStreamBufferSize = 500
+)
+
+// AudioStream is the Opus audio of a song, sent by an audio source as 20ms
+// frames. After the frames channel is closed, the stream tells why it ended.
+type AudioStream struct {
+	frames    chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mutex       sync.Mutex
+	err         error
+	diagnostics string
+	duration    time.Duration
+}
+
+func NewAudioStream() *AudioStream {
+	return &AudioStream{
+		frames: make(chan []byte, audioStreamBufferSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// Frames returns the channel with the audio frames, which is closed when the
+// stream ends.
+func (s *AudioStream) Frames() <-chan []byte {
+	return s.frames
+}
+
+// Send sends the frame to the stream. It returns false, if the context is
+// done before the frame is read.
+func (s *AudioStream) Send(ctx context.Context, frame []byte) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case s.frames <- frame:
+	}
+
+	s.mutex.Lock()
+	s.duration += frameDuration
+	s.mutex.Unlock()
+
+	return true
+}
+
+// SetDiagnostics stores details about the stream, like the output of the
+// commands producing it, for logging failures.
+func (s *AudioStream) SetDiagnostics(diagnostics string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.diagnostics = diagnostics
+}
+
+// Close ends the stream. The error is nil, if the whole audio was sent or the
+// stream was cancelled. Only the first call has an effect.
+func (s *AudioStream) Close(err error) {
+	s.closeOnce.Do(func() {
+		s.mutex.Lock()
+		s.err = err
+		s.mutex.Unlock()
+
+		close(s.frames)
+		close(s.done)
+	})
+}
+
+// Done returns a channel, which is closed when the source closed the stream,
+// even if not all frames were read yet.
+func (s *AudioStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the error, which ended the stream.
+func (s *AudioStream) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.err
+}
+
+func (s *AudioStream) Diagnostics() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.diagnostics
+}
+
+// Duration returns the duration of the audio sent so far.
+func (s *AudioStream) Duration() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.duration
+}
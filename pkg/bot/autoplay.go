@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// RelatedSongProvider returns songs related to the song, which autoplay picks
+// from, when the queue ends.
+type RelatedSongProvider func(ctx context.Context, song *Song) ([]*Song, error)
+
+// WithRelatedSongProvider enables the autoplay setting.
+func (p *GuildPlayer) WithRelatedSongProvider(rp RelatedSongProvider) *GuildPlayer {
+	p.relatedSongProvider = rp
+	return p
+}
+
+// queueRelatedSong queues a song related to the last played one, which was
+// not played recently. It returns true, if a song was queued.
+func (p *GuildPlayer) queueRelatedSong(ctx context.Context) bool {
+	if p.relatedSongProvider == nil {
+		return false
+	}
+
+	history := p.GetHistory()
+	if len(history) == 0 {
+		return false
+	}
+
+	songs, err := p.relatedSongProvider(ctx, history[0])
+	if err != nil {
+		p.logger.Info("failed to get related songs", zap.Error(err), zap.String("url", history[0].URL))
+		return false
+	}
+
+	for _, song := range songs {
+		if !song.Playable || playedRecently(history, song) {
+			continue
+		}
+
+		if err := p.state.AppendSong(song); err != nil {
+			p.logger.Error("failed to queue related song", zap.Error(err))
+			return false
+		}
+
+		p.logger.Debug("queued related song", zap.String("url", song.URL))
+		return true
+	}
+
+	return false
+}
+
+func playedRecently(history []*Song, song *Song) bool {
+	for _, played := range history {
+		if played.URL == song.URL {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotPlaying     = errors.New("no song is played")
+	ErrNotSeekable    = errors.New("song cannot be seeked")
+	ErrNoChapters     = errors.New("song has no chapters")
+	ErrInvalidChapter = errors.New("invalid chapter")
+)
+
+// ChapterAt returns the index of the chapter played at the position, or -1,
+// if there is none.
+func (s *Song) ChapterAt(position time.Duration) int {
+	for i := len(s.Chapters) - 1; i >= 0; i-- {
+		if position >= s.Chapters[i].Start {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// SplitChapters returns a song for every chapter, which can be queued and
+// skipped like any other song. Songs without chapters are returned as they
+// are.
+func (s *Song) SplitChapters() []*Song {
+	if len(s.Chapters) == 0 || s.Live {
+		return []*Song{s}
+	}
+
+	songs := make([]*Song, 0, len(s.Chapters))
+	for i, chapter := range s.Chapters {
+		song := *s
+		song.Title = chapter.Title
+		song.Album = s.GetHumanName()
+		song.Chapters = nil
+		song.StartPosition = chapter.Start
+		song.EndPosition = chapter.End
+
+		// the last chapter is played until the end of the song
+		if i == len(s.Chapters)-1 || song.EndPosition <= song.StartPosition {
+			song.EndPosition = 0
+		}
+
+		songs = append(songs, &song)
+	}
+
+	return songs
+}
+
+// Seek plays the current song again from the position.
+func (p *GuildPlayer) Seek(position time.Duration) error {
+	if err := UpdateState(p.state, func(tx GuildPlayerState) error {
+		current, err := tx.GetCurrentSong()
+		if err != nil {
+			return fmt.Errorf("while getting current song: %w", err)
+		}
+
+		if current == nil {
+			return ErrNotPlaying
+		}
+		if current.Live || current.Duration <= 0 {
+			return ErrNotSeekable
+		}
+
+		song := current.Song
+		song.StartPosition = position
+
+		if err := tx.PrependSong(&song); err != nil {
+			return fmt.Errorf("while prepending song: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	p.SkipSong()
+	return nil
+}
+
+// SeekChapter plays the current song from the start of the chapter. The
+// chapters are numbered from 0.
+func (p *GuildPlayer) SeekChapter(index int) (*Chapter, error) {
+	current, err := p.state.GetCurrentSong()
+	if err != nil {
+		return nil, fmt.Errorf("while getting current song: %w", err)
+	}
+
+	if current == nil {
+		return nil, ErrNotPlaying
+	}
+	if len(current.Chapters) == 0 {
+		return nil, ErrNoChapters
+	}
+	if index < 0 || index >= len(current.Chapters) {
+		return nil, ErrInvalidChapter
+	}
+
+	chapter := current.Chapters[index]
+	if err := p.Seek(chapter.Start); err != nil {
+		return nil, err
+	}
+
+	return &chapter, nil
+}
@@ -0,0 +1,119 @@
+package bot
+
+import (
+	"context"
+	"sort"
+)
+
+// Opus encoder applications, see the Opus documentation.
+const (
+	EncoderApplicationAudio    = "audio"
+	EncoderApplicationVoIP     = "voip"
+	EncoderApplicationLowDelay = "lowdelay"
+)
+
+const DefaultEncoderProfile = "music"
+
+// DefaultVolume plays the audio with its original volume.
+const DefaultVolume = 100
+
+// EncoderProfile configures the Opus encoder used for audio, which has to be
+// transcoded. Opus audio is passed through without encoding only, if its
+// bitrate is not above Bitrate and the volume is not changed. The cache keeps
+// the audio of every profile, bitrate and volume separately.
+type EncoderProfile struct {
+	Application string
+	// Bitrate in bits per second. Zero uses the encoder default.
+	Bitrate int
+	// MaxBitrate limits the bitrate picked from the voice channel.
+	MaxBitrate int
+	// Complexity between 0 and 10 trades CPU usage for quality.
+	Complexity int
+	// InbandFEC adds data to recover lost packets, tuned for the expected
+	// PacketLossPerc.
+	InbandFEC      bool
+	PacketLossPerc int
+	// Volume scales the audio in percent. Zero and DefaultVolume keep the
+	// original volume.
+	Volume int
+}
+
+var encoderProfiles = map[string]EncoderProfile{
+	"music": {
+		Application:    EncoderApplicationAudio,
+		Complexity:     10,
+		InbandFEC:      true,
+		PacketLossPerc: 5,
+	},
+	"voice": {
+		Application:    EncoderApplicationVoIP,
+		MaxBitrate:     64000,
+		Complexity:     10,
+		InbandFEC:      true,
+		PacketLossPerc: 10,
+	},
+	"low_bandwidth": {
+		Application:    EncoderApplicationAudio,
+		MaxBitrate:     48000,
+		Complexity:     5,
+		InbandFEC:      true,
+		PacketLossPerc: 20,
+	},
+}
+
+// EncoderProfileNames returns the names of the encoder profiles in
+// alphabetical order.
+func EncoderProfileNames() []string {
+	names := make([]string, 0, len(encoderProfiles))
+	for name := range encoderProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetEncoderProfile returns the encoder profile for the guild settings and
+// the bitrate of the voice channel, in bits per second. The bitrate setting
+// takes precedence over the channel bitrate. The audio is played with the
+// default volume of the guild.
+func GetEncoderProfile(settings *GuildSettings, channelBitrate int) EncoderProfile {
+	profile, ok := encoderProfiles[settings.EncoderProfile]
+	if !ok {
+		profile = encoderProfiles[DefaultEncoderProfile]
+	}
+
+	profile.Bitrate = channelBitrate
+	if profile.MaxBitrate > 0 && profile.Bitrate > profile.MaxBitrate {
+		profile.Bitrate = profile.MaxBitrate
+	}
+	if settings.EncoderBitrate > 0 {
+		profile.Bitrate = settings.EncoderBitrate * 1000
+	}
+	profile.Volume = settings.DefaultVolume
+
+	return profile
+}
+
+type encoderProfileKey struct{}
+
+// WithEncoderProfile returns a context, which makes audio sources encode the
+// audio with the profile.
+func WithEncoderProfile(ctx context.Context, profile EncoderProfile) context.Context {
+	return context.WithValue(ctx, encoderProfileKey{}, profile)
+}
+
+// EncoderProfileFromContext returns the profile set with WithEncoderProfile
+// or the default profile.
+func EncoderProfileFromContext(ctx context.Context) EncoderProfile {
+	if profile, ok := ctx.Value(encoderProfileKey{}).(EncoderProfile); ok {
+		return profile
+	}
+
+	return encoderProfiles[DefaultEncoderProfile]
+}
+
+// ChangesVolume reports if the audio is played with another than its
+// original volume.
+func (p EncoderProfile) ChangesVolume() bool {
+	return p.Volume > 0 && p.Volume != DefaultVolume
+}
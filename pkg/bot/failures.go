@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Failure policies decide, what happens with a song, which failed to play.
+const (
+	FailurePolicySkip  = "skip"
+	FailurePolicyRetry = "retry"
+)
+
+const (
+	// maxFailedSongs is the number of failed songs kept in memory.
+	maxFailedSongs = 50
+
+	maxPlaylistRestarts  = 3
+	playlistRestartDelay = 10 * time.Second
+)
+
+var ErrTooManyFailures = errors.New("too many songs failed in a row")
+
+// FailedSong is a song, which could not be played.
+type FailedSong struct {
+	Song     *Song
+	Err      error
+	FailedAt time.Time
+}
+
+// GetFailedSongs returns the songs, which recently failed to play, the most
+// recent first.
+func (p *GuildPlayer) GetFailedSongs() []*FailedSong {
+	p.failedMutex.Lock()
+	defer p.failedMutex.Unlock()
+
+	failed := make([]*FailedSong, len(p.failed))
+	copy(failed, p.failed)
+	return failed
+}
+
+func (p *GuildPlayer) addFailedSong(song *Song, err error) {
+	p.failedMutex.Lock()
+	defer p.failedMutex.Unlock()
+
+	failed := make([]*FailedSong, 0, maxFailedSongs)
+	failed = append(failed, &FailedSong{Song: song, Err: err, FailedAt: time.Now()})
+	for _, f := range p.failed {
+		if len(failed) < maxFailedSongs {
+			failed = append(failed, f)
+		}
+	}
+
+	p.failed = failed
+}
+
+// triggerAfter plays the queued songs after the delay.
+func (p *GuildPlayer) triggerAfter(ctx context.Context, delay time.Duration) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		select {
+		case <-ctx.Done():
+		case p.triggerCh <- Trigger{Command: "play"}:
+		}
+	}()
+}
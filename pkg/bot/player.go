@@ -4,8 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/Trojan295/discord-airplay/pkg/locale"
 	"go.uber.org/zap"
 )
 
@@ -21,16 +25,69 @@ type Song struct {
 	Type string
 
 	Title        string
+	Artist       string
+	Album        string
+	Uploader     string
 	URL          string
 	Playable     bool
 	ThumbnailURL *string
 
 	Duration      time.Duration
 	StartPosition time.Duration
+	// EndPosition stops the song before its end, e.g. for a chapter queued as
+	// a song. Zero plays the song until its end.
+	EndPosition time.Duration
+	// Live songs are continuous streams without a duration, which cannot be seeked.
+	Live bool
+
+	UploadDate time.Time
+	Chapters   []Chapter
+	// Segments are the parts of the song, which can be skipped, like the
+	// SponsorBlock segments of a video.
+	Segments []Segment
+
+	// Partial songs have only the metadata listed in a playlist. They are
+	// resolved with the SongResolver before they are played.
+	Partial bool
 
 	RequestedBy *string
 }
 
+// Chapter is a part of a song, e.g. a track of a DJ set.
+type Chapter struct {
+	Title string
+	Start time.Duration
+	End   time.Duration
+}
+
+// GetAuthor returns the artist or, if it is not known, the uploader.
+func (s *Song) GetAuthor() string {
+	if s.Artist != "" {
+		return s.Artist
+	}
+
+	return s.Uploader
+}
+
+// GetLength returns the duration of the song or, if it has an EndPosition,
+// of the part, which is played.
+func (s *Song) GetLength() time.Duration {
+	if s.EndPosition > 0 {
+		return s.EndPosition - s.StartPosition
+	}
+
+	return s.Duration
+}
+
+// end returns the position, at which the song stops.
+func (s *Song) end() time.Duration {
+	if s.EndPosition > 0 {
+		return s.EndPosition
+	}
+
+	return s.Duration
+}
+
 func (s *Song) GetHumanName() string {
 	if s.Title != "" {
 		return s.Title
@@ -40,8 +97,15 @@ func (s *Song) GetHumanName() string {
 }
 
 type PlayMessage struct {
-	Song     *Song
+	Song *Song
+	// Position is the position in the song, including its StartPosition.
 	Position time.Duration
+	// StreamTitle is the track currently played by a live stream.
+	StreamTitle string
+	// Err is set, when the song failed to play.
+	Err error
+	// Locale is the language of the message.
+	Locale string
 }
 
 type VoiceChatSession interface {
@@ -51,10 +115,16 @@ type VoiceChatSession interface {
 	EditPlayMessage(channelID, messageID string, message *PlayMessage) error
 	JoinVoiceChannel(channelID string) error
 	LeaveVoiceChannel() error
+	// GetBitrate returns the bitrate of the joined voice channel in bits per
+	// second or zero, if it is not known.
+	GetBitrate() int
 	SendAudio(ctx context.Context, opusCh <-chan []byte, positionCallback func(time.Duration)) error
 }
 
-type SongAudioGetter func(ctx context.Context, song *Song) (<-chan []byte, error)
+type SongAudioGetter func(ctx context.Context, song *Song) (*AudioStream, error)
+
+// SongResolver returns the song with its full metadata.
+type SongResolver func(ctx context.Context, song *Song) (*Song, error)
 
 type PlayedSong struct {
 	Song
@@ -64,6 +134,8 @@ type PlayedSong struct {
 type GuildPlayerState interface {
 	PrependSong(*Song) error
 	AppendSong(*Song) error
+	AppendSongs([]*Song) error
+	ReplaceQueue([]*Song) error
 	RemoveSong(int) (*Song, error)
 	ClearPlaylist() error
 	GetSongs() ([]*Song, error)
@@ -79,23 +151,67 @@ type GuildPlayerState interface {
 	SetCurrentSong(*PlayedSong) error
 }
 
+// TransactionalGuildPlayerState is implemented by states, which can apply
+// multiple mutations atomically. If fn returns an error, none of the
+// mutations done on tx are applied.
+type TransactionalGuildPlayerState interface {
+	Update(fn func(tx GuildPlayerState) error) error
+}
+
+// UpdateState runs fn in a transaction, if the state supports them, or
+// directly on the state otherwise.
+func UpdateState(state GuildPlayerState, fn func(tx GuildPlayerState) error) error {
+	if ts, ok := state.(TransactionalGuildPlayerState); ok {
+		return ts.Update(fn)
+	}
+
+	return fn(state)
+}
+
 type GuildPlayer struct {
 	session VoiceChatSession
 
-	state GuildPlayerState
+	state    GuildPlayerState
+	settings GuildSettingsStore
+	// settingsMutex serializes the settings updates, if the store is not
+	// transactional.
+	settingsMutex sync.Mutex
 
 	ctx context.Context
 
 	triggerCh     chan Trigger
 	songCtxCancel context.CancelFunc
 
-	songAudioGetter SongAudioGetter
+	// resolveCtx is the context of the songs resolved in the background,
+	// which is canceled, when the queue is cleared.
+	resolveMutex  sync.Mutex
+	resolveCtx    context.Context
+	resolveCancel context.CancelFunc
+
+	songAudioGetter     SongAudioGetter
+	songResolver        SongResolver
+	segmentProvider     SegmentProvider
+	relatedSongProvider RelatedSongProvider
+
+	// stopped is set by Stop, so autoplay does not queue songs after the
+	// playback was stopped.
+	stopped atomic.Bool
+
+	historyMutex sync.Mutex
+	history      []*Song
+
+	failedMutex sync.Mutex
+	failed      []*FailedSong
 
 	logger *zap.Logger
 }
 
+// maxHistoryLength is the number of recently played songs kept in memory.
+const maxHistoryLength = 50
+
 var (
 	ErrRemoveInvalidPosition = errors.New("invalid position")
+	ErrQueueFull             = errors.New("queue is full")
 )
 
 func NewGuildPlayer(ctx context.Context, session VoiceChatSession, guildID string, state GuildPlayerState, dCADataGetter SongAudioGetter) *GuildPlayer {
@@ -114,6 +230,91 @@ func (p *GuildPlayer) WithLogger(l *zap.Logger) *GuildPlayer {
 	return p
 }
 
+func (p *GuildPlayer) WithSongResolver(r SongResolver) *GuildPlayer {
+	p.songResolver = r
+	return p
+}
+
+// WithSegmentProvider enables skipping the segments returned by the provider.
+func (p *GuildPlayer) WithSegmentProvider(sp SegmentProvider) *GuildPlayer {
+	p.segmentProvider = sp
+	return p
+}
+
+func (p *GuildPlayer) WithSettings(s GuildSettingsStore) *GuildPlayer {
+	p.settings = s
+	return p
+}
+
+func (p *GuildPlayer) GetSettings() (*GuildSettings, error) {
+	if p.settings == nil {
+		return DefaultGuildSettings(), nil
+	}
+
+	settings, err := p.settings.GetSettings()
+	if err != nil {
+		return nil, fmt.Errorf("while getting settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// UpdateSettings changes the settings with fn atomically, so concurrent
+// changes of different settings are not lost. If fn returns an error, the
+// settings are not changed.
+func (p *GuildPlayer) UpdateSettings(fn func(s *GuildSettings) error) error {
+	if p.settings == nil {
+		return errors.New("settings store is not configured")
+	}
+
+	if ts, ok := p.settings.(TransactionalGuildSettingsStore); ok {
+		return ts.UpdateSettings(fn)
+	}
+
+	p.settingsMutex.Lock()
+	defer p.settingsMutex.Unlock()
+
+	settings, err := p.settings.GetSettings()
+	if err != nil {
+		return fmt.Errorf("while getting settings: %w", err)
+	}
+
+	if err := fn(settings); err != nil {
+		return err
+	}
+
+	if err := p.settings.SetSettings(settings); err != nil {
+		return fmt.Errorf("while setting settings: %w", err)
+	}
+
+	return nil
+}
+
+// GetHistory returns the recently played songs, the most recent first.
+func (p *GuildPlayer) GetHistory() []*Song {
+	p.historyMutex.Lock()
+	defer p.historyMutex.Unlock()
+
+	history := make([]*Song, len(p.history))
+	copy(history, p.history)
+	return history
+}
+
+func (p *GuildPlayer) addToHistory(song *Song) {
+	p.historyMutex.Lock()
+	defer p.historyMutex.Unlock()
+
+	history := make([]*Song, 0, maxHistoryLength)
+	history = append(history, song)
+	for _, s := range p.history {
+		if s.URL != song.URL && len(history) < maxHistoryLength {
+			history = append(history, s)
+		}
+	}
+
+	p.history = history
+}
+
 func (p *GuildPlayer) Close() error {
 	p.songCtxCancel()
 	return p.session.Close()
@@ -132,11 +333,32 @@ func (p *GuildPlayer) SendMessage(message string) {
 }
 
 func (p *GuildPlayer) AddSong(textChannelID, voiceChannelID *string, songs ...*Song) error {
-	for _, song := range songs {
-		if err := p.state.AppendSong(song); err != nil {
-			return fmt.Errorf("while appending song: %w", err)
+	settings, err := p.GetSettings()
+	if err != nil {
+		return err
+	}
+
+	if err := UpdateState(p.state, func(tx GuildPlayerState) error {
+		if settings.MaxQueueLength > 0 {
+			queued, err := tx.GetSongs()
+			if err != nil {
+				return fmt.Errorf("while getting songs: %w", err)
+			}
+
+			if len(queued)+len(songs) > settings.MaxQueueLength {
+				return ErrQueueFull
+			}
+		}
+
+		if err := tx.AppendSongs(songs); err != nil {
+			return fmt.Errorf("while appending songs: %w", err)
 		}
+
+		return nil
+	}); err != nil {
+		return err
 	}
+	p.stopped.Store(false)
 
 	go func() {
 		p.triggerCh <- Trigger{
@@ -156,6 +378,9 @@ func (p *GuildPlayer) SkipSong() {
 }
 
 func (p *GuildPlayer) Stop() error {
+	p.stopped.Store(true)
+	p.cancelResolving()
+
 	if err := p.state.ClearPlaylist(); err != nil {
 		return fmt.Errorf("while clearing playlist: %w", err)
 	}
@@ -176,6 +401,57 @@ func (p *GuildPlayer) RemoveSong(position int) (*Song, error) {
 	return song, nil
 }
 
+func (p *GuildPlayer) ShuffleQueue() error {
+	return UpdateState(p.state, func(tx GuildPlayerState) error {
+		songs, err := tx.GetSongs()
+		if err != nil {
+			return fmt.Errorf("while getting songs: %w", err)
+		}
+
+		rand.Shuffle(len(songs), func(i, j int) {
+			songs[i], songs[j] = songs[j], songs[i]
+		})
+
+		if err := tx.ReplaceQueue(songs); err != nil {
+			return fmt.Errorf("while replacing queue: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// MoveSong moves the song at position from to position to. Positions start
+// at 1, like in RemoveSong.
+func (p *GuildPlayer) MoveSong(from, to int) (*Song, error) {
+	var moved *Song
+
+	err := UpdateState(p.state, func(tx GuildPlayerState) error {
+		songs, err := tx.GetSongs()
+		if err != nil {
+			return fmt.Errorf("while getting songs: %w", err)
+		}
+
+		if from < 1 || from > len(songs) || to < 1 || to > len(songs) {
+			return ErrRemoveInvalidPosition
+		}
+
+		moved = songs[from-1]
+		songs = append(songs[:from-1], songs[from:]...)
+		songs = append(songs[:to-1], append([]*Song{moved}, songs[to-1:]...)...)
+
+		if err := tx.ReplaceQueue(songs); err != nil {
+			return fmt.Errorf("while replacing queue: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return moved, nil
+}
+
 func (p *GuildPlayer) GetPlaylist() ([]string, error) {
 	songs, err := p.state.GetSongs()
 	if err != nil {
@@ -190,20 +466,44 @@ func (p *GuildPlayer) GetPlaylist() ([]string, error) {
 	return playlist, err
 }
 
+func (p *GuildPlayer) GetSongs() ([]*Song, error) {
+	songs, err := p.state.GetSongs()
+	if err != nil {
+		return nil, fmt.Errorf("while getting songs: %w", err)
+	}
+
+	return songs, nil
+}
+
 func (p *GuildPlayer) GetPlayedSong() (*PlayedSong, error) {
 	return p.state.GetCurrentSong()
 }
 
 func (p *GuildPlayer) Run(ctx context.Context) error {
-	currentSong, err := p.state.GetCurrentSong()
-	if err != nil {
-		p.logger.Info("failed to get current song", zap.Error(err))
-	} else if currentSong != nil {
-		currentSong.StartPosition += currentSong.Position
+	if err := UpdateState(p.state, func(tx GuildPlayerState) error {
+		currentSong, err := tx.GetCurrentSong()
+		if err != nil {
+			return fmt.Errorf("while getting current song: %w", err)
+		}
+
+		if currentSong == nil {
+			return nil
+		}
+
+		// the song is copied, as the stored one is not changed, if the
+		// transaction fails
+		song := currentSong.Song
+		if !song.Live {
+			song.StartPosition += currentSong.Position
+		}
 
-		if err := p.state.PrependSong(&currentSong.Song); err != nil {
-			p.logger.Info("failed to prepend current song in the playlist", zap.Error(err))
+		if err := tx.PrependSong(&song); err != nil {
+			return fmt.Errorf("while prepending current song: %w", err)
 		}
+
+		return tx.SetCurrentSong(nil)
+	}); err != nil {
+		p.logger.Info("failed to requeue current song", zap.Error(err))
 	}
 
 	songs, err := p.state.GetSongs()
@@ -230,6 +530,8 @@ func (p *GuildPlayer) Run(ctx context.Context) error {
 		}()
 	}
 
+	restarts := 0
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -260,6 +562,15 @@ func (p *GuildPlayer) Run(ctx context.Context) error {
 
 				if err := p.playPlaylist(ctx); err != nil {
 					p.logger.Error("failed to play playlist", zap.Error(err))
+
+					// the remaining songs are played, when the problem was
+					// temporary, e.g. joining the voice channel failed
+					if !errors.Is(err, ErrTooManyFailures) && restarts < maxPlaylistRestarts {
+						restarts++
+						p.triggerAfter(ctx, playlistRestartDelay*time.Duration(restarts))
+					}
+				} else {
+					restarts = 0
 				}
 			}
 		}
@@ -277,11 +588,23 @@ func (p *GuildPlayer) playPlaylist(ctx context.Context) error {
 		return fmt.Errorf("while getting text channel: %w", err)
 	}
 
+	settings, err := p.GetSettings()
+	if err != nil {
+		p.logger.Error("failed to get settings", zap.Error(err))
+		settings = DefaultGuildSettings()
+	}
+	if settings.AnnounceChannel != "" {
+		textChannel = settings.AnnounceChannel
+	}
+
 	p.logger.Debug("joining voice channel", zap.String("channel", voiceChannel))
 	if err := p.session.JoinVoiceChannel(voiceChannel); err != nil {
 		return fmt.Errorf("failed to join voice channel: %w", err)
 	}
 
+	encoderProfile := GetEncoderProfile(settings, p.session.GetBitrate())
+	p.logger.Debug("picked encoder profile", zap.Any("profile", encoderProfile))
+
 	defer func() {
 		p.logger.Debug("leaving voice channel", zap.String("channel", voiceChannel))
 		if err := p.session.LeaveVoiceChannel(); err != nil {
@@ -289,9 +612,19 @@ func (p *GuildPlayer) playPlaylist(ctx context.Context) error {
 		}
 	}()
 
+	consecutiveFailures := 0
+
 	for {
 		song, err := p.state.PopFirstSong()
 		if err == ErrNoSongs {
+			if settings.Autoplay && !p.stopped.Load() && p.queueRelatedSong(ctx) {
+				continue
+			}
+
+			if p.waitForSongs(ctx, settings.IdleTimeout) {
+				continue
+			}
+
 			p.logger.Debug("playlist is empty")
 			break
 		}
@@ -302,50 +635,175 @@ func (p *GuildPlayer) playPlaylist(ctx context.Context) error {
 		logger := p.logger.With(zap.String("title", song.Title), zap.String("url", song.URL))
 		logger.Debug("picking next song")
 
-		if err := p.state.SetCurrentSong(&PlayedSong{Song: *song}); err != nil {
-			return fmt.Errorf("while setting current song: %w", err)
+		err = p.playSong(ctx, song, textChannel, settings.Locale, encoderProfile)
+		if err != nil && settings.FailurePolicy == FailurePolicyRetry && !IsPermanentAudioError(err) && ctx.Err() == nil {
+			logger.Info("failed to play song, retrying it", zap.Error(err))
+			err = p.playSong(ctx, song, textChannel, settings.Locale, encoderProfile)
 		}
 
-		var songCtx context.Context
-		songCtx, p.songCtxCancel = context.WithCancel(ctx)
+		if err == nil {
+			consecutiveFailures = 0
+		} else {
+			logger.Info("failed to play song, skipping it", zap.Error(err))
+			p.addFailedSong(song, err)
 
-		playMsgID, err := p.session.SendPlayMessage(textChannel, &PlayMessage{
-			Song: song,
-		})
-		if err != nil {
-			return fmt.Errorf("while sending message with song name: %w", err)
+			consecutiveFailures++
+			if settings.MaxConsecutiveFailures > 0 && consecutiveFailures >= settings.MaxConsecutiveFailures {
+				if err := p.session.SendMessage(textChannel, locale.Sprintf(settings.Locale, "⏹️ Stopped playing, because %d songs failed in a row.", consecutiveFailures)); err != nil {
+					logger.Error("failed to send message", zap.Error(err))
+				}
+				return ErrTooManyFailures
+			}
 		}
 
-		opusCh, err := p.songAudioGetter(songCtx, song)
-		if err != nil {
-			return fmt.Errorf("while getting DCA data from song %v: %w", song, err)
-		}
+		time.Sleep(250 * time.Millisecond)
+	}
 
-		logger.Debug("sending audio")
-		if err := p.session.SendAudio(songCtx, opusCh, func(d time.Duration) {
-			if err := p.state.SetCurrentSong(&PlayedSong{Song: *song, Position: d}); err != nil {
-				logger.Error("failed to set current song position", zap.Error(err))
+	return nil
+}
+
+// waitForSongs waits up to the timeout for songs to be queued. It returns
+// true, if there are songs to play.
+func (p *GuildPlayer) waitForSongs(ctx context.Context, timeout time.Duration) bool {
+	if timeout <= 0 {
+		return false
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	deadline := time.After(timeout)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-deadline:
+			return false
+		case <-ticker.C:
+			songs, err := p.state.GetSongs()
+			if err != nil {
+				p.logger.Error("failed to get songs", zap.Error(err))
+				return false
 			}
-			if err := p.session.EditPlayMessage(textChannel, playMsgID, &PlayMessage{Song: song, Position: d}); err != nil {
-				logger.Error("failed to edit message", zap.Error(err))
+			if len(songs) > 0 {
+				return true
 			}
+		}
+	}
+}
 
-		}); err != nil {
-			return fmt.Errorf("while sending audio data: %w", err)
+// playSong plays the song until it ends, fails or is skipped.
+func (p *GuildPlayer) playSong(ctx context.Context, song *Song, textChannel, lang string, encoderProfile EncoderProfile) error {
+	logger := p.logger.With(zap.String("title", song.Title), zap.String("url", song.URL))
+
+	if song.Partial {
+		resolved, err := p.resolveSong(ctx, song)
+		if err != nil {
+			if err := p.session.SendMessage(textChannel, locale.Sprintf(lang, "⏭️ Skipped %s, it cannot be played.", song.GetHumanName())); err != nil {
+				logger.Error("failed to send message", zap.Error(err))
+			}
+			return fmt.Errorf("while resolving song: %w", err)
 		}
+		song = resolved
+	}
 
-		logger.Debug("finished sending audio")
+	if err := p.state.SetCurrentSong(&PlayedSong{Song: *song}); err != nil {
+		return fmt.Errorf("while setting current song: %w", err)
+	}
+	p.addToHistory(song)
 
-		if err := p.session.EditPlayMessage(textChannel, playMsgID, &PlayMessage{Song: song, Position: song.Duration}); err != nil {
+	defer func() {
+		if err := p.state.SetCurrentSong(nil); err != nil {
+			logger.Error("failed to reset current song", zap.Error(err))
+		}
+	}()
+
+	var songCtx context.Context
+	songCtx, p.songCtxCancel = context.WithCancel(ctx)
+	songCtx = WithEncoderProfile(songCtx, encoderProfile)
+
+	streamTitle := atomic.Value{}
+	streamTitle.Store("")
+	songCtx = WithStreamTitleCallback(songCtx, func(title string) {
+		streamTitle.Store(title)
+	})
+
+	// the song is played, even if the message cannot be sent
+	playMsgID, err := p.session.SendPlayMessage(textChannel, &PlayMessage{
+		Song:   song,
+		Locale: lang,
+	})
+	if err != nil {
+		logger.Error("failed to send message with song name", zap.Error(err))
+	}
+
+	editPlayMessage := func(message *PlayMessage) {
+		if playMsgID == "" {
+			return
+		}
+		message.Locale = lang
+		if err := p.session.EditPlayMessage(textChannel, playMsgID, message); err != nil {
 			logger.Error("failed to edit message", zap.Error(err))
 		}
+	}
 
-		if err := p.state.SetCurrentSong(nil); err != nil {
-			return fmt.Errorf("while setting current song: %w", err)
+	stream, err := p.getResumingAudio(songCtx, song)
+	if err != nil {
+		editPlayMessage(&PlayMessage{Song: song, Err: err})
+		return fmt.Errorf("while getting audio: %w", err)
+	}
+
+	stream, skipper := skipSegments(songCtx, stream, song.StartPosition, p.getSegments(songCtx, song))
+
+	position := atomic.Int64{}
+
+	logger.Debug("sending audio")
+	if err := p.session.SendAudio(songCtx, stream.Frames(), func(played time.Duration) {
+		// the skipped segments are not played, but are a part of the song
+		d := skipper.position(played)
+		position.Store(int64(d))
+
+		if err := p.state.SetCurrentSong(&PlayedSong{Song: *song, Position: d}); err != nil {
+			logger.Error("failed to set current song position", zap.Error(err))
 		}
+		editPlayMessage(&PlayMessage{Song: song, Position: song.StartPosition + d, StreamTitle: streamTitle.Load().(string)})
+	}); err != nil {
+		// stop the source, which waits for the frames to be read
+		p.songCtxCancel()
+		editPlayMessage(&PlayMessage{Song: song, Position: song.StartPosition + time.Duration(position.Load()), Err: err})
+		return fmt.Errorf("while sending audio data: %w", err)
+	}
 
-		time.Sleep(250 * time.Millisecond)
+	logger.Debug("finished sending audio")
+
+	streamErr := stream.Err()
+	if streamErr != nil {
+		logger.Info("stream failed", zap.Error(streamErr), zap.String("diagnostics", stream.Diagnostics()))
 	}
 
-	return nil
+	finalPosition := song.end()
+	if song.Live || streamErr != nil {
+		finalPosition = song.StartPosition + time.Duration(position.Load())
+	}
+
+	editPlayMessage(&PlayMessage{Song: song, Position: finalPosition, StreamTitle: streamTitle.Load().(string), Err: streamErr})
+
+	return streamErr
+}
+
+// getSegments returns the segments of the song, which are skipped. Live songs
+// have no segments.
+func (p *GuildPlayer) getSegments(ctx context.Context, song *Song) []Segment {
+	if p.segmentProvider == nil || song.Live {
+		return nil
+	}
+
+	segments, err := p.segmentProvider(ctx, song)
+	if err != nil {
+		p.logger.Info("failed to get skipped segments", zap.Error(err), zap.String("url", song.URL))
+		return nil
+	}
+
+	return segments
 }
@@ -0,0 +1,680 @@
+package bot_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/bot/store"
+)
+
+// fakeSession plays the audio instantly and records the sent messages.
+type fakeSession struct {
+	mutex    sync.Mutex
+	messages []string
+	left     chan struct{}
+}
+
+func newFakeSession() *fakeSession {
+	return &fakeSession{left: make(chan struct{}, 10)}
+}
+
+func (s *fakeSession) Close() error { return nil }
+
+func (s *fakeSession) SendMessage(channelID, message string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+func (s *fakeSession) SendPlayMessage(channelID string, message *bot.PlayMessage) (string, error) {
+	return "message", nil
+}
+
+func (s *fakeSession) EditPlayMessage(channelID, messageID string, message *bot.PlayMessage) error {
+	return nil
+}
+
+func (s *fakeSession) JoinVoiceChannel(channelID string) error { return nil }
+
+func (s *fakeSession) LeaveVoiceChannel() error {
+	s.left <- struct{}{}
+	return nil
+}
+
+func (s *fakeSession) GetBitrate() int { return 0 }
+
+func (s *fakeSession) SendAudio(ctx context.Context, opusCh <-chan []byte, positionCallback func(time.Duration)) error {
+	played := time.Duration(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-opusCh:
+			if !ok {
+				return nil
+			}
+			played += 20 * time.Millisecond
+			positionCallback(played)
+		}
+	}
+}
+
+func (s *fakeSession) Messages() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return slices.Clone(s.messages)
+}
+
+// fakeAudio returns streams of a few frames and records the requested songs.
+type fakeAudio struct {
+	mutex     sync.Mutex
+	requested []bot.Song
+	err       error
+}
+
+func (a *fakeAudio) GetAudio(ctx context.Context, song *bot.Song) (*bot.AudioStream, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	a.requested = append(a.requested, *song)
+	if a.err != nil {
+		return nil, a.err
+	}
+
+	stream := bot.NewAudioStream()
+	for i := 0; i < 5; i++ {
+		stream.Send(ctx, []byte{0xfc})
+	}
+	stream.Close(nil)
+
+	return stream, nil
+}
+
+func (a *fakeAudio) Requested() []string {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	urls := make([]string, len(a.requested))
+	for i, song := range a.requested {
+		urls[i] = song.URL
+	}
+	return urls
+}
+
+func (a *fakeAudio) RequestedSongs() []bot.Song {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return slices.Clone(a.requested)
+}
+
+// newTestPlayer returns a player with the settings changed by update. A nil
+// state is replaced with an in-memory one. The player is not running yet, so
+// it can still be configured.
+func newTestPlayer(t *testing.T, state bot.GuildPlayerState, audio *fakeAudio, update func(s *bot.GuildSettings)) (*bot.GuildPlayer, *fakeSession) {
+	t.Helper()
+
+	if state == nil {
+		state = store.NewInmemoryGuildPlayerState()
+	}
+
+	session := newFakeSession()
+	settings := store.NewInmemoryGuildSettingsStorage()
+	player := bot.NewGuildPlayer(context.Background(), session, "guild", state, audio.GetAudio).
+		WithSettings(settings)
+
+	if update != nil {
+		if err := player.UpdateSettings(func(s *bot.GuildSettings) error {
+			update(s)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return player, session
+}
+
+// runPlayer runs the player until the end of the test.
+func runPlayer(t *testing.T, player *bot.GuildPlayer) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go player.Run(ctx)
+}
+
+// playSongs queues the songs and waits until the player leaves the voice
+// channel.
+func playSongs(t *testing.T, player *bot.GuildPlayer, session *fakeSession, songs ...*bot.Song) {
+	t.Helper()
+
+	channel := "channel"
+	if err := player.AddSong(&channel, &channel, songs...); err != nil {
+		t.Fatalf("AddSong() error = %v", err)
+	}
+
+	select {
+	case <-session.left:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the player did not finish playing")
+	}
+}
+
+func testSong(url string) *bot.Song {
+	return &bot.Song{Title: url, URL: url, Playable: true}
+}
+
+func TestGuildPlayerAutoplay(t *testing.T) {
+	related := map[string][]*bot.Song{
+		"https://example.com/a": {
+			testSong("https://example.com/a"),
+			{URL: "https://example.com/upcoming", Playable: false},
+			testSong("https://example.com/b"),
+			testSong("https://example.com/c"),
+		},
+		"https://example.com/b": {
+			testSong("https://example.com/a"),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		autoplay bool
+		want     []string
+	}{
+		{name: "disabled", autoplay: false, want: []string{"https://example.com/a"}},
+		{name: "enabled", autoplay: true, want: []string{"https://example.com/a", "https://example.com/b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audio := &fakeAudio{}
+			player, session := newTestPlayer(t, nil, audio, func(s *bot.GuildSettings) {
+				s.Autoplay = tt.autoplay
+			})
+			player.WithRelatedSongProvider(func(ctx context.Context, song *bot.Song) ([]*bot.Song, error) {
+				return related[song.URL], nil
+			})
+			runPlayer(t, player)
+
+			playSongs(t, player, session, testSong("https://example.com/a"))
+
+			// the related songs of b were all played recently
+			if got := audio.Requested(); !slices.Equal(got, tt.want) {
+				t.Errorf("played songs = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGuildPlayerLocale(t *testing.T) {
+	audio := &fakeAudio{err: errors.New("broken")}
+	player, session := newTestPlayer(t, nil, audio, func(s *bot.GuildSettings) {
+		s.Locale = "de-DE"
+		s.MaxConsecutiveFailures = 1
+	})
+	runPlayer(t, player)
+
+	playSongs(t, player, session, testSong("https://example.com/a"))
+
+	want := []string{"⏹️ Wiedergabe gestoppt, weil 1 Songs nacheinander fehlgeschlagen sind."}
+	if got := session.Messages(); !slices.Equal(got, want) {
+		t.Errorf("messages = %q, want %q", got, want)
+	}
+}
+
+func TestGuildPlayerStopsAfterConsecutiveFailures(t *testing.T) {
+	// the songs are queued before the player runs, so it plays them once
+	state := newQueuedState(t, "https://example.com/a", "https://example.com/b", "https://example.com/c", "https://example.com/d")
+	audio := &fakeAudio{err: bot.ErrNetwork}
+	player, session := newTestPlayer(t, state, audio, func(s *bot.GuildSettings) {
+		s.MaxConsecutiveFailures = 3
+	})
+	runPlayer(t, player)
+
+	select {
+	case <-session.left:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the player did not stop playing")
+	}
+
+	wantPlayed := []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+	if got := audio.Requested(); !slices.Equal(got, wantPlayed) {
+		t.Errorf("played songs = %q, want %q", got, wantPlayed)
+	}
+
+	wantMessages := []string{"⏹️ Stopped playing, because 3 songs failed in a row."}
+	if got := session.Messages(); !slices.Equal(got, wantMessages) {
+		t.Errorf("messages = %q, want %q", got, wantMessages)
+	}
+
+	failed := player.GetFailedSongs()
+	var failedURLs []string
+	for _, f := range failed {
+		failedURLs = append(failedURLs, f.Song.URL)
+		if !errors.Is(f.Err, bot.ErrNetwork) {
+			t.Errorf("failed song %s error = %v, want %v", f.Song.URL, f.Err, bot.ErrNetwork)
+		}
+	}
+	wantFailed := []string{"https://example.com/c", "https://example.com/b", "https://example.com/a"}
+	if !slices.Equal(failedURLs, wantFailed) {
+		t.Errorf("failed songs = %q, want %q", failedURLs, wantFailed)
+	}
+
+	// the songs after the failures stay queued
+	if got, want := queueURLs(t, state), []string{"https://example.com/d"}; !slices.Equal(got, want) {
+		t.Errorf("queue = %q, want %q", got, want)
+	}
+}
+
+func TestGuildPlayerFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		err    error
+		want   []string
+	}{
+		{
+			name:   "skip",
+			policy: bot.FailurePolicySkip,
+			err:    bot.ErrNetwork,
+			want:   []string{"https://example.com/a", "https://example.com/b"},
+		},
+		{
+			name:   "retry",
+			policy: bot.FailurePolicyRetry,
+			err:    bot.ErrNetwork,
+			want:   []string{"https://example.com/a", "https://example.com/a", "https://example.com/b", "https://example.com/b"},
+		},
+		{
+			name:   "retry permanent error",
+			policy: bot.FailurePolicyRetry,
+			err:    bot.ErrGeoBlocked,
+			want:   []string{"https://example.com/a", "https://example.com/b"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audio := &fakeAudio{err: tt.err}
+			player, session := newTestPlayer(t, nil, audio, func(s *bot.GuildSettings) {
+				s.FailurePolicy = tt.policy
+				s.MaxConsecutiveFailures = 0
+			})
+			runPlayer(t, player)
+
+			playSongs(t, player, session, testSong("https://example.com/a"), testSong("https://example.com/b"))
+
+			if got := audio.Requested(); !slices.Equal(got, tt.want) {
+				t.Errorf("played songs = %q, want %q", got, tt.want)
+			}
+			if got := len(player.GetFailedSongs()); got != 2 {
+				t.Errorf("failed songs = %d, want 2", got)
+			}
+			if got := session.Messages(); len(got) != 0 {
+				t.Errorf("messages = %q, want none", got)
+			}
+		})
+	}
+}
+
+var errTransactionFailed = errors.New("transaction failed")
+
+// failingState is an in-memory state, which fails the transactions, when
+// they replace the queue or the current song.
+type failingState struct {
+	*store.InmemoryPlaylistStorage
+}
+
+func (s failingState) Update(fn func(tx bot.GuildPlayerState) error) error {
+	return s.InmemoryPlaylistStorage.Update(func(tx bot.GuildPlayerState) error {
+		return fn(failingTx{tx})
+	})
+}
+
+type failingTx struct {
+	bot.GuildPlayerState
+}
+
+func (tx failingTx) ReplaceQueue([]*bot.Song) error { return errTransactionFailed }
+
+func (tx failingTx) SetCurrentSong(*bot.PlayedSong) error { return errTransactionFailed }
+
+// queueURLs returns the URLs of the queued songs.
+func queueURLs(t *testing.T, state bot.GuildPlayerState) []string {
+	t.Helper()
+
+	songs, err := state.GetSongs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls := make([]string, len(songs))
+	for i, song := range songs {
+		urls[i] = song.URL
+	}
+	return urls
+}
+
+func newQueuedState(t *testing.T, urls ...string) *store.InmemoryPlaylistStorage {
+	t.Helper()
+
+	state := store.NewInmemoryGuildPlayerState()
+	for _, url := range urls {
+		if err := state.AppendSong(testSong(url)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return state
+}
+
+func TestGuildPlayerMoveSong(t *testing.T) {
+	queue := []string{"a", "b", "c", "d"}
+
+	tests := []struct {
+		name    string
+		from    int
+		to      int
+		want    []string
+		wantErr error
+	}{
+		{name: "down", from: 1, to: 3, want: []string{"b", "c", "a", "d"}},
+		{name: "up", from: 4, to: 1, want: []string{"d", "a", "b", "c"}},
+		{name: "to the end", from: 1, to: 4, want: []string{"b", "c", "d", "a"}},
+		{name: "same position", from: 2, to: 2, want: queue},
+		{name: "from zero", from: 0, to: 1, want: queue, wantErr: bot.ErrRemoveInvalidPosition},
+		{name: "from after the end", from: 5, to: 1, want: queue, wantErr: bot.ErrRemoveInvalidPosition},
+		{name: "to zero", from: 2, to: 0, want: queue, wantErr: bot.ErrRemoveInvalidPosition},
+		{name: "to after the end", from: 1, to: 5, want: queue, wantErr: bot.ErrRemoveInvalidPosition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := newQueuedState(t, queue...)
+			player, _ := newTestPlayer(t, state, &fakeAudio{}, nil)
+
+			moved, err := player.MoveSong(tt.from, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("MoveSong() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && moved.URL != queue[tt.from-1] {
+				t.Errorf("MoveSong() = %s, want %s", moved.URL, queue[tt.from-1])
+			}
+
+			if got := queueURLs(t, state); !slices.Equal(got, tt.want) {
+				t.Errorf("queue = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("failed transaction", func(t *testing.T) {
+		state := newQueuedState(t, queue...)
+		player, _ := newTestPlayer(t, failingState{state}, &fakeAudio{}, nil)
+
+		if _, err := player.MoveSong(1, 3); !errors.Is(err, errTransactionFailed) {
+			t.Fatalf("MoveSong() error = %v, want %v", err, errTransactionFailed)
+		}
+
+		if got := queueURLs(t, state); !slices.Equal(got, queue) {
+			t.Errorf("queue = %q, want %q", got, queue)
+		}
+	})
+}
+
+func TestGuildPlayerShuffleQueue(t *testing.T) {
+	queue := make([]string, 20)
+	for i := range queue {
+		queue[i] = string(rune('a' + i))
+	}
+
+	t.Run("keeps the songs", func(t *testing.T) {
+		state := newQueuedState(t, queue...)
+		player, _ := newTestPlayer(t, state, &fakeAudio{}, nil)
+
+		if err := player.ShuffleQueue(); err != nil {
+			t.Fatalf("ShuffleQueue() error = %v", err)
+		}
+
+		got := queueURLs(t, state)
+		slices.Sort(got)
+		if !slices.Equal(got, queue) {
+			t.Errorf("shuffled queue = %q, want the songs %q", got, queue)
+		}
+	})
+
+	t.Run("empty queue", func(t *testing.T) {
+		player, _ := newTestPlayer(t, nil, &fakeAudio{}, nil)
+
+		if err := player.ShuffleQueue(); err != nil {
+			t.Fatalf("ShuffleQueue() error = %v", err)
+		}
+	})
+
+	t.Run("failed transaction", func(t *testing.T) {
+		state := newQueuedState(t, queue...)
+		player, _ := newTestPlayer(t, failingState{state}, &fakeAudio{}, nil)
+
+		if err := player.ShuffleQueue(); !errors.Is(err, errTransactionFailed) {
+			t.Fatalf("ShuffleQueue() error = %v, want %v", err, errTransactionFailed)
+		}
+
+		if got := queueURLs(t, state); !slices.Equal(got, queue) {
+			t.Errorf("queue = %q, want %q", got, queue)
+		}
+	})
+}
+
+func TestGuildPlayerRunRequeuesCurrentSong(t *testing.T) {
+	current := func() *bot.PlayedSong {
+		song := testSong("a")
+		song.StartPosition = 10 * time.Second
+		return &bot.PlayedSong{Song: *song, Position: 30 * time.Second}
+	}
+
+	t.Run("resumes the current song", func(t *testing.T) {
+		state := newQueuedState(t, "b")
+		if err := state.SetCurrentSong(current()); err != nil {
+			t.Fatal(err)
+		}
+
+		audio := &fakeAudio{}
+		player, session := newTestPlayer(t, state, audio, nil)
+		runPlayer(t, player)
+
+		select {
+		case <-session.left:
+		case <-time.After(10 * time.Second):
+			t.Fatal("the player did not finish playing")
+		}
+
+		played := audio.RequestedSongs()
+		if len(played) != 2 || played[0].URL != "a" || played[1].URL != "b" {
+			t.Fatalf("played songs = %q, want [a b]", audio.Requested())
+		}
+		if played[0].StartPosition != 40*time.Second {
+			t.Errorf("resumed song start = %s, want 40s", played[0].StartPosition)
+		}
+	})
+
+	t.Run("failed transaction", func(t *testing.T) {
+		state := store.NewInmemoryGuildPlayerState()
+		if err := state.SetCurrentSong(current()); err != nil {
+			t.Fatal(err)
+		}
+
+		player, _ := newTestPlayer(t, failingState{state}, &fakeAudio{}, nil)
+
+		// the queue stays empty, so Run returns without playing
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := player.Run(ctx); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+
+		if got := queueURLs(t, state); len(got) != 0 {
+			t.Errorf("queue = %q, want it empty", got)
+		}
+
+		song, err := state.GetCurrentSong()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if song == nil || song.URL != "a" || song.StartPosition != 10*time.Second || song.Position != 30*time.Second {
+			t.Errorf("current song = %+v, want it unchanged", song)
+		}
+	})
+}
+
+// fakeResolver resolves songs and records the resolved URLs. With block set,
+// it resolves nothing and waits until the context is canceled.
+type fakeResolver struct {
+	mutex    sync.Mutex
+	resolved []string
+	block    bool
+	onCall   func()
+}
+
+func (r *fakeResolver) Resolve(ctx context.Context, song *bot.Song) (*bot.Song, error) {
+	r.mutex.Lock()
+	r.resolved = append(r.resolved, song.URL)
+	onCall := r.onCall
+	r.mutex.Unlock()
+
+	if onCall != nil {
+		onCall()
+	}
+	if r.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	resolved := *song
+	resolved.Partial = false
+	resolved.Title = "resolved " + song.URL
+	return &resolved, nil
+}
+
+func (r *fakeResolver) Resolved() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return slices.Clone(r.resolved)
+}
+
+func newPartialState(t *testing.T, urls ...string) (*store.InmemoryPlaylistStorage, []*bot.Song) {
+	t.Helper()
+
+	state := store.NewInmemoryGuildPlayerState()
+	songs := make([]*bot.Song, len(urls))
+	for i, url := range urls {
+		songs[i] = &bot.Song{URL: url, Playable: true, Partial: true}
+	}
+	if err := state.AppendSongs(songs); err != nil {
+		t.Fatal(err)
+	}
+	return state, songs
+}
+
+func TestGuildPlayerResolveSongs(t *testing.T) {
+	t.Run("skips songs, which are not queued", func(t *testing.T) {
+		state, songs := newPartialState(t, "a", "b", "c")
+		// b was played or removed, before it was resolved
+		if _, err := state.RemoveSong(2); err != nil {
+			t.Fatal(err)
+		}
+
+		resolver := &fakeResolver{}
+		player, _ := newTestPlayer(t, state, &fakeAudio{}, nil)
+		player.WithSongResolver(resolver.Resolve)
+
+		var last bot.ResolveProgress
+		if err := player.ResolveSongs(context.Background(), songs, func(p bot.ResolveProgress) { last = p }); err != nil {
+			t.Fatalf("ResolveSongs() error = %v", err)
+		}
+
+		if got := resolver.Resolved(); !slices.Equal(got, []string{"a", "c"}) {
+			t.Errorf("resolved songs = %q, want [a c]", got)
+		}
+		if !last.Done() || last.Resolved != 2 || last.Skipped != 1 {
+			t.Errorf("last progress = %+v, want 2 resolved and 1 skipped", last)
+		}
+
+		queue, _ := state.GetSongs()
+		for _, song := range queue {
+			if song.Partial {
+				t.Errorf("song %s is still partial", song.URL)
+			}
+		}
+	})
+
+	t.Run("stops when no songs are queued", func(t *testing.T) {
+		state, songs := newPartialState(t, "a", "b", "c")
+
+		resolver := &fakeResolver{onCall: func() {
+			if err := state.ClearPlaylist(); err != nil {
+				t.Error(err)
+			}
+		}}
+		player, _ := newTestPlayer(t, state, &fakeAudio{}, nil)
+		player.WithSongResolver(resolver.Resolve)
+
+		var last bot.ResolveProgress
+		if err := player.ResolveSongs(context.Background(), songs, func(p bot.ResolveProgress) { last = p }); err != nil {
+			t.Fatalf("ResolveSongs() error = %v", err)
+		}
+
+		if got := resolver.Resolved(); !slices.Equal(got, []string{"a"}) {
+			t.Errorf("resolved songs = %q, want [a]", got)
+		}
+		if !last.Done() || last.Skipped != 2 {
+			t.Errorf("last progress = %+v, want 2 skipped", last)
+		}
+	})
+
+	t.Run("canceled by stop", func(t *testing.T) {
+		state, songs := newPartialState(t, "a", "b")
+
+		resolver := &fakeResolver{block: true}
+		player, _ := newTestPlayer(t, state, &fakeAudio{}, nil)
+		player.WithSongResolver(resolver.Resolve)
+
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- player.ResolveSongs(context.Background(), songs, func(bot.ResolveProgress) {})
+		}()
+
+		for len(resolver.Resolved()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		if err := player.Stop(); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case err := <-errCh:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("ResolveSongs() error = %v, want %v", err, context.Canceled)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("ResolveSongs() did not stop")
+		}
+
+		// songs added after the stop are resolved again
+		player.WithSongResolver((&fakeResolver{}).Resolve)
+		song := &bot.Song{URL: "c", Playable: true, Partial: true}
+		if err := state.AppendSong(song); err != nil {
+			t.Fatal(err)
+		}
+		if err := player.ResolveSongs(context.Background(), []*bot.Song{song}, func(bot.ResolveProgress) {}); err != nil {
+			t.Errorf("ResolveSongs() after Stop() error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// resolveBatchSize is the number of resolved songs written to the state at
+// once, so huge playlists do not rewrite the whole queue for every song.
+const resolveBatchSize = 10
+
+// ResolveProgress reports the progress of ResolveSongs.
+type ResolveProgress struct {
+	Resolved int
+	Total    int
+	// Dropped are the songs, which could not be resolved and were removed
+	// from the queue.
+	Dropped []*Song
+	// Skipped is the number of songs, which were played or removed from the
+	// queue before they were resolved.
+	Skipped int
+}
+
+func (p ResolveProgress) Done() bool {
+	return p.Resolved+len(p.Dropped)+p.Skipped >= p.Total
+}
+
+type resolution struct {
+	song     *Song
+	resolved *Song
+}
+
+// ResolveSongs resolves the partial songs of a playlist added to the queue in
+// the background, replacing them in the queue with the full metadata. Songs
+// played in the meantime are resolved by the player itself and skipped here.
+// It stops, when none of the songs are queued anymore or the player is
+// stopped.
+func (p *GuildPlayer) ResolveSongs(ctx context.Context, songs []*Song, progress func(ResolveProgress)) error {
+	if p.songResolver == nil {
+		return errors.New("song resolver is not configured")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	defer context.AfterFunc(p.resolveContext(), cancel)()
+
+	partial := make([]*Song, 0, len(songs))
+	for _, song := range songs {
+		if song.Partial {
+			partial = append(partial, song)
+		}
+	}
+
+	status := ResolveProgress{Total: len(partial)}
+	batch := make([]resolution, 0, resolveBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := UpdateState(p.state, func(tx GuildPlayerState) error {
+			queue, err := tx.GetSongs()
+			if err != nil {
+				return err
+			}
+
+			for _, r := range batch {
+				queue = replaceQueuedSong(queue, r.song, r.resolved)
+			}
+
+			return tx.ReplaceQueue(queue)
+		}); err != nil {
+			return fmt.Errorf("while updating queue: %w", err)
+		}
+
+		batch = batch[:0]
+		progress(status)
+		return nil
+	}
+
+	for i, song := range partial {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		queue, err := p.state.GetSongs()
+		if err != nil {
+			return fmt.Errorf("while getting songs: %w", err)
+		}
+
+		queued := queuedPartialSongs(queue)
+		if !anyQueued(queued, partial[i:]) {
+			p.logger.Debug("resolved songs are not queued anymore", zap.Int("remaining", len(partial)-i))
+			status.Skipped += len(partial) - i
+			break
+		}
+
+		if !queued[partialSongKey(song)] {
+			status.Skipped++
+			continue
+		}
+
+		resolved, err := p.resolveSong(ctx, song)
+		if err != nil {
+			p.logger.Info("failed to resolve song", zap.Error(err), zap.String("url", song.URL))
+			status.Dropped = append(status.Dropped, song)
+		} else {
+			status.Resolved++
+		}
+
+		batch = append(batch, resolution{song: song, resolved: resolved})
+		if len(batch) == resolveBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	// the last progress is reported, even when no songs were resolved since
+	// the last flush
+	if len(partial) == 0 || status.Skipped > 0 {
+		progress(status)
+	}
+
+	return nil
+}
+
+// resolveContext returns the context of the background resolving, which is
+// canceled by cancelResolving.
+func (p *GuildPlayer) resolveContext() context.Context {
+	p.resolveMutex.Lock()
+	defer p.resolveMutex.Unlock()
+
+	if p.resolveCtx == nil {
+		p.resolveCtx, p.resolveCancel = context.WithCancel(p.ctx)
+	}
+
+	return p.resolveCtx
+}
+
+// cancelResolving stops resolving the songs in the background, e.g. when the
+// queue is cleared.
+func (p *GuildPlayer) cancelResolving() {
+	p.resolveMutex.Lock()
+	defer p.resolveMutex.Unlock()
+
+	if p.resolveCancel != nil {
+		p.resolveCancel()
+		p.resolveCtx, p.resolveCancel = nil, nil
+	}
+}
+
+// queuedPartialSongs returns the keys of the partial songs in the queue.
+func queuedPartialSongs(queue []*Song) map[string]bool {
+	queued := make(map[string]bool)
+	for _, song := range queue {
+		if song.Partial {
+			queued[partialSongKey(song)] = true
+		}
+	}
+
+	return queued
+}
+
+func anyQueued(queued map[string]bool, songs []*Song) bool {
+	for _, song := range songs {
+		if queued[partialSongKey(song)] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// partialSongKey identifies a partial song in the queue, like
+// replaceQueuedSong does.
+func partialSongKey(song *Song) string {
+	requestedBy := ""
+	if song.RequestedBy != nil {
+		requestedBy = "\x00" + *song.RequestedBy
+	}
+
+	return song.URL + requestedBy
+}
+
+func (p *GuildPlayer) resolveSong(ctx context.Context, song *Song) (*Song, error) {
+	if p.songResolver == nil {
+		return song, nil
+	}
+
+	resolved, err := p.songResolver(ctx, song)
+	if err != nil {
+		return nil, fmt.Errorf("while resolving song: %w", err)
+	}
+
+	resolved.RequestedBy = song.RequestedBy
+	resolved.StartPosition = song.StartPosition
+
+	return resolved, nil
+}
+
+// replaceQueuedSong replaces the first partial queue entry of the song with
+// the resolved one or removes it, if resolved is nil.
+func replaceQueuedSong(queue []*Song, song, resolved *Song) []*Song {
+	for i, queued := range queue {
+		if !queued.Partial || queued.URL != song.URL || !sameRequester(queued, song) {
+			continue
+		}
+
+		if resolved == nil {
+			return append(queue[:i], queue[i+1:]...)
+		}
+
+		queue[i] = resolved
+		return queue
+	}
+
+	return queue
+}
+
+func sameRequester(a, b *Song) bool {
+	if a.RequestedBy == nil || b.RequestedBy == nil {
+		return a.RequestedBy == b.RequestedBy
+	}
+
+	return *a.RequestedBy == *b.RequestedBy
+}
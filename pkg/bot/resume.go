@@ -0,0 +1,133 @@
+package bot
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// streamEndTolerance is how much shorter than the song duration the
+	// stream may be, to still be considered complete.
+	streamEndTolerance = 2 * time.Second
+
+	maxStreamRetries = 3
+	// streamRetryResetProgress is the playback after which a stream counts as
+	// recovered and the retries start from zero again.
+	streamRetryResetProgress = 30 * time.Second
+)
+
+// the retry backoff is shortened by the tests
+var (
+	streamRetryBackoff    = time.Second
+	maxStreamRetryBackoff = 10 * time.Second
+)
+
+// getResumingAudio returns the audio of the song. When the stream fails or
+// ends before the song does, it is restarted from the last sent frame. When
+// the error is permanent or the retries are exhausted, the audio ends with
+// the error. Songs with an EndPosition are stopped there.
+func (p *GuildPlayer) getResumingAudio(ctx context.Context, song *Song) (*AudioStream, error) {
+	// live streams and songs of unknown duration cannot be resumed
+	if song.Live || song.Duration <= 0 {
+		return p.songAudioGetter(ctx, song)
+	}
+
+	// the source is stopped, when the end position is reached
+	sourceCtx, cancelSource := context.WithCancel(ctx)
+
+	source, err := p.songAudioGetter(sourceCtx, song)
+	if err != nil {
+		cancelSource()
+		return nil, err
+	}
+
+	stream := NewAudioStream()
+
+	go func() {
+		defer cancelSource()
+
+		logger := p.logger.With(zap.String("title", song.Title), zap.String("url", song.URL))
+		end := song.end()
+
+		position := song.StartPosition
+		retries := 0
+		retryPosition := position
+
+		for {
+			for frame := range source.Frames() {
+				if position >= end {
+					cancelSource()
+					for range source.Frames() {
+					}
+					stream.Close(nil)
+					return
+				}
+
+				if !stream.Send(ctx, frame) {
+					// drain the source, so it can finish
+					for range source.Frames() {
+					}
+					stream.Close(nil)
+					return
+				}
+				position += frameDuration
+			}
+
+			err := source.Err()
+			stream.SetDiagnostics(source.Diagnostics())
+
+			if ctx.Err() != nil || err == nil && position >= end-streamEndTolerance {
+				stream.Close(nil)
+				return
+			}
+			if err == nil {
+				err = ErrIncompleteAudio
+			}
+
+			if IsPermanentAudioError(err) {
+				stream.Close(err)
+				return
+			}
+
+			if position-retryPosition >= streamRetryResetProgress {
+				retries = 0
+			}
+			retryPosition = position
+
+			if retries == maxStreamRetries {
+				logger.Info("stream failed, giving up", zap.Error(err), zap.Duration("position", position))
+				stream.Close(err)
+				return
+			}
+
+			backoff := streamRetryBackoff << retries
+			if backoff > maxStreamRetryBackoff {
+				backoff = maxStreamRetryBackoff
+			}
+			retries++
+
+			logger.Info("stream failed, resuming it", zap.Error(err), zap.Duration("position", position), zap.Int("retry", retries), zap.Duration("backoff", backoff))
+
+			select {
+			case <-ctx.Done():
+				stream.Close(nil)
+				return
+			case <-time.After(backoff):
+			}
+
+			resumed := *song
+			resumed.StartPosition = position
+
+			source, err = p.songAudioGetter(sourceCtx, &resumed)
+			if err != nil {
+				// the next attempt is made after reading the failed stream
+				source = NewAudioStream()
+				source.Close(err)
+			}
+		}
+	}()
+
+	return stream, nil
+}
@@ -0,0 +1,176 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// scriptedAttempt is the audio returned by one call of scriptedAudio.
+type scriptedAttempt struct {
+	frames int
+	err    error
+}
+
+// scriptedAudio returns the attempts in order, repeating the last one, and
+// records the start positions, the songs were requested with.
+type scriptedAudio struct {
+	mutex    sync.Mutex
+	attempts []scriptedAttempt
+	starts   []time.Duration
+}
+
+func (a *scriptedAudio) GetAudio(ctx context.Context, song *Song) (*AudioStream, error) {
+	a.mutex.Lock()
+	attempt := a.attempts[min(len(a.starts), len(a.attempts)-1)]
+	a.starts = append(a.starts, song.StartPosition)
+	a.mutex.Unlock()
+
+	stream := NewAudioStream()
+	go func() {
+		for i := 0; i < attempt.frames; i++ {
+			if !stream.Send(ctx, []byte{0xfc}) {
+				stream.Close(nil)
+				return
+			}
+		}
+		stream.Close(attempt.err)
+	}()
+
+	return stream, nil
+}
+
+func (a *scriptedAudio) Starts() []time.Duration {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return slices.Clone(a.starts)
+}
+
+func TestGetResumingAudio(t *testing.T) {
+	backoff := streamRetryBackoff
+	streamRetryBackoff = time.Millisecond
+	t.Cleanup(func() { streamRetryBackoff = backoff })
+
+	tests := []struct {
+		name       string
+		song       Song
+		attempts   []scriptedAttempt
+		wantStarts []time.Duration
+		wantFrames int
+		wantErr    error
+	}{
+		{
+			name:       "complete",
+			song:       Song{Duration: 10 * time.Second},
+			attempts:   []scriptedAttempt{{frames: 500}},
+			wantStarts: []time.Duration{0},
+			wantFrames: 500,
+		},
+		{
+			name:       "ended early",
+			song:       Song{Duration: 10 * time.Second},
+			attempts:   []scriptedAttempt{{frames: 100}, {frames: 400}},
+			wantStarts: []time.Duration{0, 2 * time.Second},
+			wantFrames: 500,
+		},
+		{
+			name:       "network error",
+			song:       Song{Duration: 10 * time.Second},
+			attempts:   []scriptedAttempt{{frames: 50, err: ErrNetwork}, {frames: 450}},
+			wantStarts: []time.Duration{0, time.Second},
+			wantFrames: 500,
+		},
+		{
+			name:       "started in the middle",
+			song:       Song{Duration: 10 * time.Second, StartPosition: 5 * time.Second},
+			attempts:   []scriptedAttempt{{frames: 100}, {frames: 150}},
+			wantStarts: []time.Duration{5 * time.Second, 7 * time.Second},
+			wantFrames: 250,
+		},
+		{
+			name:       "within the end tolerance",
+			song:       Song{Duration: 10 * time.Second},
+			attempts:   []scriptedAttempt{{frames: 450}},
+			wantStarts: []time.Duration{0},
+			wantFrames: 450,
+		},
+		{
+			name:       "retries exhausted",
+			song:       Song{Duration: 10 * time.Second},
+			attempts:   []scriptedAttempt{{frames: 10}},
+			wantStarts: []time.Duration{0, 200 * time.Millisecond, 400 * time.Millisecond, 600 * time.Millisecond},
+			wantFrames: 40,
+			wantErr:    ErrIncompleteAudio,
+		},
+		{
+			name: "retries reset after progress",
+			song: Song{Duration: time.Minute},
+			attempts: []scriptedAttempt{
+				{frames: 10}, {frames: 10}, {frames: 10},
+				// more than streamRetryResetProgress
+				{frames: 1600},
+				{frames: 10}, {frames: 10}, {frames: 1350},
+			},
+			wantStarts: []time.Duration{
+				0, 200 * time.Millisecond, 400 * time.Millisecond, 600 * time.Millisecond,
+				32600 * time.Millisecond, 32800 * time.Millisecond, 33 * time.Second,
+			},
+			wantFrames: 3000,
+		},
+		{
+			name:       "permanent error",
+			song:       Song{Duration: 10 * time.Second},
+			attempts:   []scriptedAttempt{{frames: 10, err: ErrGeoBlocked}},
+			wantStarts: []time.Duration{0},
+			wantFrames: 10,
+			wantErr:    ErrGeoBlocked,
+		},
+		{
+			name:       "end position",
+			song:       Song{Duration: 10 * time.Second, EndPosition: time.Second},
+			attempts:   []scriptedAttempt{{frames: 500}},
+			wantStarts: []time.Duration{0},
+			wantFrames: 50,
+		},
+		{
+			name:       "unknown duration",
+			song:       Song{},
+			attempts:   []scriptedAttempt{{frames: 10}},
+			wantStarts: []time.Duration{0},
+			wantFrames: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audio := &scriptedAudio{attempts: tt.attempts}
+			player := &GuildPlayer{logger: zap.NewNop(), songAudioGetter: audio.GetAudio}
+
+			stream, err := player.getResumingAudio(context.Background(), &tt.song)
+			if err != nil {
+				t.Fatalf("getResumingAudio() error = %v", err)
+			}
+
+			frames := 0
+			for range stream.Frames() {
+				frames++
+			}
+
+			if frames != tt.wantFrames {
+				t.Errorf("frames = %d, want %d", frames, tt.wantFrames)
+			}
+			if err := stream.Err(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("stream error = %v, want %v", err, tt.wantErr)
+			}
+			if got := audio.Starts(); !slices.Equal(got, tt.wantStarts) {
+				t.Errorf("start positions = %v, want %v", got, tt.wantStarts)
+			}
+		})
+	}
+}
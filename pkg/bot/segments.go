@@ -0,0 +1,141 @@
+package bot
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Segment is a part of a song, which is skipped, e.g. a sponsor message or a
+// long intro of a music video.
+type Segment struct {
+	Start time.Duration
+	End   time.Duration
+	// Category tells, why the segment is skipped, e.g. `sponsor`.
+	Category string
+}
+
+// SegmentProvider returns the segments of the song, which are skipped.
+type SegmentProvider func(ctx context.Context, song *Song) ([]Segment, error)
+
+// normalizeSegments sorts the segments and merges the overlapping ones.
+func normalizeSegments(segments []Segment) []Segment {
+	sorted := make([]Segment, 0, len(segments))
+	for _, segment := range segments {
+		if segment.End-segment.Start >= frameDuration {
+			sorted = append(sorted, segment)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	merged := make([]Segment, 0, len(sorted))
+	for _, segment := range sorted {
+		if last := len(merged) - 1; last >= 0 && segment.Start <= merged[last].End {
+			merged[last].End = max(merged[last].End, segment.End)
+			continue
+		}
+		merged = append(merged, segment)
+	}
+
+	return merged
+}
+
+// segmentSkipper drops the frames of the skipped segments from a stream. As
+// the played audio is shorter than the song then, it maps the played
+// duration to the position in the song.
+type segmentSkipper struct {
+	mutex   sync.Mutex
+	skipped []skippedSegment
+}
+
+type skippedSegment struct {
+	// playedAt is the played duration, when the segment was skipped.
+	playedAt time.Duration
+	length   time.Duration
+}
+
+// skipSegments returns the stream of the source without the segments. The
+// source starts at the start position of the song.
+func skipSegments(ctx context.Context, source *AudioStream, startPosition time.Duration, segments []Segment) (*AudioStream, *segmentSkipper) {
+	skipper := &segmentSkipper{}
+	segments = normalizeSegments(segments)
+
+	if len(segments) == 0 {
+		return source, skipper
+	}
+
+	stream := NewAudioStream()
+
+	go func() {
+		position := startPosition
+		played := time.Duration(0)
+		skipping := false
+
+		for frame := range source.Frames() {
+			if inSegment(segments, position) {
+				skipper.skip(played, !skipping)
+				skipping = true
+				position += frameDuration
+				continue
+			}
+			skipping = false
+
+			if !stream.Send(ctx, frame) {
+				// drain the source, so it can finish
+				for range source.Frames() {
+				}
+				stream.Close(nil)
+				return
+			}
+
+			position += frameDuration
+			played += frameDuration
+		}
+
+		stream.SetDiagnostics(source.Diagnostics())
+		stream.Close(source.Err())
+	}()
+
+	return stream, skipper
+}
+
+func inSegment(segments []Segment, position time.Duration) bool {
+	for _, segment := range segments {
+		if position >= segment.Start && position < segment.End {
+			return true
+		}
+	}
+
+	return false
+}
+
+// skip records a skipped frame. A new segment is started, if the previous
+// frame was played.
+func (s *segmentSkipper) skip(playedAt time.Duration, newSegment bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if newSegment || len(s.skipped) == 0 {
+		s.skipped = append(s.skipped, skippedSegment{playedAt: playedAt})
+	}
+	s.skipped[len(s.skipped)-1].length += frameDuration
+}
+
+// position returns the position in the song, relative to its start
+// position, after the duration was played.
+func (s *segmentSkipper) position(played time.Duration) time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	position := played
+	for _, skipped := range s.skipped {
+		if skipped.playedAt <= played {
+			position += skipped.length
+		}
+	}
+
+	return position
+}
@@ -0,0 +1,193 @@
+package bot
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		segments []Segment
+		want     []Segment
+	}{
+		{
+			name: "no segments",
+			want: []Segment{},
+		},
+		{
+			name: "sorted",
+			segments: []Segment{
+				{Start: 5 * time.Second, End: 6 * time.Second, Category: "outro"},
+				{Start: time.Second, End: 2 * time.Second, Category: "intro"},
+			},
+			want: []Segment{
+				{Start: time.Second, End: 2 * time.Second, Category: "intro"},
+				{Start: 5 * time.Second, End: 6 * time.Second, Category: "outro"},
+			},
+		},
+		{
+			name: "overlapping",
+			segments: []Segment{
+				{Start: time.Second, End: 3 * time.Second, Category: "sponsor"},
+				{Start: 2 * time.Second, End: 4 * time.Second, Category: "selfpromo"},
+			},
+			want: []Segment{
+				{Start: time.Second, End: 4 * time.Second, Category: "sponsor"},
+			},
+		},
+		{
+			name: "contained",
+			segments: []Segment{
+				{Start: time.Second, End: 5 * time.Second, Category: "sponsor"},
+				{Start: 2 * time.Second, End: 3 * time.Second, Category: "selfpromo"},
+			},
+			want: []Segment{
+				{Start: time.Second, End: 5 * time.Second, Category: "sponsor"},
+			},
+		},
+		{
+			name: "adjacent",
+			segments: []Segment{
+				{Start: 2 * time.Second, End: 3 * time.Second},
+				{Start: time.Second, End: 2 * time.Second},
+				{Start: 3 * time.Second, End: 4 * time.Second},
+			},
+			want: []Segment{
+				{Start: time.Second, End: 4 * time.Second},
+			},
+		},
+		{
+			name: "shorter than a frame",
+			segments: []Segment{
+				{Start: time.Second, End: time.Second + 10*time.Millisecond},
+				{Start: 3 * time.Second, End: 2 * time.Second},
+				{Start: 5 * time.Second, End: 6 * time.Second},
+			},
+			want: []Segment{
+				{Start: 5 * time.Second, End: 6 * time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeSegments(tt.segments); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeSegments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentSkipperPosition(t *testing.T) {
+	type position struct {
+		played time.Duration
+		want   time.Duration
+	}
+
+	tests := []struct {
+		name          string
+		startPosition time.Duration
+		// frames is the number of frames of the source
+		frames     int
+		segments   []Segment
+		wantFrames int
+		positions  []position
+	}{
+		{
+			name:       "no segments",
+			frames:     100,
+			wantFrames: 100,
+			positions: []position{
+				{played: 0, want: 0},
+				{played: time.Second, want: time.Second},
+			},
+		},
+		{
+			name:   "overlapping and adjacent",
+			frames: 100,
+			segments: []Segment{
+				{Start: 200 * time.Millisecond, End: 400 * time.Millisecond},
+				{Start: 300 * time.Millisecond, End: 600 * time.Millisecond},
+				{Start: 600 * time.Millisecond, End: 800 * time.Millisecond},
+			},
+			wantFrames: 70,
+			positions: []position{
+				{played: 100 * time.Millisecond, want: 100 * time.Millisecond},
+				{played: 200 * time.Millisecond, want: 800 * time.Millisecond},
+				{played: 500 * time.Millisecond, want: 1100 * time.Millisecond},
+			},
+		},
+		{
+			name:   "two segments",
+			frames: 100,
+			segments: []Segment{
+				{Start: 200 * time.Millisecond, End: 400 * time.Millisecond},
+				{Start: time.Second, End: 1200 * time.Millisecond},
+			},
+			wantFrames: 80,
+			positions: []position{
+				{played: 300 * time.Millisecond, want: 500 * time.Millisecond},
+				{played: 800 * time.Millisecond, want: 1200 * time.Millisecond},
+				{played: 900 * time.Millisecond, want: 1300 * time.Millisecond},
+			},
+		},
+		{
+			name:          "start inside a segment",
+			startPosition: time.Second,
+			frames:        50,
+			segments: []Segment{
+				{Start: 500 * time.Millisecond, End: 1200 * time.Millisecond},
+			},
+			wantFrames: 40,
+			positions: []position{
+				{played: 0, want: 200 * time.Millisecond},
+				{played: 100 * time.Millisecond, want: 300 * time.Millisecond},
+			},
+		},
+		{
+			name:   "segment at the end",
+			frames: 100,
+			segments: []Segment{
+				{Start: 1600 * time.Millisecond, End: 2 * time.Second},
+			},
+			wantFrames: 80,
+			positions: []position{
+				{played: time.Second, want: time.Second},
+				{played: 1600 * time.Millisecond, want: 2 * time.Second},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			source := NewAudioStream()
+			go func() {
+				for i := 0; i < tt.frames; i++ {
+					source.Send(ctx, []byte{0xfc})
+				}
+				source.Close(nil)
+			}()
+
+			stream, skipper := skipSegments(ctx, source, tt.startPosition, tt.segments)
+
+			frames := 0
+			for range stream.Frames() {
+				frames++
+			}
+			if frames != tt.wantFrames {
+				t.Errorf("frames = %d, want %d", frames, tt.wantFrames)
+			}
+
+			for _, p := range tt.positions {
+				if got := skipper.position(p.played); got != p.want {
+					t.Errorf("position(%s) = %s, want %s", p.played, got, p.want)
+				}
+			}
+		})
+	}
+}
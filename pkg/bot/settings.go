@@ -0,0 +1,324 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/locale"
+)
+
+var (
+	ErrUnknownSetting      = errors.New("unknown setting")
+	ErrInvalidSettingValue = errors.New("invalid setting value")
+)
+
+type GuildSettings struct {
+	// DefaultVolume is the volume of the played songs in percent.
+	DefaultVolume   int    `json:"default_volume"`
+	AnnounceChannel string `json:"announce_channel,omitempty"`
+	DJRole          string `json:"dj_role,omitempty"`
+	MaxQueueLength  int    `json:"max_queue_length"`
+	// IdleTimeout is how long the bot stays in the voice channel, waiting
+	// for new songs, after the queue ended.
+	IdleTimeout time.Duration `json:"idle_timeout"`
+	// Locale is the language of the messages sent by the bot.
+	Locale string `json:"locale,omitempty"`
+	// Autoplay queues a song related to the last played one, when the queue
+	// ended.
+	Autoplay bool `json:"autoplay"`
+	// SearchBackend and SearchFallback are yt-dlp search backends, like
+	// `ytsearch`. Empty values use the bot defaults, "none" disables the
+	// fallback.
+	SearchBackend  string `json:"search_backend,omitempty"`
+	SearchFallback string `json:"search_fallback,omitempty"`
+	// EncoderProfile is the name of the Opus encoder profile. EncoderBitrate
+	// is in kbps, zero matches the bitrate of the voice channel.
+	EncoderProfile string `json:"encoder_profile,omitempty"`
+	EncoderBitrate int    `json:"encoder_bitrate,omitempty"`
+	// FailurePolicy decides, if a failed song is retried before it is
+	// skipped. The playback stops after MaxConsecutiveFailures failed songs,
+	// zero never stops it.
+	FailurePolicy          string `json:"failure_policy,omitempty"`
+	MaxConsecutiveFailures int    `json:"max_consecutive_failures"`
+}
+
+func DefaultGuildSettings() *GuildSettings {
+	return &GuildSettings{
+		DefaultVolume:  DefaultVolume,
+		Locale:         locale.Default,
+		MaxQueueLength: 0,
+		IdleTimeout:    0,
+		EncoderProfile: DefaultEncoderProfile,
+
+		FailurePolicy:          FailurePolicySkip,
+		MaxConsecutiveFailures: 5,
+	}
+}
+
+type GuildSettingsStore interface {
+	GetSettings() (*GuildSettings, error)
+	SetSettings(*GuildSettings) error
+}
+
+// TransactionalGuildSettingsStore is implemented by stores, which can change
+// the settings atomically. If fn returns an error, the settings are not
+// changed.
+type TransactionalGuildSettingsStore interface {
+	UpdateSettings(fn func(s *GuildSettings) error) error
+}
+
+type settingDefinition struct {
+	get func(s *GuildSettings) string
+	set func(s *GuildSettings, value string) error
+}
+
+var settingDefinitions = map[string]settingDefinition{
+	"default_volume": {
+		get: func(s *GuildSettings) string { return strconv.Itoa(s.DefaultVolume) },
+		set: func(s *GuildSettings, value string) error {
+			v, err := parseIntInRange(strings.TrimSuffix(value, "%"), 1, 200)
+			if err != nil {
+				return err
+			}
+			s.DefaultVolume = v
+			return nil
+		},
+	},
+	"announce_channel": {
+		get: func(s *GuildSettings) string { return s.AnnounceChannel },
+		set: func(s *GuildSettings, value string) error {
+			v, err := parseSnowflake(value, "<#", ">")
+			if err != nil {
+				return err
+			}
+			s.AnnounceChannel = v
+			return nil
+		},
+	},
+	"dj_role": {
+		get: func(s *GuildSettings) string { return s.DJRole },
+		set: func(s *GuildSettings, value string) error {
+			v, err := parseSnowflake(value, "<@&", ">")
+			if err != nil {
+				return err
+			}
+			s.DJRole = v
+			return nil
+		},
+	},
+	"max_queue_length": {
+		get: func(s *GuildSettings) string { return strconv.Itoa(s.MaxQueueLength) },
+		set: func(s *GuildSettings, value string) error {
+			v, err := parseIntInRange(value, 0, 10000)
+			if err != nil {
+				return err
+			}
+			s.MaxQueueLength = v
+			return nil
+		},
+	},
+	"idle_timeout": {
+		get: func(s *GuildSettings) string { return s.IdleTimeout.String() },
+		set: func(s *GuildSettings, value string) error {
+			v, err := time.ParseDuration(value)
+			if err != nil || v < 0 || v > time.Hour {
+				return fmt.Errorf("%w: expected a duration between 0s and 1h", ErrInvalidSettingValue)
+			}
+			s.IdleTimeout = v
+			return nil
+		},
+	},
+	"autoplay": {
+		get: func(s *GuildSettings) string { return strconv.FormatBool(s.Autoplay) },
+		set: func(s *GuildSettings, value string) error {
+			v, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%w: expected true or false", ErrInvalidSettingValue)
+			}
+			s.Autoplay = v
+			return nil
+		},
+	},
+	"locale": {
+		get: func(s *GuildSettings) string {
+			if s.Locale == "" {
+				return locale.Default
+			}
+			return s.Locale
+		},
+		set: func(s *GuildSettings, value string) error {
+			for _, tag := range locale.Tags() {
+				if strings.EqualFold(value, tag) {
+					s.Locale = tag
+					return nil
+				}
+			}
+			return fmt.Errorf("%w: expected one of %s", ErrInvalidSettingValue, strings.Join(locale.Tags(), ", "))
+		},
+	},
+	"search_backend": {
+		get: func(s *GuildSettings) string { return s.SearchBackend },
+		set: func(s *GuildSettings, value string) error {
+			if value == "none" {
+				return fmt.Errorf("%w: a search backend is required", ErrInvalidSettingValue)
+			}
+			v, err := parseSearchBackend(value)
+			if err != nil {
+				return err
+			}
+			s.SearchBackend = v
+			return nil
+		},
+	},
+	"search_fallback": {
+		get: func(s *GuildSettings) string { return s.SearchFallback },
+		set: func(s *GuildSettings, value string) error {
+			v, err := parseSearchBackend(value)
+			if err != nil {
+				return err
+			}
+			s.SearchFallback = v
+			return nil
+		},
+	},
+	"encoder_profile": {
+		get: func(s *GuildSettings) string {
+			if s.EncoderProfile == "" {
+				return DefaultEncoderProfile
+			}
+			return s.EncoderProfile
+		},
+		set: func(s *GuildSettings, value string) error {
+			value = strings.ToLower(value)
+			if _, ok := encoderProfiles[value]; !ok {
+				return fmt.Errorf("%w: expected one of %s", ErrInvalidSettingValue, strings.Join(EncoderProfileNames(), ", "))
+			}
+			s.EncoderProfile = value
+			return nil
+		},
+	},
+	"encoder_bitrate": {
+		get: func(s *GuildSettings) string { return strconv.Itoa(s.EncoderBitrate) },
+		set: func(s *GuildSettings, value string) error {
+			v, err := parseIntInRange(value, 0, 510)
+			if err != nil {
+				return err
+			}
+			if v > 0 && v < 6 {
+				return fmt.Errorf("%w: expected 0 for the channel bitrate or a bitrate between 6 and 510 kbps", ErrInvalidSettingValue)
+			}
+			s.EncoderBitrate = v
+			return nil
+		},
+	},
+	"failure_policy": {
+		get: func(s *GuildSettings) string {
+			if s.FailurePolicy == "" {
+				return FailurePolicySkip
+			}
+			return s.FailurePolicy
+		},
+		set: func(s *GuildSettings, value string) error {
+			value = strings.ToLower(value)
+			if value != FailurePolicySkip && value != FailurePolicyRetry {
+				return fmt.Errorf("%w: expected %s or %s", ErrInvalidSettingValue, FailurePolicySkip, FailurePolicyRetry)
+			}
+			s.FailurePolicy = value
+			return nil
+		},
+	},
+	"max_consecutive_failures": {
+		get: func(s *GuildSettings) string { return strconv.Itoa(s.MaxConsecutiveFailures) },
+		set: func(s *GuildSettings, value string) error {
+			v, err := parseIntInRange(value, 0, 100)
+			if err != nil {
+				return err
+			}
+			s.MaxConsecutiveFailures = v
+			return nil
+		},
+	},
+}
+
+var searchBackendPattern = regexp.MustCompile(`^[a-z0-9]+search$`)
+
+// SettingKeys returns the names of all guild settings in alphabetical order.
+func SettingKeys() []string {
+	keys := make([]string, 0, len(settingDefinitions))
+	for key := range settingDefinitions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *GuildSettings) Get(key string) (string, error) {
+	def, ok := settingDefinitions[key]
+	if !ok {
+		return "", ErrUnknownSetting
+	}
+
+	return def.get(s), nil
+}
+
+func (s *GuildSettings) Set(key, value string) error {
+	def, ok := settingDefinitions[key]
+	if !ok {
+		return ErrUnknownSetting
+	}
+
+	return def.set(s, strings.TrimSpace(value))
+}
+
+func (s *GuildSettings) Reset(key string) error {
+	def, ok := settingDefinitions[key]
+	if !ok {
+		return ErrUnknownSetting
+	}
+
+	return def.set(s, def.get(DefaultGuildSettings()))
+}
+
+func parseIntInRange(value string, min, max int) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil || v < min || v > max {
+		return 0, fmt.Errorf("%w: expected a number between %d and %d", ErrInvalidSettingValue, min, max)
+	}
+
+	return v, nil
+}
+
+// parseSnowflake accepts a raw Discord ID or a mention. An empty value or
+// "none" clears the setting.
+func parseSnowflake(value, mentionPrefix, mentionSuffix string) (string, error) {
+	if value == "" || strings.EqualFold(value, "none") {
+		return "", nil
+	}
+
+	value = strings.TrimSuffix(strings.TrimPrefix(value, mentionPrefix), mentionSuffix)
+	if _, err := strconv.ParseUint(value, 10, 64); err != nil {
+		return "", fmt.Errorf("%w: expected a mention or an ID", ErrInvalidSettingValue)
+	}
+
+	return value, nil
+}
+
+// parseSearchBackend accepts a yt-dlp search prefix with or without the
+// trailing colon, e.g. `scsearch:`. An empty value uses the bot default.
+func parseSearchBackend(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSuffix(value, ":"))
+	if value == "" || value == "none" {
+		return value, nil
+	}
+
+	if !searchBackendPattern.MatchString(value) {
+		return "", fmt.Errorf("%w: expected a yt-dlp search backend like ytsearch or scsearch", ErrInvalidSettingValue)
+	}
+
+	return value, nil
+}
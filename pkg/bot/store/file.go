@@ -1,7 +1,6 @@
 package store
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"sync"
@@ -9,11 +8,13 @@ import (
 	"github.com/Trojan295/discord-airplay/pkg/bot"
 )
 
+// fileState is the guild state kept in the file. It is serialized using the
+// versioned schema from schema.go.
 type fileState struct {
-	Songs        []*bot.Song     `json:"songs"`
-	CurrentSong  *bot.PlayedSong `json:"current_song"`
-	VoiceChannel string          `json:"voice_channel"`
-	TextChannel  string          `json:"text_channel"`
+	Songs        []*bot.Song
+	CurrentSong  *bot.PlayedSong
+	VoiceChannel string
+	TextChannel  string
 }
 
 type FilePlaylistStorage struct {
@@ -22,16 +23,24 @@ type FilePlaylistStorage struct {
 }
 
 func NewFilePlaylistStorage(filepath string) (*FilePlaylistStorage, error) {
+	s := &FilePlaylistStorage{
+		mutex:    sync.RWMutex{},
+		filepath: filepath,
+	}
+
 	if _, err := os.Stat(filepath); os.IsNotExist(err) {
-		if err := os.WriteFile(filepath, []byte("{}"), 0644); err != nil {
+		if err := s.writeState(&fileState{}); err != nil {
 			return nil, fmt.Errorf("failed to create file: %w", err)
 		}
+
+		return s, nil
 	}
 
-	return &FilePlaylistStorage{
-		mutex:    sync.RWMutex{},
-		filepath: filepath,
-	}, nil
+	if err := s.upgradeState(); err != nil {
+		return nil, fmt.Errorf("failed to upgrade state: %w", err)
+	}
+
+	return s, nil
 }
 
 func (s *FilePlaylistStorage) GetCurrentSong() (*bot.PlayedSong, error) {
@@ -160,6 +169,42 @@ func (s *FilePlaylistStorage) AppendSong(song *bot.Song) error {
 	return nil
 }
 
+func (s *FilePlaylistStorage) AppendSongs(songs []*bot.Song) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, err := s.readState()
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+
+	state.Songs = append(state.Songs, songs...)
+
+	if err := s.writeState(state); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FilePlaylistStorage) ReplaceQueue(songs []*bot.Song) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, err := s.readState()
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+
+	state.Songs = songs
+
+	if err := s.writeState(state); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+
+	return nil
+}
+
 func (s *FilePlaylistStorage) RemoveSong(position int) (*bot.Song, error) {
 	index := position - 1
 
@@ -241,22 +286,54 @@ func (s *FilePlaylistStorage) PopFirstSong() (*bot.Song, error) {
 	return song, nil
 }
 
+// Update applies the mutations done in fn to the file with a single write.
+func (s *FilePlaylistStorage) Update(fn func(tx bot.GuildPlayerState) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	state, err := s.readState()
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+
+	tx := NewInmemoryGuildPlayerState()
+	tx.songs = append(tx.songs, state.Songs...)
+	tx.currentSong = state.CurrentSong
+	tx.voiceChannel = state.VoiceChannel
+	tx.textChannel = state.TextChannel
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	state.Songs = tx.songs
+	state.CurrentSong = tx.currentSong
+	state.VoiceChannel = tx.voiceChannel
+	state.TextChannel = tx.textChannel
+
+	if err := s.writeState(state); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+
+	return nil
+}
+
 func (s *FilePlaylistStorage) readState() (*fileState, error) {
 	data, err := os.ReadFile(s.filepath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	var state fileState
-	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal songs: %w", err)
+	state, _, err := decodeState(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal state: %w", err)
 	}
 
-	return &state, nil
+	return state, nil
 }
 
 func (s *FilePlaylistStorage) writeState(state *fileState) error {
-	data, err := json.Marshal(state)
+	data, err := encodeState(state)
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
@@ -266,3 +343,30 @@ func (s *FilePlaylistStorage) writeState(state *fileState) error {
 	}
 	return nil
 }
+
+// upgradeState rewrites the file using the current schema version, if it was
+// written by an older version.
+func (s *FilePlaylistStorage) upgradeState() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := os.ReadFile(s.filepath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	state, upgraded, err := decodeState(data)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal state: %w", err)
+	}
+
+	if !upgraded {
+		return nil
+	}
+
+	if err := os.WriteFile(s.filepath+".bak", data, 0644); err != nil {
+		return fmt.Errorf("failed to back up file: %w", err)
+	}
+
+	return s.writeState(state)
+}
@@ -82,6 +82,22 @@ func (s *InmemoryPlaylistStorage) AppendSong(song *bot.Song) error {
 	return nil
 }
 
+func (s *InmemoryPlaylistStorage) AppendSongs(songs []*bot.Song) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.songs = append(s.songs, songs...)
+	return nil
+}
+
+func (s *InmemoryPlaylistStorage) ReplaceQueue(songs []*bot.Song) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.songs = make([]*bot.Song, len(songs))
+	copy(s.songs, songs)
+	return nil
+}
+
 func (s *InmemoryPlaylistStorage) RemoveSong(position int) (*bot.Song, error) {
 	index := position - 1
 
@@ -115,7 +131,7 @@ func (s *InmemoryPlaylistStorage) GetSongs() ([]*bot.Song, error) {
 	songs := make([]*bot.Song, len(s.songs))
 	copy(songs, s.songs)
 
-	return s.songs, nil
+	return songs, nil
 }
 
 func (s *InmemoryPlaylistStorage) PopFirstSong() (*bot.Song, error) {
@@ -131,3 +147,34 @@ func (s *InmemoryPlaylistStorage) PopFirstSong() (*bot.Song, error) {
 
 	return song, nil
 }
+
+func (s *InmemoryPlaylistStorage) Update(fn func(tx bot.GuildPlayerState) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	tx := s.clone()
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	s.songs = tx.songs
+	s.currentSong = tx.currentSong
+	s.textChannel = tx.textChannel
+	s.voiceChannel = tx.voiceChannel
+	return nil
+}
+
+// clone returns a copy of the storage, which does not share the lock or the
+// song slice with the original. The caller must hold the lock.
+func (s *InmemoryPlaylistStorage) clone() *InmemoryPlaylistStorage {
+	songs := make([]*bot.Song, len(s.songs))
+	copy(songs, s.songs)
+
+	return &InmemoryPlaylistStorage{
+		mutex:        sync.RWMutex{},
+		songs:        songs,
+		currentSong:  s.currentSong,
+		textChannel:  s.textChannel,
+		voiceChannel: s.voiceChannel,
+	}
+}
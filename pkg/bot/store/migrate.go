@@ -0,0 +1,223 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+var ErrUnsupportedBackend = errors.New("unsupported store backend")
+
+// Backend gives access to the player state of every guild kept in a store.
+type Backend interface {
+	ListGuilds() ([]string, error)
+	GuildPlayerState(guildID string) (bot.GuildPlayerState, error)
+}
+
+// SupportedBackends are the store specifications, which can be parsed by
+// ParseBackend. Other stores, like SQLite, are not supported.
+var SupportedBackends = []string{"file:<directory>", "memory:"}
+
+// ParseBackend parses a `<type>:<location>` store specification,
+// e.g. `file:./playlist`. The `memory:` store has no location.
+func ParseBackend(spec string) (Backend, error) {
+	storeType, location, _ := strings.Cut(spec, ":")
+
+	switch storeType {
+	case "file":
+		if location == "" {
+			return nil, fmt.Errorf("missing directory in %q", spec)
+		}
+		return &FileBackend{Dir: location}, nil
+	case "memory":
+		return NewMemoryBackend(), nil
+	default:
+		return nil, fmt.Errorf("%w %q, supported backends are %s", ErrUnsupportedBackend, storeType, strings.Join(SupportedBackends, " and "))
+	}
+}
+
+// SameBackend tells, if both backends keep their state in the same place,
+// e.g. the same directory given with different paths.
+func SameBackend(a, b Backend) (bool, error) {
+	fa, okA := a.(*FileBackend)
+	fb, okB := b.(*FileBackend)
+	if !okA || !okB {
+		return a == b, nil
+	}
+
+	dirA, err := filepath.Abs(fa.Dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	dirB, err := filepath.Abs(fb.Dir)
+	if err != nil {
+		return false, fmt.Errorf("failed to get absolute path: %w", err)
+	}
+	if dirA == dirB {
+		return true, nil
+	}
+
+	// symlinks and other paths to the same directory
+	infoA, errA := os.Stat(dirA)
+	infoB, errB := os.Stat(dirB)
+	if errA != nil || errB != nil {
+		return false, nil
+	}
+
+	return os.SameFile(infoA, infoB), nil
+}
+
+type FileBackend struct {
+	Dir string
+}
+
+func (b *FileBackend) ListGuilds() ([]string, error) {
+	entries, err := os.ReadDir(b.Dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	guilds := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+
+		guildID := strings.TrimSuffix(name, ".json")
+		if strings.Contains(guildID, ".") {
+			// other per-guild files, like settings
+			continue
+		}
+
+		guilds = append(guilds, guildID)
+	}
+
+	sort.Strings(guilds)
+	return guilds, nil
+}
+
+func (b *FileBackend) GuildPlayerState(guildID string) (bot.GuildPlayerState, error) {
+	if err := os.MkdirAll(b.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	return NewFilePlaylistStorage(filepath.Join(b.Dir, guildID+".json"))
+}
+
+// MemoryBackend keeps the state in memory. It is empty, when created, so it
+// is only useful as a destination to check a migration.
+type MemoryBackend struct {
+	mutex  sync.Mutex
+	states map[string]*InmemoryPlaylistStorage
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		states: make(map[string]*InmemoryPlaylistStorage),
+	}
+}
+
+func (b *MemoryBackend) ListGuilds() ([]string, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	guilds := make([]string, 0, len(b.states))
+	for guildID := range b.states {
+		guilds = append(guilds, guildID)
+	}
+
+	sort.Strings(guilds)
+	return guilds, nil
+}
+
+func (b *MemoryBackend) GuildPlayerState(guildID string) (bot.GuildPlayerState, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	state, ok := b.states[guildID]
+	if !ok {
+		state = NewInmemoryGuildPlayerState()
+		b.states[guildID] = state
+	}
+
+	return state, nil
+}
+
+// GuildSnapshot is the complete player state of a guild.
+type GuildSnapshot struct {
+	Songs        []*bot.Song
+	CurrentSong  *bot.PlayedSong
+	VoiceChannel string
+	TextChannel  string
+}
+
+func TakeSnapshot(state bot.GuildPlayerState) (*GuildSnapshot, error) {
+	songs, err := state.GetSongs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get songs: %w", err)
+	}
+
+	currentSong, err := state.GetCurrentSong()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current song: %w", err)
+	}
+
+	voiceChannel, err := state.GetVoiceChannel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get voice channel: %w", err)
+	}
+
+	textChannel, err := state.GetTextChannel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get text channel: %w", err)
+	}
+
+	if songs == nil {
+		songs = []*bot.Song{}
+	}
+
+	return &GuildSnapshot{
+		Songs:        songs,
+		CurrentSong:  currentSong,
+		VoiceChannel: voiceChannel,
+		TextChannel:  textChannel,
+	}, nil
+}
+
+// RestoreSnapshot replaces the state with the snapshot.
+func RestoreSnapshot(state bot.GuildPlayerState, snapshot *GuildSnapshot) error {
+	return bot.UpdateState(state, func(tx bot.GuildPlayerState) error {
+		if err := tx.ReplaceQueue(snapshot.Songs); err != nil {
+			return fmt.Errorf("failed to replace queue: %w", err)
+		}
+
+		if err := tx.SetCurrentSong(snapshot.CurrentSong); err != nil {
+			return fmt.Errorf("failed to set current song: %w", err)
+		}
+
+		if err := tx.SetVoiceChannel(snapshot.VoiceChannel); err != nil {
+			return fmt.Errorf("failed to set voice channel: %w", err)
+		}
+
+		if err := tx.SetTextChannel(snapshot.TextChannel); err != nil {
+			return fmt.Errorf("failed to set text channel: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (s *GuildSnapshot) Equal(other *GuildSnapshot) bool {
+	return reflect.DeepEqual(s, other)
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseBackend(t *testing.T) {
+	tests := []struct {
+		spec        string
+		wantDir     string
+		wantErr     bool
+		unsupported bool
+	}{
+		{spec: "file:./playlist", wantDir: "./playlist"},
+		{spec: "memory:"},
+		{spec: "file:", wantErr: true},
+		{spec: "sqlite:./airplay.db", wantErr: true, unsupported: true},
+		{spec: "./playlist", wantErr: true, unsupported: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseBackend(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.unsupported {
+				if !errors.Is(err, ErrUnsupportedBackend) {
+					t.Errorf("ParseBackend() error = %v, want %v", err, ErrUnsupportedBackend)
+				}
+				// the error tells, which stores can be used instead
+				for _, backend := range SupportedBackends {
+					if !strings.Contains(err.Error(), backend) {
+						t.Errorf("ParseBackend() error = %v, want it to list %s", err, backend)
+					}
+				}
+			}
+
+			if fb, ok := got.(*FileBackend); ok && fb.Dir != tt.wantDir {
+				t.Errorf("ParseBackend() dir = %s, want %s", fb.Dir, tt.wantDir)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+// currentSchemaVersion is the version of the persisted guild state written by
+// the file store. Bump it, when changing the schema types below, and register
+// an upgrade from the previous version in schemaUpgrades.
+const currentSchemaVersion = 1
+
+type schemaState struct {
+	Version      int               `json:"version"`
+	Songs        []*schemaSong     `json:"songs"`
+	CurrentSong  *schemaPlayedSong `json:"current_song"`
+	VoiceChannel string            `json:"voice_channel"`
+	TextChannel  string            `json:"text_channel"`
+}
+
+type schemaSong struct {
+	Type            string  `json:"type"`
+	Title           string  `json:"title"`
+	Artist          string  `json:"artist,omitempty"`
+	Album           string  `json:"album,omitempty"`
+	Uploader        string  `json:"uploader,omitempty"`
+	URL             string  `json:"url"`
+	Playable        bool    `json:"playable"`
+	ThumbnailURL    *string `json:"thumbnail_url,omitempty"`
+	DurationMs      int64   `json:"duration_ms"`
+	StartPositionMs int64   `json:"start_position_ms"`
+	EndPositionMs   int64   `json:"end_position_ms,omitempty"`
+	RequestedBy     *string `json:"requested_by,omitempty"`
+	Live            bool    `json:"live,omitempty"`
+	// UploadDate is formatted as YYYY-MM-DD.
+	UploadDate string          `json:"upload_date,omitempty"`
+	Chapters   []schemaChapter `json:"chapters,omitempty"`
+	Segments   []schemaSegment `json:"segments,omitempty"`
+	Partial    bool            `json:"partial,omitempty"`
+}
+
+type schemaChapter struct {
+	Title   string `json:"title"`
+	StartMs int64  `json:"start_ms"`
+	EndMs   int64  `json:"end_ms"`
+}
+
+type schemaSegment struct {
+	StartMs  int64  `json:"start_ms"`
+	EndMs    int64  `json:"end_ms"`
+	Category string `json:"category,omitempty"`
+}
+
+const schemaDateLayout = "2006-01-02"
+
+type schemaPlayedSong struct {
+	schemaSong
+	PositionMs int64 `json:"position_ms"`
+}
+
+// schemaUpgrade migrates a decoded document from version N to N+1 in place.
+type schemaUpgrade func(doc map[string]any) error
+
+// schemaUpgrades maps a version to the upgrade, which migrates a document
+// from that version to the next one.
+var schemaUpgrades = map[int]schemaUpgrade{
+	0: upgradeSchemaV0,
+}
+
+// decodeState parses persisted guild state of any known version. The returned
+// flag reports if the document had to be upgraded.
+func decodeState(data []byte) (*fileState, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	doc := map[string]any{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, false, fmt.Errorf("while decoding document: %w", err)
+	}
+
+	version, err := documentVersion(doc)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if version > currentSchemaVersion {
+		return nil, false, fmt.Errorf("unsupported state version %d, newest known is %d", version, currentSchemaVersion)
+	}
+
+	upgraded := version < currentSchemaVersion
+	for ; version < currentSchemaVersion; version++ {
+		upgrade, ok := schemaUpgrades[version]
+		if !ok {
+			return nil, false, fmt.Errorf("missing upgrade from state version %d", version)
+		}
+
+		if err := upgrade(doc); err != nil {
+			return nil, false, fmt.Errorf("while upgrading state from version %d: %w", version, err)
+		}
+		doc["version"] = version + 1
+	}
+
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return nil, false, fmt.Errorf("while encoding upgraded document: %w", err)
+	}
+
+	var state schemaState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, false, fmt.Errorf("while decoding state: %w", err)
+	}
+
+	return state.toFileState(), upgraded, nil
+}
+
+func encodeState(state *fileState) ([]byte, error) {
+	return json.Marshal(newSchemaState(state))
+}
+
+func documentVersion(doc map[string]any) (int, error) {
+	raw, ok := doc["version"]
+	if !ok {
+		return 0, nil
+	}
+
+	number, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("invalid state version %v", raw)
+	}
+
+	version, err := number.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("invalid state version %v", raw)
+	}
+
+	return int(version), nil
+}
+
+func newSchemaState(state *fileState) *schemaState {
+	s := &schemaState{
+		Version:      currentSchemaVersion,
+		Songs:        make([]*schemaSong, 0, len(state.Songs)),
+		VoiceChannel: state.VoiceChannel,
+		TextChannel:  state.TextChannel,
+	}
+
+	for _, song := range state.Songs {
+		s.Songs = append(s.Songs, newSchemaSong(song))
+	}
+
+	if state.CurrentSong != nil {
+		s.CurrentSong = &schemaPlayedSong{
+			schemaSong: *newSchemaSong(&state.CurrentSong.Song),
+			PositionMs: state.CurrentSong.Position.Milliseconds(),
+		}
+	}
+
+	return s
+}
+
+func (s *schemaState) toFileState() *fileState {
+	state := &fileState{
+		Songs:        make([]*bot.Song, 0, len(s.Songs)),
+		VoiceChannel: s.VoiceChannel,
+		TextChannel:  s.TextChannel,
+	}
+
+	for _, song := range s.Songs {
+		if song == nil {
+			continue
+		}
+		state.Songs = append(state.Songs, song.toSong())
+	}
+
+	if s.CurrentSong != nil {
+		state.CurrentSong = &bot.PlayedSong{
+			Song:     *s.CurrentSong.toSong(),
+			Position: time.Duration(s.CurrentSong.PositionMs) * time.Millisecond,
+		}
+	}
+
+	return state
+}
+
+func newSchemaSong(song *bot.Song) *schemaSong {
+	s := &schemaSong{
+		Type:            song.Type,
+		Title:           song.Title,
+		Artist:          song.Artist,
+		Album:           song.Album,
+		Uploader:        song.Uploader,
+		URL:             song.URL,
+		Playable:        song.Playable,
+		ThumbnailURL:    song.ThumbnailURL,
+		DurationMs:      song.Duration.Milliseconds(),
+		StartPositionMs: song.StartPosition.Milliseconds(),
+		EndPositionMs:   song.EndPosition.Milliseconds(),
+		RequestedBy:     song.RequestedBy,
+		Live:            song.Live,
+		Partial:         song.Partial,
+	}
+
+	if !song.UploadDate.IsZero() {
+		s.UploadDate = song.UploadDate.Format(schemaDateLayout)
+	}
+
+	for _, chapter := range song.Chapters {
+		s.Chapters = append(s.Chapters, schemaChapter{
+			Title:   chapter.Title,
+			StartMs: chapter.Start.Milliseconds(),
+			EndMs:   chapter.End.Milliseconds(),
+		})
+	}
+
+	for _, segment := range song.Segments {
+		s.Segments = append(s.Segments, schemaSegment{
+			StartMs:  segment.Start.Milliseconds(),
+			EndMs:    segment.End.Milliseconds(),
+			Category: segment.Category,
+		})
+	}
+
+	return s
+}
+
+func (s *schemaSong) toSong() *bot.Song {
+	song := &bot.Song{
+		Type:          s.Type,
+		Title:         s.Title,
+		Artist:        s.Artist,
+		Album:         s.Album,
+		Uploader:      s.Uploader,
+		URL:           s.URL,
+		Playable:      s.Playable,
+		ThumbnailURL:  s.ThumbnailURL,
+		Duration:      time.Duration(s.DurationMs) * time.Millisecond,
+		StartPosition: time.Duration(s.StartPositionMs) * time.Millisecond,
+		EndPosition:   time.Duration(s.EndPositionMs) * time.Millisecond,
+		RequestedBy:   s.RequestedBy,
+		Live:          s.Live,
+		Partial:       s.Partial,
+	}
+
+	// an invalid date is not worth failing the whole state for
+	if uploadDate, err := time.Parse(schemaDateLayout, s.UploadDate); err == nil {
+		song.UploadDate = uploadDate
+	}
+
+	for _, chapter := range s.Chapters {
+		song.Chapters = append(song.Chapters, bot.Chapter{
+			Title: chapter.Title,
+			Start: time.Duration(chapter.StartMs) * time.Millisecond,
+			End:   time.Duration(chapter.EndMs) * time.Millisecond,
+		})
+	}
+
+	for _, segment := range s.Segments {
+		song.Segments = append(song.Segments, bot.Segment{
+			Start:    time.Duration(segment.StartMs) * time.Millisecond,
+			End:      time.Duration(segment.EndMs) * time.Millisecond,
+			Category: segment.Category,
+		})
+	}
+
+	return song
+}
+
+// upgradeSchemaV0 migrates the unversioned state, which serialized bot.Song
+// directly: Go field names as keys and durations in nanoseconds.
+func upgradeSchemaV0(doc map[string]any) error {
+	if songs, ok := doc["songs"].([]any); ok {
+		for i, song := range songs {
+			if song == nil {
+				continue
+			}
+
+			songDoc, ok := song.(map[string]any)
+			if !ok {
+				return fmt.Errorf("invalid song at index %d", i)
+			}
+
+			if err := upgradeSongV0(songDoc); err != nil {
+				return fmt.Errorf("invalid song at index %d: %w", i, err)
+			}
+		}
+	}
+
+	if currentSong, ok := doc["current_song"].(map[string]any); ok {
+		if err := upgradeSongV0(currentSong); err != nil {
+			return fmt.Errorf("invalid current song: %w", err)
+		}
+
+		position, err := nanosecondsToMilliseconds(currentSong["Position"])
+		if err != nil {
+			return fmt.Errorf("invalid current song position: %w", err)
+		}
+		delete(currentSong, "Position")
+		currentSong["position_ms"] = position
+	}
+
+	return nil
+}
+
+func upgradeSongV0(song map[string]any) error {
+	renames := map[string]string{
+		"Type":         "type",
+		"Title":        "title",
+		"URL":          "url",
+		"Playable":     "playable",
+		"ThumbnailURL": "thumbnail_url",
+		"RequestedBy":  "requested_by",
+	}
+
+	for oldKey, newKey := range renames {
+		if value, ok := song[oldKey]; ok {
+			delete(song, oldKey)
+			song[newKey] = value
+		}
+	}
+
+	durations := map[string]string{
+		"Duration":      "duration_ms",
+		"StartPosition": "start_position_ms",
+	}
+
+	for oldKey, newKey := range durations {
+		value, err := nanosecondsToMilliseconds(song[oldKey])
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", oldKey, err)
+		}
+		delete(song, oldKey)
+		song[newKey] = value
+	}
+
+	return nil
+}
+
+func nanosecondsToMilliseconds(value any) (int64, error) {
+	if value == nil {
+		return 0, nil
+	}
+
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("expected a number, got %v", value)
+	}
+
+	ns, err := number.Int64()
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(ns).Milliseconds(), nil
+}
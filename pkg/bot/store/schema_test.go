@@ -0,0 +1,252 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestDecodeStateUpgradesV0(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    *fileState
+	}{
+		{
+			fixture: "v0_empty.json",
+			want: &fileState{
+				Songs: []*bot.Song{},
+			},
+		},
+		{
+			fixture: "v0_queue.json",
+			want: &fileState{
+				Songs: []*bot.Song{
+					{
+						Type:         "yt-dlp",
+						Title:        "Daft Punk - Around the World",
+						URL:          "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+						Playable:     true,
+						ThumbnailURL: strPtr("https://i.ytimg.com/vi/K0HSD_i2DvA/hqdefault.jpg"),
+						Duration:     429 * time.Second,
+						RequestedBy:  strPtr("alice"),
+					},
+					{
+						Type:          "yt-dlp",
+						Title:         "Lo-fi radio",
+						URL:           "https://www.youtube.com/watch?v=jfKfPfyJRdk",
+						Playable:      true,
+						StartPosition: 90500 * time.Millisecond,
+					},
+				},
+				CurrentSong: &bot.PlayedSong{
+					Song: bot.Song{
+						Type:          "yt-dlp",
+						Title:         "Queen - Bohemian Rhapsody",
+						URL:           "https://www.youtube.com/watch?v=fJ9rUzIMcZQ",
+						Playable:      true,
+						Duration:      354320 * time.Millisecond,
+						StartPosition: 30 * time.Second,
+						RequestedBy:   strPtr("bob"),
+					},
+					// the milliseconds are truncated
+					Position: 62999 * time.Millisecond,
+				},
+				VoiceChannel: "1012345678901234567",
+				TextChannel:  "1012345678901234568",
+			},
+		},
+		{
+			fixture: "v0_stopped.json",
+			want: &fileState{
+				Songs: []*bot.Song{
+					{
+						Type:     "yt-dlp",
+						Title:    "Never Gonna Give You Up",
+						URL:      "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+						Playable: true,
+						Duration: 213 * time.Second,
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			state, upgraded, err := decodeState(data)
+			if err != nil {
+				t.Fatalf("decodeState() error = %v", err)
+			}
+			if !upgraded {
+				t.Error("decodeState() upgraded = false, want true")
+			}
+			if !reflect.DeepEqual(state, tt.want) {
+				t.Errorf("decodeState() = %s, want %s", dumpState(state), dumpState(tt.want))
+			}
+
+			encoded, err := encodeState(state)
+			if err != nil {
+				t.Fatalf("encodeState() error = %v", err)
+			}
+
+			roundTripped, upgraded, err := decodeState(encoded)
+			if err != nil {
+				t.Fatalf("decodeState() of encoded state error = %v", err)
+			}
+			if upgraded {
+				t.Error("decodeState() of encoded state upgraded = true, want false")
+			}
+			if !reflect.DeepEqual(roundTripped, state) {
+				t.Errorf("round trip = %s, want %s", dumpState(roundTripped), dumpState(state))
+			}
+		})
+	}
+}
+
+func TestDecodeStateRoundTripsCurrentSchema(t *testing.T) {
+	state := &fileState{
+		Songs: []*bot.Song{
+			{
+				Type:          "yt-dlp",
+				Title:         "Mix",
+				Artist:        "Artist",
+				Album:         "Album",
+				Uploader:      "Uploader",
+				URL:           "https://www.youtube.com/watch?v=mix",
+				Playable:      true,
+				Duration:      time.Hour,
+				StartPosition: time.Minute,
+				EndPosition:   50 * time.Minute,
+				RequestedBy:   strPtr("alice"),
+				UploadDate:    time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC),
+				Chapters: []bot.Chapter{
+					{Title: "Intro", Start: 0, End: time.Minute},
+					{Title: "Main", Start: time.Minute, End: time.Hour},
+				},
+				Segments: []bot.Segment{
+					{Start: 10 * time.Minute, End: 11 * time.Minute, Category: "sponsor"},
+				},
+			},
+		},
+		CurrentSong: &bot.PlayedSong{
+			Song: bot.Song{
+				Type:     "radio",
+				Title:    "Radio",
+				URL:      "https://radio.example.com/stream",
+				Playable: true,
+				Live:     true,
+			},
+			Position: 5 * time.Second,
+		},
+		VoiceChannel: "1",
+		TextChannel:  "2",
+	}
+
+	data, err := encodeState(state)
+	if err != nil {
+		t.Fatalf("encodeState() error = %v", err)
+	}
+
+	got, upgraded, err := decodeState(data)
+	if err != nil {
+		t.Fatalf("decodeState() error = %v", err)
+	}
+	if upgraded {
+		t.Error("decodeState() upgraded = true, want false")
+	}
+	if !reflect.DeepEqual(got, state) {
+		t.Errorf("decodeState() = %s, want %s", dumpState(got), dumpState(state))
+	}
+}
+
+func TestDecodeStateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "newer version", data: `{"version": 99}`},
+		{name: "invalid version", data: `{"version": "1"}`},
+		{name: "v0 duration not a number", data: `{"songs": [{"Title": "a", "Duration": "3m"}]}`},
+		{name: "v0 song not an object", data: `{"songs": ["a"]}`},
+		{name: "v0 invalid position", data: `{"current_song": {"Title": "a", "Position": 1.5}}`},
+		{name: "not json", data: `songs`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeState([]byte(tt.data)); err == nil {
+				t.Error("decodeState() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestNewFilePlaylistStorageUpgradesV0(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "v0_queue.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err := NewFilePlaylistStorage(path)
+	if err != nil {
+		t.Fatalf("NewFilePlaylistStorage() error = %v", err)
+	}
+
+	backup, err := os.ReadFile(path + ".bak")
+	if err != nil {
+		t.Fatalf("while reading backup: %v", err)
+	}
+	if string(backup) != string(data) {
+		t.Error("backup differs from the original file")
+	}
+
+	upgradedData, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, upgraded, err := decodeState(upgradedData); err != nil || upgraded {
+		t.Errorf("decodeState() of upgraded file upgraded = %v, error = %v", upgraded, err)
+	}
+
+	songs, err := storage.GetSongs()
+	if err != nil {
+		t.Fatalf("GetSongs() error = %v", err)
+	}
+	if len(songs) != 2 || songs[0].Duration != 429*time.Second {
+		t.Errorf("GetSongs() = %s", dumpState(&fileState{Songs: songs}))
+	}
+
+	current, err := storage.GetCurrentSong()
+	if err != nil {
+		t.Fatalf("GetCurrentSong() error = %v", err)
+	}
+	if current == nil || current.Position != 62999*time.Millisecond {
+		t.Errorf("GetCurrentSong() = %+v", current)
+	}
+}
+
+func dumpState(state *fileState) string {
+	data, err := encodeState(state)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
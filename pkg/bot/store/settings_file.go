@@ -0,0 +1,93 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+type FileGuildSettingsStorage struct {
+	mutex    sync.RWMutex
+	filepath string
+}
+
+func NewFileGuildSettingsStorage(filepath string) (*FileGuildSettingsStorage, error) {
+	if _, err := os.Stat(filepath); os.IsNotExist(err) {
+		data, err := json.Marshal(bot.DefaultGuildSettings())
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal default settings: %w", err)
+		}
+
+		if err := os.WriteFile(filepath, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to create file: %w", err)
+		}
+	}
+
+	return &FileGuildSettingsStorage{
+		mutex:    sync.RWMutex{},
+		filepath: filepath,
+	}, nil
+}
+
+func (s *FileGuildSettingsStorage) GetSettings() (*bot.GuildSettings, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.readSettings()
+}
+
+func (s *FileGuildSettingsStorage) SetSettings(settings *bot.GuildSettings) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.writeSettings(settings)
+}
+
+// UpdateSettings reads the settings, changes them with fn and writes them
+// back, while holding the lock.
+func (s *FileGuildSettingsStorage) UpdateSettings(fn func(settings *bot.GuildSettings) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	settings, err := s.readSettings()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(settings); err != nil {
+		return err
+	}
+
+	return s.writeSettings(settings)
+}
+
+func (s *FileGuildSettingsStorage) readSettings() (*bot.GuildSettings, error) {
+	data, err := os.ReadFile(s.filepath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// start from the defaults, so settings added later get a sane value
+	settings := bot.DefaultGuildSettings()
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+func (s *FileGuildSettingsStorage) writeSettings(settings *bot.GuildSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings: %w", err)
+	}
+
+	if err := os.WriteFile(s.filepath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+type InmemoryGuildSettingsStorage struct {
+	mutex    sync.RWMutex
+	settings *bot.GuildSettings
+}
+
+func NewInmemoryGuildSettingsStorage() *InmemoryGuildSettingsStorage {
+	return &InmemoryGuildSettingsStorage{
+		mutex:    sync.RWMutex{},
+		settings: bot.DefaultGuildSettings(),
+	}
+}
+
+func (s *InmemoryGuildSettingsStorage) GetSettings() (*bot.GuildSettings, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	settings := *s.settings
+	return &settings, nil
+}
+
+func (s *InmemoryGuildSettingsStorage) SetSettings(settings *bot.GuildSettings) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	copied := *settings
+	s.settings = &copied
+	return nil
+}
+
+func (s *InmemoryGuildSettingsStorage) UpdateSettings(fn func(settings *bot.GuildSettings) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	settings := *s.settings
+	if err := fn(&settings); err != nil {
+		return err
+	}
+
+	s.settings = &settings
+	return nil
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+func TestUpdateSettings(t *testing.T) {
+	fileStore, err := NewFileGuildSettingsStorage(filepath.Join(t.TempDir(), "settings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]interface {
+		bot.GuildSettingsStore
+		bot.TransactionalGuildSettingsStore
+	}{
+		"memory": NewInmemoryGuildSettingsStorage(),
+		"file":   fileStore,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			// every update changes another setting, so none of them may be lost
+			updates := map[string]string{
+				"dj_role":                  "123",
+				"announce_channel":         "456",
+				"max_queue_length":         "100",
+				"idle_timeout":             "5m0s",
+				"max_consecutive_failures": "3",
+			}
+
+			wg := sync.WaitGroup{}
+			for key, value := range updates {
+				wg.Add(1)
+				go func(key, value string) {
+					defer wg.Done()
+					if err := s.UpdateSettings(func(settings *bot.GuildSettings) error {
+						return settings.Set(key, value)
+					}); err != nil {
+						t.Errorf("UpdateSettings(%s) error = %v", key, err)
+					}
+				}(key, value)
+			}
+			wg.Wait()
+
+			errFailed := errors.New("failed")
+			if err := s.UpdateSettings(func(settings *bot.GuildSettings) error {
+				settings.DJRole = "789"
+				return errFailed
+			}); !errors.Is(err, errFailed) {
+				t.Errorf("UpdateSettings() error = %v, want %v", err, errFailed)
+			}
+
+			settings, err := s.GetSettings()
+			if err != nil {
+				t.Fatalf("GetSettings() error = %v", err)
+			}
+			for key, want := range updates {
+				if got, _ := settings.Get(key); got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package bot
+
+import "context"
+
+type streamTitleCallbackKey struct{}
+
+// WithStreamTitleCallback returns a context, which lets the audio source
+// report the title of the track currently played in a live stream.
+func WithStreamTitleCallback(ctx context.Context, callback func(title string)) context.Context {
+	return context.WithValue(ctx, streamTitleCallbackKey{}, callback)
+}
+
+// ReportStreamTitle calls the callback set with WithStreamTitleCallback,
+// if there is any.
+func ReportStreamTitle(ctx context.Context, title string) {
+	if callback, ok := ctx.Value(streamTitleCallbackKey{}).(func(string)); ok {
+		callback(title)
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/Trojan295/discord-airplay/pkg/bot"
 	"github.com/Trojan295/discord-airplay/pkg/bot/store"
@@ -18,6 +19,14 @@ type Config struct {
 	Store StoreConfig
 
 	YtDlp YtDlpConfig
+
+	LocalLibrary LocalLibraryConfig
+
+	Cache CacheConfig
+
+	Process ProcessConfig
+
+	Segments SegmentsConfig
 }
 
 type StoreConfig struct {
@@ -27,6 +36,76 @@ type StoreConfig struct {
 
 type YtDlpConfig struct {
 	Proxy string `default:""`
+
+	// Binary, FFmpegBinary and FFprobeBinary are the paths of the
+	// executables, looked up in PATH, if they have no slash. ffmpeg and
+	// ffprobe are used by all sources, an empty FFprobeBinary is looked up
+	// next to ffmpeg.
+	Binary        string `default:"yt-dlp"`
+	FFmpegBinary  string `default:"ffmpeg"`
+	FFprobeBinary string `default:""`
+
+	// UpdateInterval is how often yt-dlp is updated, zero disables the
+	// updates, e.g. for air-gapped deployments.
+	UpdateInterval time.Duration `default:"24h"`
+
+	// Format is the yt-dlp format selection of the audio. RateLimit limits
+	// the download rate, e.g. `2M`.
+	Format    string `default:"bestaudio[acodec=opus]/bestaudio/best"`
+	RateLimit string `default:""`
+
+	// CookiesFile is a Netscape formatted cookies file passed to yt-dlp.
+	// NetrcFile has the credentials of the extractors. ExtractorArgsFile has
+	// the per-extractor options, one `extractor:key=value;key=value` per
+	// line. The secrets are kept in files, so they are not exposed in the
+	// environment of the processes.
+	CookiesFile       string `default:""`
+	NetrcFile         string `default:""`
+	ExtractorArgsFile string `default:""`
+	// ExtraArgs are added to every yt-dlp invocation, separated by commas.
+	ExtraArgs []string
+
+	// SponsorBlockCategories are the SponsorBlock segments, which are
+	// skipped, e.g. `sponsor,intro,outro`. Empty disables SponsorBlock.
+	SponsorBlockCategories []string
+
+	// SearchBackend is the yt-dlp search backend used for text queries.
+	// SearchFallback is tried, when it returns no playable songs.
+	SearchBackend  string `default:"ytsearch"`
+	SearchFallback string `default:"scsearch"`
+}
+
+type LocalLibraryConfig struct {
+	// Dir is the directory with audio files. The local library is disabled, if empty.
+	Dir            string        `default:""`
+	RescanInterval time.Duration `default:"1h"`
+
+	// CoverDir is where embedded covers are extracted. CoverURL is the URL,
+	// under which the CoverDir is served.
+	CoverDir string `default:""`
+	CoverURL string `default:""`
+}
+
+type CacheConfig struct {
+	// Dir is the directory of the audio cache. The cache is disabled, if empty.
+	Dir       string `default:""`
+	MaxSizeMB int    `default:"2048"`
+}
+
+// ProcessConfig limits the yt-dlp and ffmpeg processes playing songs.
+type ProcessConfig struct {
+	// MaxPipelines is the number of songs processed at the same time across
+	// all guilds, zero is unlimited.
+	MaxPipelines int `default:"16"`
+	// MaxMemoryMB limits the memory of each process, zero is unlimited.
+	MaxMemoryMB int `default:"0"`
+	Nice        int `default:"5"`
+}
+
+// SegmentsConfig configures skipping parts of songs.
+type SegmentsConfig struct {
+	// RulesFile is a JSON file with the skipped segments of songs.
+	RulesFile string `default:""`
 }
 
 type FileStoreConfig struct {
@@ -54,3 +133,25 @@ func GetPlaylistStore(cfg *Config, guildID string) bot.GuildPlayerState {
 		panic("invalid store type")
 	}
 }
+
+func GetSettingsStore(cfg *Config, guildID string) bot.GuildSettingsStore {
+	switch cfg.Store.Type {
+	case "memory":
+		return store.NewInmemoryGuildSettingsStorage()
+	case "file":
+		if err := os.MkdirAll(cfg.Store.File.Dir, 0755); err != nil {
+			panic(err)
+		}
+
+		path := filepath.Join(cfg.Store.File.Dir, guildID+".settings.json")
+		s, err := store.NewFileGuildSettingsStorage(path)
+		if err != nil {
+			panic(err)
+		}
+
+		return s
+
+	default:
+		panic("invalid store type")
+	}
+}
@@ -0,0 +1,246 @@
+package discord
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/sources"
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	// Discord does not accept more choices and longer names or values.
+	maxAutocompleteChoices     = 25
+	maxAutocompleteChoiceChars = 100
+
+	minAutocompleteSearchLength = 3
+	autocompleteSearchResults   = 5
+
+	// autocompleteDebounce is how long to wait for the user to stop typing,
+	// before the query is searched. Discord expects the response in 3s.
+	autocompleteDebounce      = 300 * time.Millisecond
+	autocompleteSearchTimeout = 2 * time.Second
+
+	autocompleteCacheTTL  = 10 * time.Minute
+	autocompleteCacheSize = 256
+)
+
+type cachedSearch struct {
+	songs    []*bot.Song
+	cachedAt time.Time
+}
+
+// autocompleteSearch caches provider searches and makes sure only the last
+// query typed by a user is searched.
+type autocompleteSearch struct {
+	mutex   sync.Mutex
+	cache   map[string]cachedSearch
+	pending map[string]uint64
+	seq     uint64
+}
+
+func newAutocompleteSearch() *autocompleteSearch {
+	return &autocompleteSearch{
+		cache:   make(map[string]cachedSearch),
+		pending: make(map[string]uint64),
+	}
+}
+
+func (a *autocompleteSearch) get(key string) ([]*bot.Song, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	cached, ok := a.cache[key]
+	if !ok || time.Since(cached.cachedAt) > autocompleteCacheTTL {
+		return nil, false
+	}
+
+	return cached.songs, true
+}
+
+func (a *autocompleteSearch) put(key string, songs []*bot.Song) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.cache) >= autocompleteCacheSize {
+		oldestKey := ""
+		var oldest time.Time
+		for k, cached := range a.cache {
+			if oldestKey == "" || cached.cachedAt.Before(oldest) {
+				oldestKey, oldest = k, cached.cachedAt
+			}
+		}
+		delete(a.cache, oldestKey)
+	}
+
+	a.cache[key] = cachedSearch{songs: songs, cachedAt: time.Now()}
+}
+
+// debounce waits for the debounce delay and reports, whether the user did
+// not type anything else meanwhile.
+func (a *autocompleteSearch) debounce(ctx context.Context, userID string) bool {
+	a.mutex.Lock()
+	a.seq++
+	seq := a.seq
+	a.pending[userID] = seq
+	a.mutex.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(autocompleteDebounce):
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.pending[userID] != seq {
+		return false
+	}
+	delete(a.pending, userID)
+
+	return true
+}
+
+// PlayAutocomplete suggests songs for the input of /air play from the recently
+// played songs, the queue, the playlists saved for the user and a provider
+// search.
+func (handler *InteractionHandler) PlayAutocomplete(s *discordgo.Session, ic *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) {
+	g, err := s.State.Guild(ic.GuildID)
+	if err != nil {
+		handler.logger.Info("failed to get guild", zap.Error(err))
+		respondAutocomplete(handler.logger, s, ic, nil)
+		return
+	}
+
+	player := handler.getGuildPlayer(GuildID(g.ID))
+
+	input := ""
+	if inputOpt := opt.GetOption("input"); inputOpt != nil {
+		input = strings.TrimSpace(inputOpt.StringValue())
+	}
+
+	choices := newAutocompleteChoices()
+
+	for _, song := range player.GetHistory() {
+		if matchesQuery(song, input) {
+			choices.add("🕘 ", song)
+		}
+	}
+
+	queue, err := player.GetSongs()
+	if err != nil {
+		handler.logger.Info("failed to get songs", zap.Error(err))
+	}
+	for _, song := range queue {
+		if matchesQuery(song, input) {
+			choices.add("📃 ", song)
+		}
+	}
+
+	// the bot has no named playlists, the saved ones are the playlists and
+	// search results, which wait for the user to add them
+	for _, list := range handler.storage.GetUserSongLists(ic.Member.User.ID) {
+		for _, song := range list {
+			if matchesQuery(song, input) {
+				choices.add("💾 ", song)
+			}
+		}
+	}
+
+	for _, song := range handler.autocompleteSearch(player, ic.Member.User.ID, input) {
+		choices.add("🔎 ", song)
+	}
+
+	respondAutocomplete(handler.logger, s, ic, choices.choices)
+}
+
+func (handler *InteractionHandler) autocompleteSearch(player *bot.GuildPlayer, userID, input string) []*bot.Song {
+	if len([]rune(input)) < minAutocompleteSearchLength || strings.Contains(input, "://") {
+		return nil
+	}
+
+	settings, err := player.GetSettings()
+	if err != nil {
+		handler.logger.Info("failed to get settings", zap.Error(err))
+		return nil
+	}
+
+	// guilds with different search backends get different results
+	key := settings.SearchBackend + "|" + settings.SearchFallback + "|" + strings.ToLower(input)
+	if songs, ok := handler.autocomplete.get(key); ok {
+		return songs
+	}
+
+	ctx, cancel := context.WithTimeout(handler.lookupContext(player), autocompleteSearchTimeout)
+	defer cancel()
+
+	if !handler.autocomplete.debounce(ctx, userID) {
+		return nil
+	}
+
+	songs, err := handler.songProvider.LookupSongs(sources.WithSearchLimit(ctx, autocompleteSearchResults), input)
+	if err != nil {
+		handler.logger.Debug("failed to search songs for autocomplete", zap.Error(err), zap.String("input", input))
+		return nil
+	}
+
+	handler.autocomplete.put(key, songs)
+	return songs
+}
+
+type autocompleteChoices struct {
+	choices []*discordgo.ApplicationCommandOptionChoice
+	seen    map[string]bool
+}
+
+func newAutocompleteChoices() *autocompleteChoices {
+	return &autocompleteChoices{
+		choices: make([]*discordgo.ApplicationCommandOptionChoice, 0, maxAutocompleteChoices),
+		seen:    make(map[string]bool),
+	}
+}
+
+// add adds the song as a choice, unless there are already enough choices or
+// its URL is too long to be used as the value.
+func (c *autocompleteChoices) add(icon string, song *bot.Song) {
+	if len(c.choices) >= maxAutocompleteChoices || !song.Playable || song.URL == "" || len(song.URL) > maxAutocompleteChoiceChars || c.seen[song.URL] {
+		return
+	}
+
+	c.seen[song.URL] = true
+	c.choices = append(c.choices, &discordgo.ApplicationCommandOptionChoice{
+		Name:  truncate(icon+song.GetHumanName(), maxAutocompleteChoiceChars),
+		Value: song.URL,
+	})
+}
+
+// matchesQuery reports, whether every word of the query is a part of the song
+// title, artist or URL.
+func matchesQuery(song *bot.Song, query string) bool {
+	text := strings.ToLower(strings.Join([]string{song.Title, song.Artist, song.URL}, " "))
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func respondAutocomplete(logger *zap.Logger, s *discordgo.Session, ic *discordgo.InteractionCreate, choices []*discordgo.ApplicationCommandOptionChoice) {
+	if choices == nil {
+		choices = []*discordgo.ApplicationCommandOptionChoice{}
+	}
+
+	InteractionRespond(logger, s, ic.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{
+			Choices: choices,
+		},
+	})
+}
@@ -4,12 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/Trojan295/discord-airplay/pkg/bot"
 	"github.com/Trojan295/discord-airplay/pkg/config"
+	"github.com/Trojan295/discord-airplay/pkg/locale"
 	"github.com/Trojan295/discord-airplay/pkg/sources"
-	"github.com/Trojan295/discord-airplay/pkg/utils"
 	"github.com/bwmarrin/discordgo"
 	"go.uber.org/zap"
 )
@@ -18,17 +19,23 @@ type GuildID string
 
 type SongProvider interface {
 	LookupSongs(ctx context.Context, input string) ([]*bot.Song, error)
-	GetAudio(ctx context.Context, song *bot.Song) (<-chan []byte, error)
+	ResolveSong(ctx context.Context, song *bot.Song) (*bot.Song, error)
+	GetAudio(ctx context.Context, song *bot.Song) (*bot.AudioStream, error)
 }
 
 type PlaylistGenerator interface {
 	GeneratePlaylist(ctx context.Context, params *sources.PlaylistParams) (*sources.PlaylistResponse, error)
 }
 
+// InteractionStorage keeps the songs, which wait for the user to pick them
+// in a message component. The keys are created with songListKey.
 type InteractionStorage interface {
-	SaveSongList(channelID string, list []*bot.Song)
-	GetSongList(channelID string) []*bot.Song
-	DeleteSongList(channelID string)
+	SaveSongList(key string, list []*bot.Song)
+	GetSongList(key string) []*bot.Song
+	DeleteSongList(key string)
+	// GetUserSongLists returns the song lists saved for the user, like the
+	// playlists waiting to be added, newest first.
+	GetUserSongLists(userID string) [][]*bot.Song
 }
 
 type InteractionHandler struct {
@@ -40,6 +47,7 @@ type InteractionHandler struct {
 	playlistGenerator PlaylistGenerator
 	songProvider      SongProvider
 	storage           InteractionStorage
+	autocomplete      *autocompleteSearch
 
 	cfg *config.Config // TODO: replace with a playlist store, which supports multiple guilds
 
@@ -54,6 +62,7 @@ func NewInteractionHandler(ctx context.Context, discordToken string, songLookupe
 		playlistGenerator: playlistGenerator,
 		songProvider:      songLookuper,
 		storage:           storage,
+		autocomplete:      newAutocompleteSearch(),
 		cfg:               cfg,
 		logger:            zap.NewNop(),
 	}
@@ -80,13 +89,24 @@ func (handler *InteractionHandler) GuildCreate(s *discordgo.Session, event *disc
 	if handler.cfg.PerGuildCommands {
 		commandHandler := NewSlashCommandRouter(handler.cfg.CommandPrefix).
 			PlayHandler(handler.PlaySong).
+			PlayAutocompleteHandler(handler.PlayAutocomplete).
 			SkipHandler(handler.SkipSong).
 			StopHandler(handler.StopPlaying).
 			ListHandler(handler.ListPlaylist).
 			RemoveHandler(handler.RemoveSong).
+			MoveHandler(handler.MoveSong).
+			ShuffleHandler(handler.ShufflePlaylist).
 			PlayingNowHandler(handler.GetPlayingSong).
 			DJHandler(handler.CreatePlaylist).
-			AddSongOrPlaylistHandler(handler.AddSongOrPlaylist)
+			ExportHandler(handler.ExportPlaylist).
+			ImportHandler(handler.ImportPlaylist).
+			SettingsHandler(handler.Settings).
+			SearchHandler(handler.SearchSongs).
+			FailedHandler(handler.ListFailedSongs).
+			DiagnosticsHandler(handler.Diagnostics).
+			ChapterHandler(handler.SeekChapter).
+			AddSongOrPlaylistHandler(handler.AddSongOrPlaylist).
+			SearchResultHandler(handler.AddSearchResults)
 
 		slashCommands := commandHandler.GetSlashCommands()
 		_, err := s.ApplicationCommandBulkOverwrite(s.State.Application.ID, event.Guild.ID, slashCommands)
@@ -126,6 +146,7 @@ func (handler *InteractionHandler) PlaySong(s *discordgo.Session, ic *discordgo.
 	}
 
 	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
 
 	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(opt.Options))
 	for _, opt := range opt.Options {
@@ -133,25 +154,29 @@ func (handler *InteractionHandler) PlaySong(s *discordgo.Session, ic *discordgo.
 	}
 
 	input := optionMap["input"].StringValue()
+	splitChapters := false
+	if chaptersOpt, ok := optionMap["chapters"]; ok {
+		splitChapters = chaptersOpt.BoolValue()
+	}
 
 	vs := getUsersVoiceState(g, ic.Member.User)
 	if vs == nil {
-		InteractionRespondMessage(handler.logger, s, ic.Interaction, MessageUserNotInVoiceChannel)
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageUserNotInVoiceChannel))
 	}
 
 	InteractionRespond(handler.logger, s, ic.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Embeds: []*discordgo.MessageEmbed{GenerateAddingSongEmbed(input, ic.Member)},
+			Embeds: []*discordgo.MessageEmbed{GenerateAddingSongEmbed(lang, input, ic.Member)},
 		},
 	})
 
 	go func(ic *discordgo.InteractionCreate, vs *discordgo.VoiceState) {
-		songs, err := handler.songProvider.LookupSongs(handler.ctx, input)
+		songs, err := handler.songProvider.LookupSongs(handler.lookupContext(player), input)
 		if err != nil {
 			logger.Info("failed to lookup song metadata", zap.Error(err), zap.String("input", input))
 			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
-				Embeds: []*discordgo.MessageEmbed{GenerateFailedToAddSongEmbed(input, ic.Member)},
+				Embeds: []*discordgo.MessageEmbed{GenerateFailedToAddSongEmbed(lang, input, err, ic.Member)},
 			})
 			return
 		}
@@ -163,7 +188,31 @@ func (handler *InteractionHandler) PlaySong(s *discordgo.Session, ic *discordgo.
 
 		if len(songs) == 0 {
 			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
-				Embeds: []*discordgo.MessageEmbed{GenerateFailedToFindSong(input, ic.Member)},
+				Embeds: []*discordgo.MessageEmbed{GenerateFailedToFindSong(lang, input, ic.Member)},
+			})
+			return
+		}
+
+		if splitChapters && len(songs) == 1 && len(songs[0].Chapters) > 0 {
+			chapters := songs[0].SplitChapters()
+
+			if err := player.AddSong(&ic.ChannelID, &vs.ChannelID, chapters...); err != nil {
+				if errors.Is(err, bot.ErrQueueFull) {
+					FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+						Content: locale.Sprintf(lang, MessageQueueFull),
+					})
+					return
+				}
+
+				logger.Info("failed to add chapters", zap.Error(err), zap.String("input", input))
+				FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+					Embeds: []*discordgo.MessageEmbed{GenerateFailedToAddSongEmbed(lang, input, err, ic.Member)},
+				})
+				return
+			}
+
+			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+				Embeds: []*discordgo.MessageEmbed{GeneratePlaylistAdded(lang, locale.Sprintf(lang, "Added chapters of %s", songs[0].GetHumanName()), chapters, ic.Member)},
 			})
 			return
 		}
@@ -172,31 +221,38 @@ func (handler *InteractionHandler) PlaySong(s *discordgo.Session, ic *discordgo.
 			song := songs[0]
 
 			if err := player.AddSong(&ic.ChannelID, &vs.ChannelID, song); err != nil {
+				if errors.Is(err, bot.ErrQueueFull) {
+					FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+						Content: locale.Sprintf(lang, MessageQueueFull),
+					})
+					return
+				}
+
 				logger.Info("failed to add song", zap.Error(err), zap.String("input", input))
 				FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
-					Embeds: []*discordgo.MessageEmbed{GenerateFailedToAddSongEmbed(input, ic.Member)},
+					Embeds: []*discordgo.MessageEmbed{GenerateFailedToAddSongEmbed(lang, input, err, ic.Member)},
 				})
 				return
 			}
 
 			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
-				Embeds: []*discordgo.MessageEmbed{GenerateAddedSongEmbed(song, ic.Member)},
+				Embeds: []*discordgo.MessageEmbed{GenerateAddedSongEmbed(lang, song, ic.Member)},
 			})
 			return
 		}
 
-		handler.storage.SaveSongList(ic.ChannelID, songs)
+		handler.storage.SaveSongList(songListKey(ic.ID, ic.Member.User.ID), songs)
 
 		FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
-			Embeds: []*discordgo.MessageEmbed{GenerateAskAddPlaylistEmbed(songs, ic.Member)},
+			Embeds: []*discordgo.MessageEmbed{GenerateAskAddPlaylistEmbed(lang, songs, ic.Member)},
 			Components: []discordgo.MessageComponent{
 				discordgo.ActionsRow{
 					Components: []discordgo.MessageComponent{
 						discordgo.SelectMenu{
-							CustomID: "add_song_playlist",
+							CustomID: componentCustomID("add_song_playlist", ic.ID),
 							Options: []discordgo.SelectMenuOption{
-								{Label: "Add song", Value: "song", Emoji: &discordgo.ComponentEmoji{Name: "🎵"}},
-								{Label: "Add whole playlist", Value: "playlist", Emoji: &discordgo.ComponentEmoji{Name: "🎶"}},
+								{Label: locale.Sprintf(lang, "Add song"), Value: "song", Emoji: &discordgo.ComponentEmoji{Name: "🎵"}},
+								{Label: locale.Sprintf(lang, "Add whole playlist"), Value: "playlist", Emoji: &discordgo.ComponentEmoji{Name: "🎶"}},
 							},
 						},
 					},
@@ -218,6 +274,7 @@ func (handler *InteractionHandler) CreatePlaylist(s *discordgo.Session, ic *disc
 	}
 
 	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
 
 	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(opt.Options))
 	for _, opt := range opt.Options {
@@ -233,13 +290,13 @@ func (handler *InteractionHandler) CreatePlaylist(s *discordgo.Session, ic *disc
 	}
 
 	if length > 20 {
-		InteractionRespondMessage(handler.logger, s, ic.Interaction, MessageTooLargePlaylist)
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageTooLargePlaylist))
 		return
 	}
 
 	vs := getUsersVoiceState(g, ic.Member.User)
 	if vs == nil {
-		InteractionRespondMessage(handler.logger, s, ic.Interaction, MessageUserNotInVoiceChannel)
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageUserNotInVoiceChannel))
 		return
 	}
 
@@ -251,7 +308,7 @@ func (handler *InteractionHandler) CreatePlaylist(s *discordgo.Session, ic *disc
 		if err != nil {
 			logger.Info("failed to generate playlist", zap.Error(err))
 			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
-				Content: MessageFailedGeneratePlaylist,
+				Content: locale.Sprintf(lang, MessageFailedGeneratePlaylist),
 			})
 			return
 		}
@@ -260,9 +317,10 @@ func (handler *InteractionHandler) CreatePlaylist(s *discordgo.Session, ic *disc
 
 		memberName := getMemberName(ic.Member)
 		songs := make([]*bot.Song, 0, len(playlist.Playlist))
+		lookupCtx := handler.lookupContext(player)
 
 		for _, input := range playlist.Playlist {
-			ss, err := handler.songProvider.LookupSongs(handler.ctx, input)
+			ss, err := handler.songProvider.LookupSongs(lookupCtx, input)
 			if err != nil {
 				logger.Info("failed to lookup song metadata", zap.Error(err), zap.String("input", input))
 				continue
@@ -280,25 +338,33 @@ func (handler *InteractionHandler) CreatePlaylist(s *discordgo.Session, ic *disc
 
 		if err := player.AddSong(&ic.ChannelID, &vs.ChannelID, songs...); err != nil {
 			logger.Info("failed to add songs", zap.Error(err))
+			if errors.Is(err, bot.ErrQueueFull) {
+				FollowupMessageCreate(logger, s, ic.Interaction, &discordgo.WebhookParams{
+					Content: locale.Sprintf(lang, MessageQueueFull),
+				})
+				return
+			}
 		}
 
 		FollowupMessageCreate(logger, s, ic.Interaction, &discordgo.WebhookParams{
-			Embeds: []*discordgo.MessageEmbed{GeneratePlaylistAdded(playlist.Intro, songs, ic.Member)},
+			Embeds: []*discordgo.MessageEmbed{GeneratePlaylistAdded(lang, playlist.Intro, songs, ic.Member)},
 		})
 	}(ic, vs)
 
 	InteractionRespond(logger, s, ic.Interaction, &discordgo.InteractionResponse{
 		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
 		Data: &discordgo.InteractionResponseData{
-			Content: "⏳ Generating playlist...",
+			Content: locale.Sprintf(lang, "⏳ Generating playlist..."),
 		},
 	})
 }
 
 func (handler *InteractionHandler) AddSongOrPlaylist(s *discordgo.Session, ic *discordgo.InteractionCreate) {
+	lang := handler.guildLocale(ic.GuildID)
+
 	values := ic.MessageComponentData().Values
 	if len(values) == 0 {
-		InteractionRespondMessage(handler.logger, s, ic.Interaction, "😨 Something went wrong...")
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "😨 Something went wrong..."))
 		return
 	}
 
@@ -310,9 +376,10 @@ func (handler *InteractionHandler) AddSongOrPlaylist(s *discordgo.Session, ic *d
 	}
 
 	value := values[0]
-	songs := handler.storage.GetSongList(ic.ChannelID)
+	key := songListKey(componentInteractionID(ic), ic.Member.User.ID)
+	songs := handler.storage.GetSongList(key)
 	if len(songs) == 0 {
-		InteractionRespondMessage(handler.logger, s, ic.Interaction, "Interaction was already selected")
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageSelectionUnavailable))
 		return
 	}
 
@@ -328,37 +395,49 @@ func (handler *InteractionHandler) AddSongOrPlaylist(s *discordgo.Session, ic *d
 	}
 
 	if voiceChannelID == nil {
-		InteractionRespondMessage(handler.logger, s, ic.Interaction, "🤷🏽 You are not in a voice channel. Join a voice channel to play a song.")
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷🏽 You are not in a voice channel. Join a voice channel to play a song."))
 		return
 	}
 
 	switch value {
 	case "playlist":
-		for _, song := range songs {
-			if err := player.AddSong(&ic.Message.ChannelID, voiceChannelID, song); err != nil {
-				handler.logger.Info("failed to add song", zap.Error(err), zap.String("input", song.URL))
+		if err := player.AddSong(&ic.Message.ChannelID, voiceChannelID, songs...); err != nil {
+			if errors.Is(err, bot.ErrQueueFull) {
+				InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageQueueFull))
+				return
 			}
+
+			handler.logger.Info("failed to add songs", zap.Error(err))
+			InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "😨 Failed to add songs"))
+			return
+		}
+		intro := locale.Sprintf(lang, "➕ Added %d songs to playlist", len(songs))
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, intro)
+
+		if hasPartialSongs(songs) {
+			go handler.resolveInBackground(s, ic, player, intro, songs)
 		}
-		InteractionRespondMessage(handler.logger, s, ic.Interaction, fmt.Sprintf("➕ Added %d songs to playlist", len(songs)))
 	default:
 		song := songs[0]
-		if err := player.AddSong(&ic.Message.ChannelID, voiceChannelID, song); err != nil {
+		if err := player.AddSong(&ic.Message.ChannelID, voiceChannelID, song); errors.Is(err, bot.ErrQueueFull) {
+			InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageQueueFull))
+		} else if err != nil {
 			handler.logger.Info("failed to add song", zap.Error(err), zap.String("input", song.URL))
-			InteractionRespondMessage(handler.logger, s, ic.Interaction, "😨 Failed to add song")
+			InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "😨 Failed to add song"))
 		} else {
 			embed := &discordgo.MessageEmbed{
 				Author: &discordgo.MessageEmbedAuthor{
-					Name: "Added to queue",
+					Name: locale.Sprintf(lang, "Added to queue"),
 				},
 				Title: song.GetHumanName(),
-				URL:   song.URL,
+				URL:   getSongLink(song),
 				Footer: &discordgo.MessageEmbedFooter{
-					Text: fmt.Sprintf("Requested by %s", *song.RequestedBy),
+					Text: locale.Sprintf(lang, "Requested by %s", *song.RequestedBy),
 				},
 				Fields: []*discordgo.MessageEmbedField{
 					{
-						Name:  "Duration",
-						Value: utils.FmtDuration(song.Duration),
+						Name:  locale.Sprintf(lang, "Duration"),
+						Value: fmtSongDuration(song),
 					},
 				},
 			}
@@ -378,7 +457,7 @@ func (handler *InteractionHandler) AddSongOrPlaylist(s *discordgo.Session, ic *d
 		}
 	}
 
-	handler.storage.DeleteSongList(ic.ChannelID)
+	handler.storage.DeleteSongList(key)
 }
 
 func (handler *InteractionHandler) StopPlaying(s *discordgo.Session, ic *discordgo.InteractionCreate, acido *discordgo.ApplicationCommandInteractionDataOption) {
@@ -390,13 +469,17 @@ func (handler *InteractionHandler) StopPlaying(s *discordgo.Session, ic *discord
 	}
 
 	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
+	if !handler.checkDJ(s, ic, player) {
+		return
+	}
 	if err := player.Stop(); err != nil {
 		handler.logger.Info("failed to stop playing", zap.Error(err))
 		InteractionRespondServerError(handler.logger, s, ic.Interaction)
 		return
 	}
 
-	InteractionRespondMessage(handler.logger, s, ic.Interaction, "⏹️  Stopped playing")
+	InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "⏹️  Stopped playing"))
 }
 
 func (handler *InteractionHandler) SkipSong(s *discordgo.Session, ic *discordgo.InteractionCreate, acido *discordgo.ApplicationCommandInteractionDataOption) {
@@ -408,9 +491,13 @@ func (handler *InteractionHandler) SkipSong(s *discordgo.Session, ic *discordgo.
 	}
 
 	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
+	if !handler.checkDJ(s, ic, player) {
+		return
+	}
 	player.SkipSong()
 
-	InteractionRespondMessage(handler.logger, s, ic.Interaction, "⏭️ Skipped song")
+	InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "⏭️ Skipped song"))
 }
 
 func (handler *InteractionHandler) ListPlaylist(s *discordgo.Session, ic *discordgo.InteractionCreate, acido *discordgo.ApplicationCommandInteractionDataOption) {
@@ -422,6 +509,7 @@ func (handler *InteractionHandler) ListPlaylist(s *discordgo.Session, ic *discor
 	}
 
 	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
 	playlist, err := player.GetPlaylist()
 	if err != nil {
 		handler.logger.Error("failed to get playlist", zap.Error(err))
@@ -429,7 +517,7 @@ func (handler *InteractionHandler) ListPlaylist(s *discordgo.Session, ic *discor
 	}
 
 	if len(playlist) == 0 {
-		InteractionRespondMessage(handler.logger, s, ic.Interaction, "🫙 Playlist is empty")
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🫙 Playlist is empty"))
 	} else {
 		builder := strings.Builder{}
 
@@ -450,13 +538,57 @@ func (handler *InteractionHandler) ListPlaylist(s *discordgo.Session, ic *discor
 			Type: discordgo.InteractionResponseChannelMessageWithSource,
 			Data: &discordgo.InteractionResponseData{
 				Embeds: []*discordgo.MessageEmbed{
-					{Title: "Playlist:", Description: message},
+					{Title: locale.Sprintf(lang, "Playlist:"), Description: message},
 				},
 			},
 		})
 	}
 }
 
+func (handler *InteractionHandler) ListFailedSongs(s *discordgo.Session, ic *discordgo.InteractionCreate, acido *discordgo.ApplicationCommandInteractionDataOption) {
+	g, err := s.State.Guild(ic.GuildID)
+	if err != nil {
+		handler.logger.Info("failed to get guild", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
+
+	failed := player.GetFailedSongs()
+	if len(failed) == 0 {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "👌 No songs failed to play"))
+		return
+	}
+
+	InteractionRespond(handler.logger, s, ic.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{GenerateFailedSongsEmbed(lang, failed)},
+		},
+	})
+}
+
+// Diagnostics shows the state of the audio sources, if the song provider can
+// describe it.
+func (handler *InteractionHandler) Diagnostics(s *discordgo.Session, ic *discordgo.InteractionCreate, acido *discordgo.ApplicationCommandInteractionDataOption) {
+	lang := handler.guildLocale(ic.GuildID)
+
+	provider, ok := handler.songProvider.(interface{ Diagnostics() sources.Diagnostics })
+	if !ok {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷 No diagnostics available"))
+		return
+	}
+
+	InteractionRespond(handler.logger, s, ic.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{GenerateDiagnosticsEmbed(provider.Diagnostics())},
+		},
+	})
+}
+
 func (handler *InteractionHandler) RemoveSong(s *discordgo.Session, ic *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) {
 	g, err := s.State.Guild(ic.GuildID)
 	if err != nil {
@@ -466,6 +598,10 @@ func (handler *InteractionHandler) RemoveSong(s *discordgo.Session, ic *discordg
 	}
 
 	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
+	if !handler.checkDJ(s, ic, player) {
+		return
+	}
 
 	optionMap := make(map[string]*discordgo.ApplicationCommandInteractionDataOption, len(opt.Options))
 	for _, opt := range opt.Options {
@@ -477,7 +613,7 @@ func (handler *InteractionHandler) RemoveSong(s *discordgo.Session, ic *discordg
 	song, err := player.RemoveSong(int(position))
 	if err != nil {
 		if errors.Is(err, bot.ErrRemoveInvalidPosition) {
-			InteractionRespondMessage(handler.logger, s, ic.Interaction, "🤷🏽 Invalid position")
+			InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷🏽 Invalid position"))
 			return
 		}
 
@@ -486,7 +622,62 @@ func (handler *InteractionHandler) RemoveSong(s *discordgo.Session, ic *discordg
 		return
 	}
 
-	InteractionRespondMessage(handler.logger, s, ic.Interaction, fmt.Sprintf("🗑️ Removed song **%v** from playlist", song.GetHumanName()))
+	InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🗑️ Removed song **%v** from playlist", song.GetHumanName()))
+}
+
+func (handler *InteractionHandler) MoveSong(s *discordgo.Session, ic *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) {
+	g, err := s.State.Guild(ic.GuildID)
+	if err != nil {
+		handler.logger.Info("failed to get guild", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
+	if !handler.checkDJ(s, ic, player) {
+		return
+	}
+
+	from := opt.GetOption("from").IntValue()
+	to := opt.GetOption("to").IntValue()
+
+	song, err := player.MoveSong(int(from), int(to))
+	if err != nil {
+		if errors.Is(err, bot.ErrRemoveInvalidPosition) {
+			InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷🏽 Invalid position"))
+			return
+		}
+
+		handler.logger.Error("failed to move song", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "↕️ Moved song **%v** to position %d", song.GetHumanName(), to))
+}
+
+func (handler *InteractionHandler) ShufflePlaylist(s *discordgo.Session, ic *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) {
+	g, err := s.State.Guild(ic.GuildID)
+	if err != nil {
+		handler.logger.Info("failed to get guild", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
+	if !handler.checkDJ(s, ic, player) {
+		return
+	}
+
+	if err := player.ShuffleQueue(); err != nil {
+		handler.logger.Error("failed to shuffle playlist", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🔀 Shuffled playlist"))
 }
 
 func (handler *InteractionHandler) GetPlayingSong(s *discordgo.Session, ic *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) {
@@ -498,6 +689,7 @@ func (handler *InteractionHandler) GetPlayingSong(s *discordgo.Session, ic *disc
 	}
 
 	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
 
 	song, err := player.GetPlayedSong()
 	if err != nil {
@@ -507,11 +699,79 @@ func (handler *InteractionHandler) GetPlayingSong(s *discordgo.Session, ic *disc
 	}
 
 	if song == nil {
-		InteractionRespondMessage(handler.logger, s, ic.Interaction, "🔇 No song is being played right now...")
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🔇 No song is being played right now..."))
 		return
 	}
 
-	InteractionRespondMessage(handler.logger, s, ic.Interaction, fmt.Sprintf("🎶 %s", song.GetHumanName()))
+	message := fmt.Sprintf("🎶 %s", song.GetHumanName())
+	if chapter := describeChapter(&song.Song, song.StartPosition+song.Position); chapter != "" {
+		message = fmt.Sprintf("%s\n%s", message, chapter)
+	}
+
+	InteractionRespondMessage(handler.logger, s, ic.Interaction, message)
+}
+
+// SeekChapter jumps to the next, previous or given chapter of the current
+// song.
+func (handler *InteractionHandler) SeekChapter(s *discordgo.Session, ic *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) {
+	g, err := s.State.Guild(ic.GuildID)
+	if err != nil {
+		handler.logger.Info("failed to get guild", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
+	if !handler.checkDJ(s, ic, player) {
+		return
+	}
+
+	song, err := player.GetPlayedSong()
+	if err != nil {
+		handler.logger.Info("failed to get played song", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	if song == nil {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🔇 No song is being played right now..."))
+		return
+	}
+
+	current := song.ChapterAt(song.StartPosition + song.Position)
+
+	var index int
+	switch target := strings.ToLower(strings.TrimSpace(opt.Options[0].StringValue())); target {
+	case "next":
+		index = current + 1
+	case "prev", "previous":
+		index = max(current-1, 0)
+	default:
+		n, err := strconv.Atoi(target)
+		if err != nil {
+			InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷 Expected next, prev or the number of the chapter"))
+			return
+		}
+		index = n - 1
+	}
+
+	chapter, err := player.SeekChapter(index)
+	switch {
+	case errors.Is(err, bot.ErrNotPlaying):
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🔇 No song is being played right now..."))
+	case errors.Is(err, bot.ErrNoChapters):
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷 The song has no chapters"))
+	case errors.Is(err, bot.ErrInvalidChapter):
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷 The song has %d chapters", len(song.Chapters)))
+	case errors.Is(err, bot.ErrNotSeekable):
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷 The song cannot be seeked"))
+	case err != nil:
+		handler.logger.Info("failed to seek chapter", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+	default:
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "📖 Playing chapter %d: %s", index+1, chapter.Title))
+	}
 }
 
 func (handler *InteractionHandler) setupGuildPlayer(guildID GuildID) *bot.GuildPlayer {
@@ -533,8 +793,25 @@ func (handler *InteractionHandler) setupGuildPlayer(guildID GuildID) *bot.GuildP
 	}
 
 	playlistStore := config.GetPlaylistStore(handler.cfg, string(guildID))
+	settingsStore := config.GetSettingsStore(handler.cfg, string(guildID))
+
+	player := bot.NewGuildPlayer(handler.ctx, voiceChat, string(guildID), playlistStore, handler.songProvider.GetAudio).
+		WithLogger(handler.logger.With(zap.String("guildID", string(guildID)))).
+		WithSettings(settingsStore).
+		WithSongResolver(handler.songProvider.ResolveSong)
+
+	if provider, ok := handler.songProvider.(interface {
+		SkipSegments(ctx context.Context, song *bot.Song) ([]bot.Segment, error)
+	}); ok {
+		player.WithSegmentProvider(provider.SkipSegments)
+	}
+
+	if provider, ok := handler.songProvider.(interface {
+		RelatedSongs(ctx context.Context, song *bot.Song) ([]*bot.Song, error)
+	}); ok {
+		player.WithRelatedSongProvider(provider.RelatedSongs)
+	}
 
-	player := bot.NewGuildPlayer(handler.ctx, voiceChat, string(guildID), playlistStore, handler.songProvider.GetAudio).WithLogger(handler.logger.With(zap.String("guildID", string(guildID))))
 	return player
 }
 
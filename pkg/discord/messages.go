@@ -1,11 +1,14 @@
 package discord
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/locale"
+	"github.com/Trojan295/discord-airplay/pkg/sources"
 	"github.com/Trojan295/discord-airplay/pkg/utils"
 	"github.com/bwmarrin/discordgo"
 )
@@ -14,18 +17,25 @@ var (
 	MessageUserNotInVoiceChannel  = "🤷 You are not in a voice channel. Join a voice channel to play a song."
 	MessageTooLargePlaylist       = "😨 You cannot request a playlist longer than 20 songs."
 	MessageFailedGeneratePlaylist = "😨 Failed to generate playlist."
+	MessageFailedImportPlaylist   = "😨 Failed to import playlist file."
+	MessageTooLargePlaylistFile   = "😨 The playlist file is too large."
+	MessageQueueFull              = "🈵 The queue is full. Wait until some songs finish playing."
+	MessageSelectionUnavailable   = "🤷 This selection has expired or was requested by someone else."
+
+	MessageMissingManageServerPermission = "🔒 You need the Manage Server permission to change the settings."
+	MessageMissingDJRole                 = "🔒 Only DJs can control the playback."
 )
 
-func GenerateAddingSongEmbed(input string, member *discordgo.Member) *discordgo.MessageEmbed {
-	return generateAddingSongEmbed(input, "🎵  Adding song to queue...", member)
+func GenerateAddingSongEmbed(lang, input string, member *discordgo.Member) *discordgo.MessageEmbed {
+	return generateAddingSongEmbed(lang, input, locale.Sprintf(lang, "🎵  Adding song to queue..."), member)
 }
 
-func GenerateAddedSongEmbed(song *bot.Song, member *discordgo.Member) *discordgo.MessageEmbed {
-	embed := generateAddingSongEmbed(song.GetHumanName(), "🎵  Added to queue.", member)
+func GenerateAddedSongEmbed(lang string, song *bot.Song, member *discordgo.Member) *discordgo.MessageEmbed {
+	embed := generateAddingSongEmbed(lang, song.GetHumanName(), locale.Sprintf(lang, "🎵  Added to queue."), member)
 	embed.Fields = []*discordgo.MessageEmbedField{
 		{
-			Name:  "Duration",
-			Value: utils.FmtDuration(song.Duration),
+			Name:  locale.Sprintf(lang, "Duration"),
+			Value: fmtSongDuration(song),
 		},
 	}
 
@@ -38,29 +48,97 @@ func GenerateAddedSongEmbed(song *bot.Song, member *discordgo.Member) *discordgo
 	return embed
 }
 
-func GenerateAskAddPlaylistEmbed(songs []*bot.Song, requestor *discordgo.Member) *discordgo.MessageEmbed {
-	title := fmt.Sprintf("👀  The song is part of a playlist, which contains %d songs. What should I do?", len(songs))
-	return generateAddingSongEmbed(title, "", requestor)
+func GenerateAskAddPlaylistEmbed(lang string, songs []*bot.Song, requestor *discordgo.Member) *discordgo.MessageEmbed {
+	title := locale.Sprintf(lang, "👀  The song is part of a playlist, which contains %d songs. What should I do?", len(songs))
+	return generateAddingSongEmbed(lang, title, "", requestor)
 }
 
-func GenerateFailedToAddSongEmbed(input string, member *discordgo.Member) *discordgo.MessageEmbed {
-	return generateAddingSongEmbed(input, "😨  Failed to add song.", member)
+// GenerateSearchResultsEmbeds returns an embed for every search result, so
+// each one can show its thumbnail.
+func GenerateSearchResultsEmbeds(songs []*bot.Song) []*discordgo.MessageEmbed {
+	embeds := make([]*discordgo.MessageEmbed, 0, len(songs))
+
+	for i, song := range songs {
+		embed := &discordgo.MessageEmbed{
+			Title:       fmt.Sprintf("%d. %s", i+1, song.GetHumanName()),
+			URL:         getSongLink(song),
+			Description: fmtSongDuration(song),
+		}
+		if song.GetAuthor() != "" {
+			embed.Description = fmt.Sprintf("%s • %s", song.GetAuthor(), embed.Description)
+		}
+		if song.ThumbnailURL != nil {
+			embed.Thumbnail = &discordgo.MessageEmbedThumbnail{
+				URL: *song.ThumbnailURL,
+			}
+		}
+
+		embeds = append(embeds, embed)
+	}
+
+	return embeds
 }
 
-func GenerateFailedToFindSong(input string, member *discordgo.Member) *discordgo.MessageEmbed {
-	return generateAddingSongEmbed(input, "😨 Could not find any playable songs.", member)
+func GenerateFailedToAddSongEmbed(lang, input string, err error, member *discordgo.Member) *discordgo.MessageEmbed {
+	return generateAddingSongEmbed(lang, input, describeLookupError(lang, err), member)
+}
+
+// describeLookupError explains, why a song could not be added.
+func describeLookupError(lang string, err error) string {
+	switch {
+	case errors.Is(err, bot.ErrAgeRestricted):
+		return locale.Sprintf(lang, "🔞 Failed to add song. It is age-restricted and needs the cookies of an account, which can watch it.")
+	case errors.Is(err, bot.ErrLoginRequired):
+		return locale.Sprintf(lang, "🔒 Failed to add song. It is members-only or private and needs the credentials of an account with access.")
+	case errors.Is(err, bot.ErrGeoBlocked):
+		return locale.Sprintf(lang, "🌍 Failed to add song. It is not available in this country.")
+	case errors.Is(err, bot.ErrRemoved):
+		return locale.Sprintf(lang, "🗑️ Failed to add song. It was removed or is private.")
+	case errors.Is(err, sources.ErrPrivateAddress):
+		return locale.Sprintf(lang, "🚫 Failed to add song. Streams on private addresses cannot be played.")
+	default:
+		return locale.Sprintf(lang, "😨  Failed to add song.")
+	}
+}
+
+func GenerateFailedToFindSong(lang, input string, member *discordgo.Member) *discordgo.MessageEmbed {
+	return generateAddingSongEmbed(lang, input, locale.Sprintf(lang, "😨 Could not find any playable songs."), member)
 }
 
 func GeneratePlayingSongEmbed(message *bot.PlayMessage) *discordgo.MessageEmbed {
-	progressBar := ""
-	if message.Song.Duration > 0 {
-		progressBar = generateProgressBar(float64(message.Position)/float64(message.Song.Duration), 20)
+	var description string
+	if message.Song.Live {
+		description = fmt.Sprintf("🔴 LIVE  %s", utils.FmtDuration(message.Position))
+		if message.StreamTitle != "" {
+			description = fmt.Sprintf("🎶 %s\n%s", message.StreamTitle, description)
+		}
+	} else {
+		progressBar := ""
+		if message.Song.Duration > 0 {
+			progressBar = generateProgressBar(float64(message.Position)/float64(message.Song.Duration), 20)
+		}
+		description = fmt.Sprintf("%s\n%s / %s", progressBar, utils.FmtDuration(message.Position), utils.FmtDuration(message.Song.Duration))
+
+		if chapter := describeChapter(message.Song, message.Position); chapter != "" {
+			description = fmt.Sprintf("%s\n%s", chapter, description)
+		}
 	}
 
 	embed := &discordgo.MessageEmbed{
 		Title:       fmt.Sprintf("▶️  %s", message.Song.GetHumanName()),
-		URL:         message.Song.URL,
-		Description: fmt.Sprintf("%s\n%s / %s", progressBar, utils.FmtDuration(message.Position), utils.FmtDuration(message.Song.Duration)),
+		URL:         getSongLink(message.Song),
+		Description: description,
+	}
+
+	if message.Err != nil {
+		embed.Title = fmt.Sprintf("⚠️  %s", message.Song.GetHumanName())
+		embed.Description = fmt.Sprintf("%s\n%s", describePlaybackError(message.Locale, message.Err), description)
+	}
+
+	if message.Song.GetAuthor() != "" {
+		embed.Author = &discordgo.MessageEmbedAuthor{
+			Name: message.Song.GetAuthor(),
+		}
 	}
 
 	if message.Song.ThumbnailURL != nil {
@@ -71,28 +149,127 @@ func GeneratePlayingSongEmbed(message *bot.PlayMessage) *discordgo.MessageEmbed
 
 	if message.Song.RequestedBy != nil {
 		embed.Footer = &discordgo.MessageEmbedFooter{
-			Text: fmt.Sprintf("Requested by %s", *message.Song.RequestedBy),
+			Text: locale.Sprintf(message.Locale, "Requested by %s", *message.Song.RequestedBy),
 		}
 	}
 
 	return embed
 }
 
-func GeneratePlaylistAdded(intro string, songs []*bot.Song, member *discordgo.Member) *discordgo.MessageEmbed {
+// describePlaybackError explains, why a song stopped playing.
+func describePlaybackError(lang string, err error) string {
+	switch {
+	case errors.Is(err, bot.ErrGeoBlocked):
+		return locale.Sprintf(lang, "🌍 This song is not available in the bot's country.")
+	case errors.Is(err, bot.ErrAgeRestricted):
+		return locale.Sprintf(lang, "🔞 This song is age-restricted and cannot be played.")
+	case errors.Is(err, bot.ErrLoginRequired):
+		return locale.Sprintf(lang, "🔒 This song is members-only or private and cannot be played.")
+	case errors.Is(err, bot.ErrRemoved):
+		return locale.Sprintf(lang, "🗑️ This song was removed or is private.")
+	case errors.Is(err, bot.ErrNetwork):
+		return locale.Sprintf(lang, "📡 The song stopped playing because of a network error.")
+	case errors.Is(err, bot.ErrIncompleteAudio):
+		return locale.Sprintf(lang, "✂️ The song stopped playing before its end.")
+	default:
+		return locale.Sprintf(lang, "😨 The song failed to play.")
+	}
+}
+
+// describeChapter returns the chapter of the song played at the position.
+func describeChapter(song *bot.Song, position time.Duration) string {
+	idx := song.ChapterAt(position)
+	if idx < 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("📖 %d/%d  %s", idx+1, len(song.Chapters), song.Chapters[idx].Title)
+}
+
+func GenerateFailedSongsEmbed(lang string, failed []*bot.FailedSong) *discordgo.MessageEmbed {
+	builder := strings.Builder{}
+
+	for idx, f := range failed {
+		line := fmt.Sprintf("%d. %s <t:%d:R>\n%s\n", idx+1, f.Song.GetHumanName(), f.FailedAt.Unix(), describePlaybackError(lang, f.Err))
+
+		if len(line)+builder.Len() > 4000 {
+			builder.WriteString("...")
+			break
+		}
+
+		builder.WriteString(line)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       locale.Sprintf(lang, "Failed songs:"),
+		Description: strings.TrimSpace(builder.String()),
+	}
+}
+
+func GenerateDiagnosticsEmbed(diagnostics sources.Diagnostics) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: "Diagnostics:",
+	}
+
+	if status := diagnostics.YtDlp; status != nil {
+		version := status.Version
+		if version == "" {
+			version = "not detected"
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "yt-dlp", Value: fmt.Sprintf("%s (`%s`)", version, status.Binary)})
+
+		update := "never"
+		if !status.UpdatedAt.IsZero() {
+			update = fmt.Sprintf("<t:%d:R>", status.UpdatedAt.Unix())
+			if status.UpdateErr != nil {
+				update += ", failed: " + status.UpdateErr.Error()
+			}
+		}
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{Name: "Last update", Value: update})
+	}
+
+	pipelines := strings.Builder{}
+	for _, p := range diagnostics.Pipelines {
+		line := fmt.Sprintf("%s, %d processes, started <t:%d:R>\n", p.Name, len(p.Processes), p.StartedAt.Unix())
+		if len(line)+pipelines.Len() > 1000 {
+			pipelines.WriteString("...")
+			break
+		}
+		pipelines.WriteString(line)
+	}
+	if pipelines.Len() == 0 {
+		pipelines.WriteString("none")
+	}
+	embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+		Name:  fmt.Sprintf("Running downloads (%d)", len(diagnostics.Pipelines)),
+		Value: strings.TrimSpace(pipelines.String()),
+	})
+
+	if stats := diagnostics.Cache; stats != nil {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Audio cache",
+			Value: fmt.Sprintf("%d songs, %.1f MB, %.0f%% hit rate (%d hits, %d misses)", stats.Entries, float64(stats.Size)/(1024*1024), stats.HitRate()*100, stats.Hits, stats.Misses),
+		})
+	}
+
+	return embed
+}
+
+func GeneratePlaylistAdded(lang, intro string, songs []*bot.Song, member *discordgo.Member) *discordgo.MessageEmbed {
 	descriptionBuilder := strings.Builder{}
 	duration := time.Duration(0)
 
 	for _, song := range songs {
-		duration += song.Duration
-		descriptionBuilder.WriteString(fmt.Sprintf("1.️  %s (%s)\n", song.GetHumanName(), utils.FmtDuration(song.Duration)))
+		duration += song.GetLength()
+		descriptionBuilder.WriteString(fmt.Sprintf("1.️  %s (%s)\n", song.GetHumanName(), fmtSongDuration(song)))
 	}
 
 	title := fmt.Sprintf("🎵  %s", intro)
 
-	embed := generateAddingSongEmbed(title, descriptionBuilder.String(), member)
+	embed := generateAddingSongEmbed(lang, title, descriptionBuilder.String(), member)
 	embed.Fields = []*discordgo.MessageEmbedField{
 		{
-			Name:  "Duration",
+			Name:  locale.Sprintf(lang, "Duration"),
 			Value: utils.FmtDuration(duration),
 		},
 	}
@@ -100,18 +277,64 @@ func GeneratePlaylistAdded(intro string, songs []*bot.Song, member *discordgo.Me
 	return embed
 }
 
-func generateAddingSongEmbed(title, description string, requestor *discordgo.Member) *discordgo.MessageEmbed {
+func GeneratePlaylistImportedEmbed(lang, filename string, songs []*bot.Song, skipped, truncated int, member *discordgo.Member) *discordgo.MessageEmbed {
+	duration := time.Duration(0)
+	for _, song := range songs {
+		duration += song.GetLength()
+	}
+
+	title := locale.Sprintf(lang, "📂  Imported %d songs from %s", len(songs), filename)
+
+	lines := []string{}
+	if skipped > 0 {
+		lines = append(lines, locale.Sprintf(lang, "Skipped %d songs, which could not be found.", skipped))
+	}
+	if truncated > 0 {
+		lines = append(lines, locale.Sprintf(lang, "Skipped the last %d songs, which do not fit in the queue.", truncated))
+	}
+	description := strings.Join(lines, "\n")
+
+	embed := generateAddingSongEmbed(lang, title, description, member)
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{
+			Name:  locale.Sprintf(lang, "Duration"),
+			Value: utils.FmtDuration(duration),
+		},
+	}
+
+	return embed
+}
+
+func generateAddingSongEmbed(lang, title, description string, requestor *discordgo.Member) *discordgo.MessageEmbed {
 	embed := &discordgo.MessageEmbed{
 		Title:       title,
 		Description: description,
 		Footer: &discordgo.MessageEmbedFooter{
-			Text: fmt.Sprintf("Requested by %s", getMemberName(requestor)),
+			Text: locale.Sprintf(lang, "Requested by %s", getMemberName(requestor)),
 		},
 	}
 
 	return embed
 }
 
+func fmtSongDuration(song *bot.Song) string {
+	if song.Live {
+		return "🔴 LIVE"
+	}
+
+	return utils.FmtDuration(song.GetLength())
+}
+
+// getSongLink returns the song URL, if it can be used as a link in an embed.
+// Songs from the local library have URLs, which Discord does not accept.
+func getSongLink(song *bot.Song) string {
+	if strings.HasPrefix(song.URL, "https://") || strings.HasPrefix(song.URL, "http://") {
+		return song.URL
+	}
+
+	return ""
+}
+
 func generateProgressBar(progress float64, length int) string {
 	if length == 0 {
 		return ""
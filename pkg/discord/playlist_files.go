@@ -0,0 +1,267 @@
+package discord
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/locale"
+	"github.com/Trojan295/discord-airplay/pkg/playlist"
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const maxPlaylistFileSize = 1 << 20
+
+// maxImportedSongs limits the songs imported from a playlist file, as each
+// song without metadata is looked up separately.
+const maxImportedSongs = 500
+
+func (handler *InteractionHandler) ExportPlaylist(s *discordgo.Session, ic *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) {
+	g, err := s.State.Guild(ic.GuildID)
+	if err != nil {
+		handler.logger.Info("failed to get guild", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	lang := handler.guildLocale(ic.GuildID)
+
+	format := playlist.FormatJSON
+	if formatOpt := opt.GetOption("format"); formatOpt != nil {
+		format, err = playlist.ParseFormat(formatOpt.StringValue())
+		if err != nil {
+			InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷🏽 Unknown playlist format"))
+			return
+		}
+	}
+
+	player := handler.getGuildPlayer(GuildID(g.ID))
+	songs, err := player.GetSongs()
+	if err != nil {
+		handler.logger.Error("failed to get songs", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	if len(songs) == 0 {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🫙 Playlist is empty"))
+		return
+	}
+
+	data, err := playlist.Export(format, songs)
+	if err != nil {
+		handler.logger.Error("failed to export playlist", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	InteractionRespond(handler.logger, s, ic.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Content: locale.Sprintf(lang, "💾 Exported %d songs", len(songs)),
+			Files: []*discordgo.File{
+				{
+					Name:        fmt.Sprintf("playlist.%s", format.Extension()),
+					ContentType: format.ContentType(),
+					Reader:      bytes.NewReader(data),
+				},
+			},
+		},
+	})
+}
+
+func (handler *InteractionHandler) ImportPlaylist(s *discordgo.Session, ic *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) {
+	logger := handler.logger.With(zap.String("guildID", ic.GuildID))
+
+	g, err := s.State.Guild(ic.GuildID)
+	if err != nil {
+		logger.Info("failed to get guild", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
+
+	attachment := getAttachmentOption(ic, opt.GetOption("file"))
+	if attachment == nil {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷🏽 Missing playlist file"))
+		return
+	}
+
+	if attachment.Size > maxPlaylistFileSize {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageTooLargePlaylistFile))
+		return
+	}
+
+	vs := getUsersVoiceState(g, ic.Member.User)
+	if vs == nil {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageUserNotInVoiceChannel))
+		return
+	}
+
+	InteractionRespond(handler.logger, s, ic.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+	})
+
+	go func(ic *discordgo.InteractionCreate, vs *discordgo.VoiceState) {
+		data, err := downloadAttachment(handler.ctx, attachment)
+		if err != nil {
+			logger.Info("failed to download playlist file", zap.Error(err))
+			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+				Content: locale.Sprintf(lang, MessageFailedImportPlaylist),
+			})
+			return
+		}
+
+		entries, err := playlist.Import(attachment.Filename, data)
+		if err != nil {
+			logger.Info("failed to parse playlist file", zap.Error(err))
+			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+				Content: locale.Sprintf(lang, MessageFailedImportPlaylist),
+			})
+			return
+		}
+
+		limit, err := importLimit(player)
+		if err != nil {
+			logger.Info("failed to get import limit", zap.Error(err))
+			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+				Content: locale.Sprintf(lang, MessageFailedImportPlaylist),
+			})
+			return
+		}
+		if limit == 0 {
+			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+				Content: locale.Sprintf(lang, MessageQueueFull),
+			})
+			return
+		}
+
+		truncated := 0
+		if len(entries) > limit {
+			truncated = len(entries) - limit
+			entries = entries[:limit]
+		}
+
+		memberName := getMemberName(ic.Member)
+		songs := make([]*bot.Song, 0, len(entries))
+		lookupCtx := handler.lookupContext(player)
+
+		for _, entry := range entries {
+			song := entry
+			if !playlist.HasMetadata(entry) {
+				ss, err := handler.songProvider.LookupSongs(lookupCtx, entry.URL)
+				if err != nil {
+					logger.Info("failed to lookup song metadata", zap.Error(err), zap.String("input", entry.URL))
+					continue
+				}
+
+				if len(ss) == 0 {
+					continue
+				}
+
+				song = ss[0]
+				song.StartPosition = entry.StartPosition
+				song.EndPosition = entry.EndPosition
+			}
+
+			// the requester in the file is not trusted
+			song.RequestedBy = &memberName
+
+			songs = append(songs, song)
+		}
+
+		if len(songs) == 0 {
+			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+				Embeds: []*discordgo.MessageEmbed{GenerateFailedToFindSong(lang, attachment.Filename, ic.Member)},
+			})
+			return
+		}
+
+		if err := player.AddSong(&ic.ChannelID, &vs.ChannelID, songs...); err != nil {
+			logger.Info("failed to add songs", zap.Error(err))
+
+			message := MessageFailedImportPlaylist
+			if errors.Is(err, bot.ErrQueueFull) {
+				message = MessageQueueFull
+			}
+
+			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+				Content: locale.Sprintf(lang, message),
+			})
+			return
+		}
+
+		FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+			Embeds: []*discordgo.MessageEmbed{GeneratePlaylistImportedEmbed(lang, attachment.Filename, songs, len(entries)-len(songs), truncated, ic.Member)},
+		})
+	}(ic, vs)
+}
+
+func getAttachmentOption(ic *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) *discordgo.MessageAttachment {
+	if opt == nil || opt.Type != discordgo.ApplicationCommandOptionAttachment {
+		return nil
+	}
+
+	id, ok := opt.Value.(string)
+	if !ok {
+		return nil
+	}
+
+	resolved := ic.ApplicationCommandData().Resolved
+	if resolved == nil {
+		return nil
+	}
+
+	return resolved.Attachments[id]
+}
+
+// importLimit returns the number of songs, which can be imported: the free
+// space in the queue, but at most maxImportedSongs.
+func importLimit(player *bot.GuildPlayer) (int, error) {
+	settings, err := player.GetSettings()
+	if err != nil {
+		return 0, err
+	}
+
+	if settings.MaxQueueLength <= 0 {
+		return maxImportedSongs, nil
+	}
+
+	queued, err := player.GetSongs()
+	if err != nil {
+		return 0, err
+	}
+
+	return max(min(settings.MaxQueueLength-len(queued), maxImportedSongs), 0), nil
+}
+
+func downloadAttachment(ctx context.Context, attachment *discordgo.MessageAttachment) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, attachment.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("while creating request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("while downloading attachment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPlaylistFileSize))
+	if err != nil {
+		return nil, fmt.Errorf("while reading attachment: %w", err)
+	}
+
+	return data, nil
+}
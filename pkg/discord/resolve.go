@@ -0,0 +1,80 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/locale"
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	// resolveProgressInterval limits the message edits to stay within the
+	// Discord rate limits.
+	resolveProgressInterval = 5 * time.Second
+	maxReportedDroppedSongs = 10
+)
+
+func hasPartialSongs(songs []*bot.Song) bool {
+	for _, song := range songs {
+		if song.Partial {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveInBackground resolves the partial songs of an added playlist and
+// reports the progress by editing the message, which announced the playlist.
+func (handler *InteractionHandler) resolveInBackground(s *discordgo.Session, ic *discordgo.InteractionCreate, player *bot.GuildPlayer, intro string, songs []*bot.Song) {
+	message, err := s.InteractionResponse(ic.Interaction)
+	if err != nil {
+		handler.logger.Info("failed to get interaction response", zap.Error(err))
+	}
+
+	var lastEdit time.Time
+
+	err = player.ResolveSongs(handler.ctx, songs, func(progress bot.ResolveProgress) {
+		if message == nil || (!progress.Done() && time.Since(lastEdit) < resolveProgressInterval) {
+			return
+		}
+		lastEdit = time.Now()
+
+		// the message is edited directly, because the interaction token
+		// expires before huge playlists are resolved
+		if _, err := s.ChannelMessageEdit(message.ChannelID, message.ID, fmtResolveProgress(handler.guildLocale(ic.GuildID), intro, progress)); err != nil {
+			handler.logger.Info("failed to edit message", zap.Error(err))
+		}
+	})
+	// the resolving is canceled, when the player is stopped
+	if err != nil && !errors.Is(err, context.Canceled) {
+		handler.logger.Info("failed to resolve songs", zap.Error(err))
+	}
+}
+
+func fmtResolveProgress(lang, intro string, progress bot.ResolveProgress) string {
+	if !progress.Done() {
+		return fmt.Sprintf("%s\n%s", intro, locale.Sprintf(lang, "⏳ Loading songs... %d/%d", progress.Resolved+len(progress.Dropped)+progress.Skipped, progress.Total))
+	}
+
+	if len(progress.Dropped) == 0 {
+		return intro
+	}
+
+	names := make([]string, 0, maxReportedDroppedSongs)
+	for i, song := range progress.Dropped {
+		if i == maxReportedDroppedSongs {
+			names = append(names, locale.Sprintf(lang, "and %d more", len(progress.Dropped)-maxReportedDroppedSongs))
+			break
+		}
+		names = append(names, song.GetHumanName())
+	}
+
+	return fmt.Sprintf("%s\n%s", intro, locale.Sprintf(lang, "⚠️ Removed %d songs, which cannot be played: %s", len(progress.Dropped), strings.Join(names, ", ")))
+}
@@ -0,0 +1,214 @@
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/locale"
+	"github.com/Trojan295/discord-airplay/pkg/sources"
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSearchResults = 5
+	// maxSearchResults is limited by the number of embeds in a message.
+	maxSearchResults = 10
+)
+
+func (handler *InteractionHandler) SearchSongs(s *discordgo.Session, ic *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) {
+	logger := handler.logger.With(zap.String("guildID", ic.GuildID))
+
+	g, err := s.State.Guild(ic.GuildID)
+	if err != nil {
+		logger.Info("failed to get guild", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	player := handler.getGuildPlayer(GuildID(g.ID))
+	lang := handler.guildLocale(ic.GuildID)
+
+	query := opt.GetOption("query").StringValue()
+
+	limit := defaultSearchResults
+	if resultsOpt := opt.GetOption("results"); resultsOpt != nil {
+		limit = int(resultsOpt.IntValue())
+	}
+	if limit < 1 || limit > maxSearchResults {
+		limit = defaultSearchResults
+	}
+
+	InteractionRespond(handler.logger, s, ic.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredChannelMessageWithSource,
+		Data: &discordgo.InteractionResponseData{
+			Embeds: []*discordgo.MessageEmbed{GenerateAddingSongEmbed(lang, query, ic.Member)},
+		},
+	})
+
+	go func(ic *discordgo.InteractionCreate) {
+		ctx := sources.WithSearchLimit(handler.lookupContext(player), limit)
+
+		found, err := handler.songProvider.LookupSongs(ctx, query)
+		if err != nil {
+			logger.Info("failed to search songs", zap.Error(err), zap.String("query", query))
+			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+				Embeds: []*discordgo.MessageEmbed{GenerateFailedToAddSongEmbed(lang, query, err, ic.Member)},
+			})
+			return
+		}
+
+		memberName := getMemberName(ic.Member)
+		songs := make([]*bot.Song, 0, limit)
+		for _, song := range found {
+			if !song.Playable || len(songs) == limit {
+				continue
+			}
+
+			song.RequestedBy = &memberName
+			songs = append(songs, song)
+		}
+
+		if len(songs) == 0 {
+			FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+				Embeds: []*discordgo.MessageEmbed{GenerateFailedToFindSong(lang, query, ic.Member)},
+			})
+			return
+		}
+
+		handler.storage.SaveSongList(songListKey(ic.ID, ic.Member.User.ID), songs)
+
+		options := make([]discordgo.SelectMenuOption, 0, len(songs))
+		for i, song := range songs {
+			description := fmtSongDuration(song)
+			if song.GetAuthor() != "" {
+				description = fmt.Sprintf("%s • %s", song.GetAuthor(), description)
+			}
+
+			options = append(options, discordgo.SelectMenuOption{
+				Label:       truncate(fmt.Sprintf("%d. %s", i+1, song.GetHumanName()), 100),
+				Description: truncate(description, 100),
+				Value:       strconv.Itoa(i),
+			})
+		}
+
+		minValues := 1
+
+		FollowupMessageCreate(handler.logger, s, ic.Interaction, &discordgo.WebhookParams{
+			Content: locale.Sprintf(lang, "🔎 Found %d songs for \"%s\". Which should I add?", len(songs), query),
+			Embeds:  GenerateSearchResultsEmbeds(songs),
+			Components: []discordgo.MessageComponent{
+				discordgo.ActionsRow{
+					Components: []discordgo.MessageComponent{
+						discordgo.SelectMenu{
+							CustomID:    componentCustomID("search_result", ic.ID),
+							Placeholder: locale.Sprintf(lang, "Pick the songs to add"),
+							MinValues:   &minValues,
+							MaxValues:   len(options),
+							Options:     options,
+						},
+					},
+				},
+			},
+		})
+	}(ic)
+}
+
+func (handler *InteractionHandler) AddSearchResults(s *discordgo.Session, ic *discordgo.InteractionCreate) {
+	lang := handler.guildLocale(ic.GuildID)
+
+	values := ic.MessageComponentData().Values
+	if len(values) == 0 {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "😨 Something went wrong..."))
+		return
+	}
+
+	g, err := s.State.Guild(ic.GuildID)
+	if err != nil {
+		handler.logger.Info("failed to get guild", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	key := songListKey(componentInteractionID(ic), ic.Member.User.ID)
+	results := handler.storage.GetSongList(key)
+	if len(results) == 0 {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageSelectionUnavailable))
+		return
+	}
+
+	vs := getUsersVoiceState(g, ic.Member.User)
+	if vs == nil {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageUserNotInVoiceChannel))
+		return
+	}
+
+	songs := make([]*bot.Song, 0, len(values))
+	for _, value := range values {
+		i, err := strconv.Atoi(value)
+		if err != nil || i < 0 || i >= len(results) {
+			continue
+		}
+
+		songs = append(songs, results[i])
+	}
+
+	player := handler.getGuildPlayer(GuildID(g.ID))
+
+	if err := player.AddSong(&ic.Message.ChannelID, &vs.ChannelID, songs...); err != nil {
+		if errors.Is(err, bot.ErrQueueFull) {
+			InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageQueueFull))
+			return
+		}
+
+		handler.logger.Info("failed to add songs", zap.Error(err))
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "😨 Failed to add songs"))
+		return
+	}
+
+	handler.storage.DeleteSongList(key)
+
+	embeds := make([]*discordgo.MessageEmbed, 0, len(songs))
+	for _, song := range songs {
+		embeds = append(embeds, GenerateAddedSongEmbed(lang, song, ic.Member))
+	}
+
+	// the picker is replaced, so it cannot be used again
+	InteractionRespond(handler.logger, s, ic.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseUpdateMessage,
+		Data: &discordgo.InteractionResponseData{
+			Embeds:     embeds,
+			Components: []discordgo.MessageComponent{},
+		},
+	})
+}
+
+// songListKey identifies the songs saved in the InteractionStorage for
+// a single interaction and user, so users picking songs at the same time do
+// not overwrite each other's lists.
+func songListKey(interactionID, userID string) string {
+	return interactionID + ":" + userID
+}
+
+func componentCustomID(name, interactionID string) string {
+	return name + ":" + interactionID
+}
+
+// componentInteractionID returns the ID of the interaction, which created
+// the message component.
+func componentInteractionID(ic *discordgo.InteractionCreate) string {
+	_, interactionID, _ := strings.Cut(ic.MessageComponentData().CustomID, ":")
+	return interactionID
+}
+
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+
+	return string(runes[:length-1]) + "…"
+}
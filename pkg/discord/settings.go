@@ -0,0 +1,195 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/locale"
+	"github.com/Trojan295/discord-airplay/pkg/sources"
+	"github.com/bwmarrin/discordgo"
+	"go.uber.org/zap"
+)
+
+func (handler *InteractionHandler) Settings(s *discordgo.Session, ic *discordgo.InteractionCreate, opt *discordgo.ApplicationCommandInteractionDataOption) {
+	g, err := s.State.Guild(ic.GuildID)
+	if err != nil {
+		handler.logger.Info("failed to get guild", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	lang := handler.guildLocale(ic.GuildID)
+
+	if len(opt.Options) == 0 {
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	subcommand := opt.Options[0]
+
+	key := ""
+	if keyOpt := subcommand.GetOption("key"); keyOpt != nil {
+		key = keyOpt.StringValue()
+	}
+
+	if subcommand.Name != "get" && !canManageGuild(ic.Member) {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageMissingManageServerPermission))
+		return
+	}
+
+	player := handler.getGuildPlayer(GuildID(g.ID))
+
+	if subcommand.Name == "get" {
+		settings, err := player.GetSettings()
+		if err != nil {
+			handler.logger.Error("failed to get settings", zap.Error(err))
+			InteractionRespondServerError(handler.logger, s, ic.Interaction)
+			return
+		}
+
+		keys := bot.SettingKeys()
+		if key != "" {
+			keys = []string{key}
+		}
+
+		embed, err := generateSettingsEmbed(lang, settings, keys)
+		if err != nil {
+			InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷🏽 %v", err))
+			return
+		}
+
+		InteractionRespond(handler.logger, s, ic.Interaction, &discordgo.InteractionResponse{
+			Type: discordgo.InteractionResponseChannelMessageWithSource,
+			Data: &discordgo.InteractionResponseData{
+				Embeds: []*discordgo.MessageEmbed{embed},
+			},
+		})
+		return
+	}
+
+	// the settings are changed in a single update, so concurrent changes of
+	// other settings are not lost
+	value := ""
+	err = player.UpdateSettings(func(settings *bot.GuildSettings) error {
+		switch subcommand.Name {
+		case "set":
+			if err := settings.Set(key, subcommand.GetOption("value").StringValue()); err != nil {
+				return err
+			}
+
+		case "reset":
+			if key == "" {
+				*settings = *bot.DefaultGuildSettings()
+				return nil
+			}
+			if err := settings.Reset(key); err != nil {
+				return err
+			}
+
+		default:
+			return fmt.Errorf("unknown subcommand %s", subcommand.Name)
+		}
+
+		value, _ = settings.Get(key)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, bot.ErrInvalidSettingValue) || errors.Is(err, bot.ErrUnknownSetting) {
+			InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "🤷🏽 %v", err))
+			return
+		}
+
+		handler.logger.Error("failed to save settings", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return
+	}
+
+	if key == "" {
+		InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "⚙️ Restored default settings"))
+		return
+	}
+
+	InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, "⚙️ **%s** is now `%s`", key, formatSettingValue(value)))
+}
+
+// checkDJ responds with an error message and returns false, when a DJ role
+// is configured and the member is neither a DJ nor a server manager.
+func (handler *InteractionHandler) checkDJ(s *discordgo.Session, ic *discordgo.InteractionCreate, player *bot.GuildPlayer) bool {
+	lang := handler.guildLocale(ic.GuildID)
+
+	settings, err := player.GetSettings()
+	if err != nil {
+		handler.logger.Error("failed to get settings", zap.Error(err))
+		InteractionRespondServerError(handler.logger, s, ic.Interaction)
+		return false
+	}
+
+	if settings.DJRole == "" || canManageGuild(ic.Member) {
+		return true
+	}
+
+	for _, role := range ic.Member.Roles {
+		if role == settings.DJRole {
+			return true
+		}
+	}
+
+	InteractionRespondMessage(handler.logger, s, ic.Interaction, locale.Sprintf(lang, MessageMissingDJRole))
+	return false
+}
+
+func canManageGuild(member *discordgo.Member) bool {
+	return member.Permissions&discordgo.PermissionManageGuild != 0
+}
+
+func generateSettingsEmbed(lang string, settings *bot.GuildSettings, keys []string) (*discordgo.MessageEmbed, error) {
+	builder := strings.Builder{}
+
+	for _, key := range keys {
+		value, err := settings.Get(key)
+		if err != nil {
+			return nil, err
+		}
+
+		builder.WriteString(fmt.Sprintf("**%s**: `%s`\n", key, formatSettingValue(value)))
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       locale.Sprintf(lang, "⚙️  Settings"),
+		Description: strings.TrimSpace(builder.String()),
+	}, nil
+}
+
+func formatSettingValue(value string) string {
+	if value == "" {
+		return "none"
+	}
+
+	return value
+}
+
+// guildLocale returns the locale of the messages sent to the guild.
+func (handler *InteractionHandler) guildLocale(guildID string) string {
+	settings, err := handler.getGuildPlayer(GuildID(guildID)).GetSettings()
+	if err != nil {
+		handler.logger.Info("failed to get settings", zap.Error(err))
+		return locale.Default
+	}
+
+	return settings.Locale
+}
+
+// lookupContext returns the context for song lookups, which uses the search
+// backends configured for the guild.
+func (handler *InteractionHandler) lookupContext(player *bot.GuildPlayer) context.Context {
+	settings, err := player.GetSettings()
+	if err != nil {
+		handler.logger.Info("failed to get settings", zap.Error(err))
+		return handler.ctx
+	}
+
+	return sources.WithSearchBackends(handler.ctx, settings.SearchBackend, settings.SearchFallback)
+}
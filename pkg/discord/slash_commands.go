@@ -1,19 +1,36 @@
 package discord
 
-import "github.com/bwmarrin/discordgo"
+import (
+	"strings"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/bwmarrin/discordgo"
+)
 
 type SlashCommandRouter struct {
 	commandPrefix string
 
-	playHandler       func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
-	stopHandler       func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
-	listHandler       func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
-	skipHandler       func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
-	removeHandler     func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
-	playingNowHandler func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
-	djHandler         func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	playHandler        func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	stopHandler        func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	listHandler        func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	skipHandler        func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	removeHandler      func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	playingNowHandler  func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	djHandler          func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	exportHandler      func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	importHandler      func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	shuffleHandler     func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	moveHandler        func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	settingsHandler    func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	searchHandler      func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	failedHandler      func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	chapterHandler     func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+	diagnosticsHandler func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
+
+	playAutocompleteHandler func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)
 
 	addSongOrPlaylistHandler func(*discordgo.Session, *discordgo.InteractionCreate)
+	searchResultHandler      func(*discordgo.Session, *discordgo.InteractionCreate)
 }
 
 func NewSlashCommandRouter(commandPrefix string) *SlashCommandRouter {
@@ -27,6 +44,11 @@ func (ch *SlashCommandRouter) PlayHandler(h func(*discordgo.Session, *discordgo.
 	return ch
 }
 
+func (ch *SlashCommandRouter) PlayAutocompleteHandler(h func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)) *SlashCommandRouter {
+	ch.playAutocompleteHandler = h
+	return ch
+}
+
 func (ch *SlashCommandRouter) StopHandler(h func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)) *SlashCommandRouter {
 	ch.stopHandler = h
 	return ch
@@ -57,11 +79,61 @@ func (ch *SlashCommandRouter) DJHandler(h func(*discordgo.Session, *discordgo.In
 	return ch
 }
 
+func (ch *SlashCommandRouter) ExportHandler(h func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)) *SlashCommandRouter {
+	ch.exportHandler = h
+	return ch
+}
+
+func (ch *SlashCommandRouter) ImportHandler(h func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)) *SlashCommandRouter {
+	ch.importHandler = h
+	return ch
+}
+
+func (ch *SlashCommandRouter) ShuffleHandler(h func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)) *SlashCommandRouter {
+	ch.shuffleHandler = h
+	return ch
+}
+
+func (ch *SlashCommandRouter) MoveHandler(h func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)) *SlashCommandRouter {
+	ch.moveHandler = h
+	return ch
+}
+
+func (ch *SlashCommandRouter) SettingsHandler(h func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)) *SlashCommandRouter {
+	ch.settingsHandler = h
+	return ch
+}
+
+func (ch *SlashCommandRouter) SearchHandler(h func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)) *SlashCommandRouter {
+	ch.searchHandler = h
+	return ch
+}
+
+func (ch *SlashCommandRouter) FailedHandler(h func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)) *SlashCommandRouter {
+	ch.failedHandler = h
+	return ch
+}
+
+func (ch *SlashCommandRouter) ChapterHandler(h func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)) *SlashCommandRouter {
+	ch.chapterHandler = h
+	return ch
+}
+
+func (ch *SlashCommandRouter) DiagnosticsHandler(h func(*discordgo.Session, *discordgo.InteractionCreate, *discordgo.ApplicationCommandInteractionDataOption)) *SlashCommandRouter {
+	ch.diagnosticsHandler = h
+	return ch
+}
+
 func (ch *SlashCommandRouter) AddSongOrPlaylistHandler(h func(*discordgo.Session, *discordgo.InteractionCreate)) *SlashCommandRouter {
 	ch.addSongOrPlaylistHandler = h
 	return ch
 }
 
+func (ch *SlashCommandRouter) SearchResultHandler(h func(*discordgo.Session, *discordgo.InteractionCreate)) *SlashCommandRouter {
+	ch.searchResultHandler = h
+	return ch
+}
+
 func (ch *SlashCommandRouter) GetCommandHandlers() map[string]func(*discordgo.Session, *discordgo.InteractionCreate) {
 	return map[string]func(*discordgo.Session, *discordgo.InteractionCreate){
 		ch.commandPrefix: func(s *discordgo.Session, ic *discordgo.InteractionCreate) {
@@ -83,6 +155,40 @@ func (ch *SlashCommandRouter) GetCommandHandlers() map[string]func(*discordgo.Se
 				ch.playingNowHandler(s, ic, option)
 			case "dj":
 				ch.djHandler(s, ic, option)
+			case "export":
+				ch.exportHandler(s, ic, option)
+			case "import":
+				ch.importHandler(s, ic, option)
+			case "shuffle":
+				ch.shuffleHandler(s, ic, option)
+			case "move":
+				ch.moveHandler(s, ic, option)
+			case "settings":
+				ch.settingsHandler(s, ic, option)
+			case "search":
+				ch.searchHandler(s, ic, option)
+			case "failed":
+				ch.failedHandler(s, ic, option)
+			case "chapter":
+				ch.chapterHandler(s, ic, option)
+			case "diagnostics":
+				ch.diagnosticsHandler(s, ic, option)
+			}
+		},
+	}
+}
+
+func (ch *SlashCommandRouter) GetAutocompleteHandlers() map[string]func(*discordgo.Session, *discordgo.InteractionCreate) {
+	return map[string]func(*discordgo.Session, *discordgo.InteractionCreate){
+		ch.commandPrefix: func(s *discordgo.Session, ic *discordgo.InteractionCreate) {
+			options := ic.ApplicationCommandData().Options
+			option := options[0]
+
+			switch option.Name {
+			case "play":
+				if ch.playAutocompleteHandler != nil {
+					ch.playAutocompleteHandler(s, ic, option)
+				}
 			}
 		},
 	}
@@ -91,10 +197,26 @@ func (ch *SlashCommandRouter) GetCommandHandlers() map[string]func(*discordgo.Se
 func (ch *SlashCommandRouter) GetComponentHandlers() map[string]func(*discordgo.Session, *discordgo.InteractionCreate) {
 	return map[string]func(*discordgo.Session, *discordgo.InteractionCreate){
 		"add_song_playlist": ch.addSongOrPlaylistHandler,
+		"search_result":     ch.searchResultHandler,
 	}
 }
 
+// ComponentName returns the name of the component handler for the custom ID
+// of a message component, which can carry the ID of the interaction it
+// belongs to, e.g. `search_result:<interaction ID>`.
+func ComponentName(customID string) string {
+	name, _, _ := strings.Cut(customID, ":")
+	return name
+}
+
 func (ch *SlashCommandRouter) GetSlashCommands() []*discordgo.ApplicationCommand {
+	settingKeyChoices := make([]*discordgo.ApplicationCommandOptionChoice, 0)
+	for _, key := range bot.SettingKeys() {
+		settingKeyChoices = append(settingKeyChoices, &discordgo.ApplicationCommandOptionChoice{Name: key, Value: key})
+	}
+
+	minSearchResults := 1.0
+
 	return []*discordgo.ApplicationCommand{
 		{
 			Name:        ch.commandPrefix,
@@ -104,13 +226,40 @@ func (ch *SlashCommandRouter) GetSlashCommands() []*discordgo.ApplicationCommand
 					Type:        discordgo.ApplicationCommandOptionSubCommand,
 					Name:        "play",
 					Description: "Add a song to the playlist",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:         discordgo.ApplicationCommandOptionString,
+							Name:         "input",
+							Description:  "URL or name of the track",
+							Required:     true,
+							Autocomplete: true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionBoolean,
+							Name:        "chapters",
+							Description: "Add every chapter of the video as a separate song",
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "search",
+					Description: "Search for songs and pick, which to add to the playlist",
 					Options: []*discordgo.ApplicationCommandOption{
 						{
 							Type:        discordgo.ApplicationCommandOptionString,
-							Name:        "input",
-							Description: "URL or name of the track",
+							Name:        "query",
+							Description: "Name of the track",
 							Required:    true,
 						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "results",
+							Description: "Number of results to show",
+							Required:    false,
+							MinValue:    &minSearchResults,
+							MaxValue:    maxSearchResults,
+						},
 					},
 				},
 				{
@@ -126,6 +275,30 @@ func (ch *SlashCommandRouter) GetSlashCommands() []*discordgo.ApplicationCommand
 						},
 					},
 				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "move",
+					Description: "Move song to another position in the playlist",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "from",
+							Description: "Current position of the song in the playlist",
+							Required:    true,
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionInteger,
+							Name:        "to",
+							Description: "New position of the song in the playlist",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "shuffle",
+					Description: "Shuffle the playlist",
+				},
 				{
 					Type:        discordgo.ApplicationCommandOptionSubCommand,
 					Name:        "skip",
@@ -146,6 +319,29 @@ func (ch *SlashCommandRouter) GetSlashCommands() []*discordgo.ApplicationCommand
 					Name:        "playing",
 					Description: "Get currently playing song",
 				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "chapter",
+					Description: "Jump to a chapter of the current song",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "chapter",
+							Description: "next, prev or the number of the chapter",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "failed",
+					Description: "List the songs, which recently failed to play",
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "diagnostics",
+					Description: "Show the yt-dlp version and the running downloads",
+				},
 				{
 					Type:        discordgo.ApplicationCommandOptionSubCommand,
 					Name:        "dj",
@@ -165,6 +361,92 @@ func (ch *SlashCommandRouter) GetSlashCommands() []*discordgo.ApplicationCommand
 						},
 					},
 				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "export",
+					Description: "Export the playlist to a file",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionString,
+							Name:        "format",
+							Description: "File format",
+							Required:    false,
+							Choices: []*discordgo.ApplicationCommandOptionChoice{
+								{Name: "M3U", Value: "m3u"},
+								{Name: "XSPF", Value: "xspf"},
+								{Name: "JSON", Value: "json"},
+							},
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommand,
+					Name:        "import",
+					Description: "Add songs from a M3U, XSPF or JSON playlist file",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionAttachment,
+							Name:        "file",
+							Description: "Playlist file",
+							Required:    true,
+						},
+					},
+				},
+				{
+					Type:        discordgo.ApplicationCommandOptionSubCommandGroup,
+					Name:        "settings",
+					Description: "Manage the settings of this server",
+					Options: []*discordgo.ApplicationCommandOption{
+						{
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Name:        "get",
+							Description: "Show the settings",
+							Options: []*discordgo.ApplicationCommandOption{
+								{
+									Type:        discordgo.ApplicationCommandOptionString,
+									Name:        "key",
+									Description: "Setting name",
+									Required:    false,
+									Choices:     settingKeyChoices,
+								},
+							},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Name:        "set",
+							Description: "Change a setting",
+							Options: []*discordgo.ApplicationCommandOption{
+								{
+									Type:        discordgo.ApplicationCommandOptionString,
+									Name:        "key",
+									Description: "Setting name",
+									Required:    true,
+									Choices:     settingKeyChoices,
+								},
+								{
+									Type:        discordgo.ApplicationCommandOptionString,
+									Name:        "value",
+									Description: "New value",
+									Required:    true,
+								},
+							},
+						},
+						{
+							Type:        discordgo.ApplicationCommandOptionSubCommand,
+							Name:        "reset",
+							Description: "Restore a setting to its default value",
+							Options: []*discordgo.ApplicationCommandOption{
+								{
+									Type:        discordgo.ApplicationCommandOptionString,
+									Name:        "key",
+									Description: "Setting name, all settings are reset if empty",
+									Required:    false,
+									Choices:     settingKeyChoices,
+								},
+							},
+						},
+					},
+				},
 			},
 		},
 	}
@@ -1,25 +1,85 @@
 package discord
 
-import "github.com/Trojan295/discord-airplay/pkg/bot"
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+// songListTTL is how long a song list waits for the user to pick from it.
+const songListTTL = time.Hour
+
+type savedSongList struct {
+	songs   []*bot.Song
+	savedAt time.Time
+}
 
 type InMemoryInteractionStorage struct {
-	songsToAdd map[string][]*bot.Song
+	mutex      sync.Mutex
+	songsToAdd map[string]savedSongList
 }
 
 func NewInMemoryStorage() *InMemoryInteractionStorage {
 	return &InMemoryInteractionStorage{
-		songsToAdd: make(map[string][]*bot.Song),
+		songsToAdd: make(map[string]savedSongList),
 	}
 }
 
-func (s *InMemoryInteractionStorage) SaveSongList(channelID string, list []*bot.Song) {
-	s.songsToAdd[channelID] = list
+func (s *InMemoryInteractionStorage) SaveSongList(key string, list []*bot.Song) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for k, saved := range s.songsToAdd {
+		if now.Sub(saved.savedAt) > songListTTL {
+			delete(s.songsToAdd, k)
+		}
+	}
+
+	s.songsToAdd[key] = savedSongList{songs: list, savedAt: now}
 }
 
-func (s *InMemoryInteractionStorage) DeleteSongList(channelID string) {
-	delete(s.songsToAdd, channelID)
+func (s *InMemoryInteractionStorage) DeleteSongList(key string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.songsToAdd, key)
 }
 
-func (s *InMemoryInteractionStorage) GetSongList(channelID string) []*bot.Song {
-	return s.songsToAdd[channelID]
+func (s *InMemoryInteractionStorage) GetSongList(key string) []*bot.Song {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	saved, ok := s.songsToAdd[key]
+	if !ok || time.Since(saved.savedAt) > songListTTL {
+		return nil
+	}
+
+	return saved.songs
+}
+
+func (s *InMemoryInteractionStorage) GetUserSongLists(userID string) [][]*bot.Song {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	saved := make([]savedSongList, 0)
+	for key, list := range s.songsToAdd {
+		if strings.HasSuffix(key, ":"+userID) && time.Since(list.savedAt) <= songListTTL {
+			saved = append(saved, list)
+		}
+	}
+
+	sort.Slice(saved, func(i, j int) bool {
+		return saved[i].savedAt.After(saved[j].savedAt)
+	})
+
+	lists := make([][]*bot.Song, len(saved))
+	for i, list := range saved {
+		lists[i] = list.songs
+	}
+
+	return lists
 }
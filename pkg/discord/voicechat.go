@@ -15,6 +15,8 @@ type DiscordVoiceChatSession struct {
 	guildID        string
 
 	voiceConnection *discordgo.VoiceConnection
+	// bitrate of the joined voice channel in bits per second
+	bitrate int
 }
 
 func (session *DiscordVoiceChatSession) Close() error {
@@ -62,9 +64,23 @@ func (session *DiscordVoiceChatSession) JoinVoiceChannel(channelID string) error
 
 	session.voiceConnection = vc
 
+	channel, err := session.discordSession.State.Channel(channelID)
+	if err != nil {
+		channel, err = session.discordSession.Channel(channelID)
+	}
+	if err == nil {
+		session.bitrate = channel.Bitrate
+	}
+
 	return nil
 }
 
+// GetBitrate returns the bitrate of the joined voice channel or zero, if it
+// is not known.
+func (session *DiscordVoiceChatSession) GetBitrate() int {
+	return session.bitrate
+}
+
 func (session *DiscordVoiceChatSession) LeaveVoiceChannel() error {
 	if session.voiceConnection == nil {
 		return nil
@@ -75,6 +91,7 @@ func (session *DiscordVoiceChatSession) LeaveVoiceChannel() error {
 	}
 
 	session.voiceConnection = nil
+	session.bitrate = 0
 
 	return nil
 }
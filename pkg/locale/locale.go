@@ -0,0 +1,36 @@
+// Package locale translates the messages of the bot. The messages are looked
+// up by their English format strings, so a missing translation falls back to
+// English.
+package locale
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Default is the locale of the messages, which are not translated.
+const Default = "en-US"
+
+// Tags returns the supported locales in alphabetical order.
+func Tags() []string {
+	tags := []string{Default}
+	for tag := range translations {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Sprintf formats the translation of the English format string in the
+// locale. Unknown locales and messages use the English format string.
+func Sprintf(tag, format string, args ...any) string {
+	if translated, ok := translations[tag][format]; ok {
+		format = translated
+	}
+
+	if len(args) == 0 {
+		return format
+	}
+
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,87 @@
+package locale
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+var verbPattern = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestTranslationsKeepVerbs(t *testing.T) {
+	for tag, catalog := range translations {
+		for format, translated := range catalog {
+			want := verbPattern.FindAllString(format, -1)
+			got := verbPattern.FindAllString(translated, -1)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %q has the verbs %v, want %v", tag, translated, got, want)
+			}
+		}
+	}
+}
+
+func TestSprintf(t *testing.T) {
+	tests := []struct {
+		name   string
+		tag    string
+		format string
+		args   []any
+		want   string
+	}{
+		{
+			name:   "default locale",
+			tag:    Default,
+			format: "💾 Exported %d songs",
+			args:   []any{3},
+			want:   "💾 Exported 3 songs",
+		},
+		{
+			name:   "translated",
+			tag:    "de-DE",
+			format: "💾 Exported %d songs",
+			args:   []any{3},
+			want:   "💾 3 Songs exportiert",
+		},
+		{
+			name:   "without args",
+			tag:    "de-DE",
+			format: "🔀 Shuffled playlist",
+			want:   "🔀 Playlist gemischt",
+		},
+		{
+			name:   "unknown locale",
+			tag:    "xx-XX",
+			format: "💾 Exported %d songs",
+			args:   []any{3},
+			want:   "💾 Exported 3 songs",
+		},
+		{
+			name:   "missing translation",
+			tag:    "de-DE",
+			format: "%d%% done",
+			args:   []any{50},
+			want:   "50% done",
+		},
+		{
+			name:   "percent sign without args",
+			tag:    Default,
+			format: "100%",
+			want:   "100%",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sprintf(tt.tag, tt.format, tt.args...); got != tt.want {
+				t.Errorf("Sprintf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	want := []string{"de-DE", "en-US"}
+	if got := Tags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tags() = %v, want %v", got, want)
+	}
+}
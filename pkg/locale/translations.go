@@ -0,0 +1,84 @@
+package locale
+
+// translations maps the English format strings to their translations. The
+// translations keep the emojis and the verbs of the English messages.
+var translations = map[string]map[string]string{
+	"de-DE": {
+		// replies to commands
+		"🤷 You are not in a voice channel. Join a voice channel to play a song.":  "🤷 Du bist in keinem Sprachkanal. Tritt einem Sprachkanal bei, um einen Song abzuspielen.",
+		"🤷🏽 You are not in a voice channel. Join a voice channel to play a song.": "🤷🏽 Du bist in keinem Sprachkanal. Tritt einem Sprachkanal bei, um einen Song abzuspielen.",
+		"😨 You cannot request a playlist longer than 20 songs.":                   "😨 Eine Playlist darf höchstens 20 Songs lang sein.",
+		"😨 Failed to generate playlist.":                                          "😨 Die Playlist konnte nicht erstellt werden.",
+		"😨 Failed to import playlist file.":                                       "😨 Die Playlist-Datei konnte nicht importiert werden.",
+		"😨 The playlist file is too large.":                                       "😨 Die Playlist-Datei ist zu groß.",
+		"🈵 The queue is full. Wait until some songs finish playing.":              "🈵 Die Warteschlange ist voll. Warte, bis einige Songs zu Ende gespielt sind.",
+		"🤷 This selection has expired or was requested by someone else.":          "🤷 Diese Auswahl ist abgelaufen oder wurde von jemand anderem angefordert.",
+		"🔒 You need the Manage Server permission to change the settings.":         "🔒 Du brauchst die Berechtigung „Server verwalten“, um die Einstellungen zu ändern.",
+		"🔒 Only DJs can control the playback.":                                    "🔒 Nur DJs können die Wiedergabe steuern.",
+		"😨 Something went wrong...":                                               "😨 Etwas ist schiefgelaufen...",
+		"😨 Failed to add song":                                                    "😨 Der Song konnte nicht hinzugefügt werden",
+		"😨 Failed to add songs":                                                   "😨 Die Songs konnten nicht hinzugefügt werden",
+		"➕ Added %d songs to playlist":                                            "➕ %d Songs zur Playlist hinzugefügt",
+		"⏳ Generating playlist...":                                                "⏳ Playlist wird erstellt...",
+		"⏹️  Stopped playing":                                                     "⏹️  Wiedergabe gestoppt",
+		"⏭️ Skipped song":                                                         "⏭️ Song übersprungen",
+		"🫙 Playlist is empty":                                                     "🫙 Die Playlist ist leer",
+		"👌 No songs failed to play":                                               "👌 Alle Songs wurden fehlerfrei abgespielt",
+		"🤷 No diagnostics available":                                              "🤷 Keine Diagnose verfügbar",
+		"🤷🏽 Invalid position":                                                     "🤷🏽 Ungültige Position",
+		"🗑️ Removed song **%v** from playlist":                                    "🗑️ Song **%v** aus der Playlist entfernt",
+		"↕️ Moved song **%v** to position %d":                                     "↕️ Song **%v** an Position %d verschoben",
+		"🔀 Shuffled playlist":                                                     "🔀 Playlist gemischt",
+		"🔇 No song is being played right now...":                                  "🔇 Gerade wird kein Song abgespielt...",
+		"🤷 Expected next, prev or the number of the chapter":                      "🤷 Erwartet wird next, prev oder die Nummer des Kapitels",
+		"🤷 The song has no chapters":                                              "🤷 Der Song hat keine Kapitel",
+		"🤷 The song has %d chapters":                                              "🤷 Der Song hat %d Kapitel",
+		"🤷 The song cannot be seeked":                                             "🤷 In diesem Song kann nicht gesprungen werden",
+		"📖 Playing chapter %d: %s":                                                "📖 Spiele Kapitel %d: %s",
+		"🤷🏽 Unknown playlist format":                                              "🤷🏽 Unbekanntes Playlist-Format",
+		"🤷🏽 Missing playlist file":                                                "🤷🏽 Die Playlist-Datei fehlt",
+		"💾 Exported %d songs":                                                     "💾 %d Songs exportiert",
+		"🔎 Found %d songs for \"%s\". Which should I add?":                        "🔎 %d Songs für „%s“ gefunden. Welche soll ich hinzufügen?",
+		"Pick the songs to add":                                                   "Wähle die Songs aus, die hinzugefügt werden sollen",
+		"Add song":                                                                "Song hinzufügen",
+		"Add whole playlist":                                                      "Ganze Playlist hinzufügen",
+		"⚙️ Restored default settings":                                            "⚙️ Standardeinstellungen wiederhergestellt",
+		"⚙️ **%s** is now `%s`":                                                   "⚙️ **%s** ist jetzt `%s`",
+		"⏳ Loading songs... %d/%d":                                                "⏳ Songs werden geladen... %d/%d",
+		"⚠️ Removed %d songs, which cannot be played: %s":                         "⚠️ %d Songs entfernt, die nicht abgespielt werden können: %s",
+		"and %d more": "und %d weitere",
+
+		// embeds
+		"🎵  Adding song to queue...": "🎵  Song wird zur Warteschlange hinzugefügt...",
+		"🎵  Added to queue.":         "🎵  Zur Warteschlange hinzugefügt.",
+		"Added to queue":             "Zur Warteschlange hinzugefügt",
+		"Added chapters of %s":       "Kapitel von %s hinzugefügt",
+		"Duration":                   "Dauer",
+		"Requested by %s":            "Angefordert von %s",
+		"Playlist:":                  "Playlist:",
+		"Failed songs:":              "Fehlgeschlagene Songs:",
+		"⚙️  Settings":               "⚙️  Einstellungen",
+		"👀  The song is part of a playlist, which contains %d songs. What should I do?":                            "👀  Der Song ist Teil einer Playlist mit %d Songs. Was soll ich tun?",
+		"📂  Imported %d songs from %s":                                                                             "📂  %d Songs aus %s importiert",
+		"Skipped %d songs, which could not be found.":                                                              "%d Songs übersprungen, die nicht gefunden wurden.",
+		"Skipped the last %d songs, which do not fit in the queue.":                                                "Die letzten %d Songs übersprungen, die nicht in die Warteschlange passen.",
+		"😨 Could not find any playable songs.":                                                                     "😨 Es wurden keine abspielbaren Songs gefunden.",
+		"🔞 Failed to add song. It is age-restricted and needs the cookies of an account, which can watch it.":      "🔞 Der Song konnte nicht hinzugefügt werden. Er ist altersbeschränkt und braucht die Cookies eines Kontos, das ihn ansehen darf.",
+		"🔒 Failed to add song. It is members-only or private and needs the credentials of an account with access.": "🔒 Der Song konnte nicht hinzugefügt werden. Er ist nur für Mitglieder oder privat und braucht die Zugangsdaten eines Kontos mit Zugriff.",
+		"🌍 Failed to add song. It is not available in this country.":                                               "🌍 Der Song konnte nicht hinzugefügt werden. Er ist in diesem Land nicht verfügbar.",
+		"🗑️ Failed to add song. It was removed or is private.":                                                     "🗑️ Der Song konnte nicht hinzugefügt werden. Er wurde entfernt oder ist privat.",
+		"🚫 Failed to add song. Streams on private addresses cannot be played.":                                     "🚫 Der Song konnte nicht hinzugefügt werden. Streams auf privaten Adressen können nicht abgespielt werden.",
+		"😨  Failed to add song.":                                                                                   "😨  Der Song konnte nicht hinzugefügt werden.",
+
+		// messages in the text channel
+		"🌍 This song is not available in the bot's country.":           "🌍 Dieser Song ist im Land des Bots nicht verfügbar.",
+		"🔞 This song is age-restricted and cannot be played.":          "🔞 Dieser Song ist altersbeschränkt und kann nicht abgespielt werden.",
+		"🔒 This song is members-only or private and cannot be played.": "🔒 Dieser Song ist nur für Mitglieder oder privat und kann nicht abgespielt werden.",
+		"🗑️ This song was removed or is private.":                      "🗑️ Dieser Song wurde entfernt oder ist privat.",
+		"📡 The song stopped playing because of a network error.":       "📡 Der Song wurde wegen eines Netzwerkfehlers unterbrochen.",
+		"✂️ The song stopped playing before its end.":                  "✂️ Der Song wurde vor seinem Ende unterbrochen.",
+		"😨 The song failed to play.":                                   "😨 Der Song konnte nicht abgespielt werden.",
+		"⏭️ Skipped %s, it cannot be played.":                          "⏭️ %s übersprungen, der Song kann nicht abgespielt werden.",
+		"⏹️ Stopped playing, because %d songs failed in a row.":        "⏹️ Wiedergabe gestoppt, weil %d Songs nacheinander fehlgeschlagen sind.",
+	},
+}
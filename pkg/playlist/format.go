@@ -0,0 +1,117 @@
+package playlist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+type Format string
+
+const (
+	FormatM3U  Format = "m3u"
+	FormatXSPF Format = "xspf"
+	FormatJSON Format = "json"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown playlist format")
+	ErrEmptyPlaylist = errors.New("playlist is empty")
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "m3u", "m3u8":
+		return FormatM3U, nil
+	case "xspf":
+		return FormatXSPF, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+func (f Format) Extension() string {
+	switch f {
+	case FormatM3U:
+		return "m3u8"
+	default:
+		return string(f)
+	}
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case FormatM3U:
+		return "audio/x-mpegurl"
+	case FormatXSPF:
+		return "application/xspf+xml"
+	default:
+		return "application/json"
+	}
+}
+
+func Export(format Format, songs []*bot.Song) ([]byte, error) {
+	switch format {
+	case FormatM3U:
+		return exportM3U(songs)
+	case FormatXSPF:
+		return exportXSPF(songs)
+	case FormatJSON:
+		return exportJSON(songs)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// Import parses a playlist file. The format is picked by the file extension
+// and falls back to sniffing the content.
+func Import(filename string, data []byte) ([]*bot.Song, error) {
+	format, err := ParseFormat(strings.TrimPrefix(filepath.Ext(filename), "."))
+	if err != nil {
+		format = detectFormat(data)
+	}
+
+	var songs []*bot.Song
+	switch format {
+	case FormatXSPF:
+		songs, err = importXSPF(data)
+	case FormatJSON:
+		songs, err = importJSON(data)
+	default:
+		songs, err = importM3U(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("while parsing %s playlist: %w", format, err)
+	}
+
+	if len(songs) == 0 {
+		return nil, ErrEmptyPlaylist
+	}
+
+	return songs, nil
+}
+
+// HasMetadata reports if the imported song has enough data to be played
+// without looking it up again.
+func HasMetadata(song *bot.Song) bool {
+	return song.Title != "" && (song.Duration > 0 || song.Live)
+}
+
+func detectFormat(data []byte) Format {
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case bytes.HasPrefix(data, []byte("{")):
+		return FormatJSON
+	case bytes.HasPrefix(data, []byte("<")):
+		return FormatXSPF
+	default:
+		return FormatM3U
+	}
+}
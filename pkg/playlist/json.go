@@ -0,0 +1,146 @@
+package playlist
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+const jsonPlaylistVersion = 1
+
+type jsonPlaylist struct {
+	Version int        `json:"version"`
+	Songs   []jsonSong `json:"songs"`
+}
+
+type jsonSong struct {
+	Type          string  `json:"type,omitempty"`
+	Title         string  `json:"title,omitempty"`
+	Artist        string  `json:"artist,omitempty"`
+	Album         string  `json:"album,omitempty"`
+	URL           string  `json:"url"`
+	ThumbnailURL  *string `json:"thumbnail_url,omitempty"`
+	DurationMs    int64   `json:"duration_ms,omitempty"`
+	StartPosition int64   `json:"start_position_ms,omitempty"`
+	EndPosition   int64   `json:"end_position_ms,omitempty"`
+	RequestedBy   *string `json:"requested_by,omitempty"`
+	Live          bool    `json:"live,omitempty"`
+
+	Chapters []jsonChapter `json:"chapters,omitempty"`
+	Segments []jsonSegment `json:"segments,omitempty"`
+}
+
+type jsonChapter struct {
+	Title   string `json:"title"`
+	StartMs int64  `json:"start_ms"`
+	EndMs   int64  `json:"end_ms"`
+}
+
+type jsonSegment struct {
+	StartMs  int64  `json:"start_ms"`
+	EndMs    int64  `json:"end_ms"`
+	Category string `json:"category,omitempty"`
+}
+
+func exportJSON(songs []*bot.Song) ([]byte, error) {
+	playlist := jsonPlaylist{
+		Version: jsonPlaylistVersion,
+		Songs:   make([]jsonSong, 0, len(songs)),
+	}
+
+	for _, song := range songs {
+		s := jsonSong{
+			Type:          song.Type,
+			Title:         song.Title,
+			Artist:        song.Artist,
+			Album:         song.Album,
+			URL:           song.URL,
+			ThumbnailURL:  song.ThumbnailURL,
+			DurationMs:    song.Duration.Milliseconds(),
+			StartPosition: song.StartPosition.Milliseconds(),
+			EndPosition:   song.EndPosition.Milliseconds(),
+			RequestedBy:   song.RequestedBy,
+			Live:          song.Live,
+		}
+
+		for _, chapter := range song.Chapters {
+			s.Chapters = append(s.Chapters, jsonChapter{
+				Title:   chapter.Title,
+				StartMs: chapter.Start.Milliseconds(),
+				EndMs:   chapter.End.Milliseconds(),
+			})
+		}
+
+		for _, segment := range song.Segments {
+			s.Segments = append(s.Segments, jsonSegment{
+				StartMs:  segment.Start.Milliseconds(),
+				EndMs:    segment.End.Milliseconds(),
+				Category: segment.Category,
+			})
+		}
+
+		playlist.Songs = append(playlist.Songs, s)
+	}
+
+	data, err := json.MarshalIndent(playlist, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("while marshaling JSON: %w", err)
+	}
+
+	return data, nil
+}
+
+func importJSON(data []byte) ([]*bot.Song, error) {
+	var playlist jsonPlaylist
+	if err := json.Unmarshal(data, &playlist); err != nil {
+		return nil, fmt.Errorf("while unmarshaling JSON: %w", err)
+	}
+
+	if playlist.Version > jsonPlaylistVersion {
+		return nil, fmt.Errorf("unsupported playlist version %d", playlist.Version)
+	}
+
+	songs := make([]*bot.Song, 0, len(playlist.Songs))
+	for _, s := range playlist.Songs {
+		if s.URL == "" {
+			continue
+		}
+
+		song := &bot.Song{
+			Type:          s.Type,
+			Title:         s.Title,
+			Artist:        s.Artist,
+			Album:         s.Album,
+			URL:           s.URL,
+			Playable:      true,
+			ThumbnailURL:  s.ThumbnailURL,
+			Duration:      time.Duration(s.DurationMs) * time.Millisecond,
+			StartPosition: time.Duration(s.StartPosition) * time.Millisecond,
+			EndPosition:   time.Duration(s.EndPosition) * time.Millisecond,
+			RequestedBy:   s.RequestedBy,
+			Live:          s.Live,
+		}
+
+		for _, chapter := range s.Chapters {
+			song.Chapters = append(song.Chapters, bot.Chapter{
+				Title: chapter.Title,
+				Start: time.Duration(chapter.StartMs) * time.Millisecond,
+				End:   time.Duration(chapter.EndMs) * time.Millisecond,
+			})
+		}
+
+		for _, segment := range s.Segments {
+			song.Segments = append(song.Segments, bot.Segment{
+				Start:    time.Duration(segment.StartMs) * time.Millisecond,
+				End:      time.Duration(segment.EndMs) * time.Millisecond,
+				Category: segment.Category,
+			})
+		}
+
+		songs = append(songs, song)
+	}
+
+	return songs, nil
+}
@@ -0,0 +1,140 @@
+package playlist
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+func TestImportJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []*bot.Song
+		wantErr bool
+	}{
+		{
+			name: "current version",
+			input: `{"version": 1, "songs": [{
+				"type": "yt-dlp",
+				"title": "Around The World",
+				"artist": "Daft Punk",
+				"url": "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+				"duration_ms": 429000,
+				"start_position_ms": 60500,
+				"end_position_ms": 120000,
+				"requested_by": "alice"
+			}]}`,
+			want: []*bot.Song{
+				{
+					Type:          "yt-dlp",
+					Title:         "Around The World",
+					Artist:        "Daft Punk",
+					URL:           "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+					Playable:      true,
+					Duration:      429 * time.Second,
+					StartPosition: 60500 * time.Millisecond,
+					EndPosition:   2 * time.Minute,
+					RequestedBy:   strPtr("alice"),
+				},
+			},
+		},
+		{
+			name:  "missing version",
+			input: `{"songs": [{"url": "https://example.com/a.mp3", "live": true}]}`,
+			want: []*bot.Song{
+				{URL: "https://example.com/a.mp3", Playable: true, Live: true},
+			},
+		},
+		{
+			name:  "empty URLs",
+			input: `{"version": 1, "songs": [{"title": "No URL"}, {"url": "", "title": "Empty"}, {"url": "https://example.com/a.mp3"}]}`,
+			want: []*bot.Song{
+				{URL: "https://example.com/a.mp3", Playable: true},
+			},
+		},
+		{
+			name:    "newer version",
+			input:   `{"version": 2, "songs": [{"url": "https://example.com/a.mp3"}]}`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid JSON",
+			input:   `{"version": 1, "songs": [`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			songs, err := importJSON([]byte(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("importJSON() = %s, want an error", dumpSongs(songs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("importJSON() error = %v", err)
+			}
+			if !reflect.DeepEqual(songs, tt.want) {
+				t.Errorf("importJSON() = %s, want %s", dumpSongs(songs), dumpSongs(tt.want))
+			}
+		})
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	songs := []*bot.Song{
+		{
+			Type:          "yt-dlp",
+			Title:         "Around The World",
+			Artist:        "Daft Punk",
+			Album:         "Homework",
+			URL:           "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+			Playable:      true,
+			ThumbnailURL:  strPtr("https://i.ytimg.com/vi/K0HSD_i2DvA/maxresdefault.jpg"),
+			Duration:      429 * time.Second,
+			StartPosition: 60500 * time.Millisecond,
+			EndPosition:   2 * time.Minute,
+			RequestedBy:   strPtr("alice"),
+			Chapters: []bot.Chapter{
+				{Title: "Intro", Start: 0, End: 30 * time.Second},
+				{Title: "Around The World", Start: 30 * time.Second, End: 429 * time.Second},
+			},
+			Segments: []bot.Segment{
+				{Start: 0, End: 12500 * time.Millisecond, Category: "intro"},
+				{Start: 400 * time.Second, End: 429 * time.Second},
+			},
+		},
+		{Type: "radio", Title: "Test FM", URL: "https://radio.example.com/stream", Playable: true, Live: true},
+	}
+
+	data, err := Export(FormatJSON, songs)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	imported, err := Import("queue.json", data)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if !reflect.DeepEqual(imported, songs) {
+		t.Errorf("Import() = %s, want %s", dumpSongs(imported), dumpSongs(songs))
+	}
+}
+
+func TestImportEmptyPlaylist(t *testing.T) {
+	for _, format := range []Format{FormatM3U, FormatXSPF, FormatJSON} {
+		data, err := Export(format, nil)
+		if err != nil {
+			t.Fatalf("Export(%s) error = %v", format, err)
+		}
+		if _, err := Import("queue."+format.Extension(), data); !errors.Is(err, ErrEmptyPlaylist) {
+			t.Errorf("Import(%s) error = %v, want %v", format, err, ErrEmptyPlaylist)
+		}
+	}
+}
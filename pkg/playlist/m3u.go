@@ -0,0 +1,87 @@
+package playlist
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+const m3uHeader = "#EXTM3U"
+
+func exportM3U(songs []*bot.Song) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(m3uHeader + "\n")
+
+	for _, song := range songs {
+		duration := -1
+		if song.Duration > 0 {
+			duration = int(song.Duration / time.Second)
+		}
+
+		fmt.Fprintf(buf, "#EXTINF:%d,%s\n", duration, strings.ReplaceAll(song.Title, "\n", " "))
+		buf.WriteString(song.URL + "\n")
+	}
+
+	return buf.Bytes(), nil
+}
+
+func importM3U(data []byte) ([]*bot.Song, error) {
+	songs := make([]*bot.Song, 0)
+
+	var pending *bot.Song
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "":
+			continue
+
+		case strings.HasPrefix(line, "#EXTINF:"):
+			pending = parseExtInf(strings.TrimPrefix(line, "#EXTINF:"))
+
+		case strings.HasPrefix(line, "#"):
+			continue
+
+		default:
+			song := pending
+			if song == nil {
+				song = &bot.Song{}
+			}
+			song.URL = line
+			song.Playable = true
+
+			songs = append(songs, song)
+			pending = nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("while reading lines: %w", err)
+	}
+
+	return songs, nil
+}
+
+func parseExtInf(value string) *bot.Song {
+	song := &bot.Song{}
+
+	durationStr, title, found := strings.Cut(value, ",")
+	if found {
+		song.Title = strings.TrimSpace(title)
+	}
+
+	// EXTINF can carry attributes after the duration, e.g. `123 tvg-id="x",Title`
+	durationStr, _, _ = strings.Cut(strings.TrimSpace(durationStr), " ")
+	if seconds, err := strconv.ParseFloat(durationStr, 64); err == nil && seconds > 0 {
+		song.Duration = time.Duration(seconds * float64(time.Second))
+	}
+
+	return song
+}
@@ -0,0 +1,138 @@
+package playlist
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestImportM3U(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []*bot.Song
+	}{
+		{
+			name:  "plain URLs",
+			input: "https://example.com/a.mp3\n\nhttps://example.com/b.mp3\n",
+			want: []*bot.Song{
+				{URL: "https://example.com/a.mp3", Playable: true},
+				{URL: "https://example.com/b.mp3", Playable: true},
+			},
+		},
+		{
+			name:  "extended",
+			input: "#EXTM3U\n#EXTINF:429,Daft Punk - Around The World\nhttps://www.youtube.com/watch?v=K0HSD_i2DvA\n",
+			want: []*bot.Song{
+				{Title: "Daft Punk - Around The World", URL: "https://www.youtube.com/watch?v=K0HSD_i2DvA", Playable: true, Duration: 429 * time.Second},
+			},
+		},
+		{
+			name:  "fractional duration and comma in title",
+			input: "#EXTINF:12.5,Crosby, Stills & Nash\nhttps://example.com/a.mp3\n",
+			want: []*bot.Song{
+				{Title: "Crosby, Stills & Nash", URL: "https://example.com/a.mp3", Playable: true, Duration: 12500 * time.Millisecond},
+			},
+		},
+		{
+			name:  "unknown duration",
+			input: "#EXTINF:-1,Radio\nhttps://radio.example.com/stream\n",
+			want: []*bot.Song{
+				{Title: "Radio", URL: "https://radio.example.com/stream", Playable: true},
+			},
+		},
+		{
+			name:  "attributes",
+			input: "#EXTINF:60 tvg-id=\"x\" group-title=\"y\",Title\nhttps://example.com/a.mp3\n",
+			want: []*bot.Song{
+				{Title: "Title", URL: "https://example.com/a.mp3", Playable: true, Duration: time.Minute},
+			},
+		},
+		{
+			name:  "invalid duration without title",
+			input: "#EXTINF:abc\nhttps://example.com/a.mp3\n",
+			want: []*bot.Song{
+				{URL: "https://example.com/a.mp3", Playable: true},
+			},
+		},
+		{
+			name:  "EXTINF applies only to the next entry",
+			input: "#EXTINF:60,First\n#EXTVLCOPT:network-caching=1000\n  https://example.com/a.mp3  \nhttps://example.com/b.mp3\n",
+			want: []*bot.Song{
+				{Title: "First", URL: "https://example.com/a.mp3", Playable: true, Duration: time.Minute},
+				{URL: "https://example.com/b.mp3", Playable: true},
+			},
+		},
+		{
+			name:  "CRLF line endings",
+			input: "#EXTM3U\r\n#EXTINF:1,A\r\nhttps://example.com/a.mp3\r\n",
+			want: []*bot.Song{
+				{Title: "A", URL: "https://example.com/a.mp3", Playable: true, Duration: time.Second},
+			},
+		},
+		{
+			name:  "only comments",
+			input: "#EXTM3U\n#EXTINF:60,Dangling\n",
+			want:  []*bot.Song{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			songs, err := importM3U([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("importM3U() error = %v", err)
+			}
+			if !reflect.DeepEqual(songs, tt.want) {
+				t.Errorf("importM3U() = %s, want %s", dumpSongs(songs), dumpSongs(tt.want))
+			}
+		})
+	}
+}
+
+func TestM3URoundTrip(t *testing.T) {
+	songs := []*bot.Song{
+		{Title: "Daft Punk - Around The World", URL: "https://www.youtube.com/watch?v=K0HSD_i2DvA", Playable: true, Duration: 429 * time.Second},
+		{Title: "Radio", URL: "https://radio.example.com/stream", Playable: true},
+	}
+
+	data, err := Export(FormatM3U, songs)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	imported, err := Import("queue.m3u8", data)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if !reflect.DeepEqual(imported, songs) {
+		t.Errorf("Import() = %s, want %s", dumpSongs(imported), dumpSongs(songs))
+	}
+}
+
+func TestExportM3UEscapesNewlines(t *testing.T) {
+	data, err := exportM3U([]*bot.Song{{Title: "Line\nbreak", URL: "https://example.com/a.mp3"}})
+	if err != nil {
+		t.Fatalf("exportM3U() error = %v", err)
+	}
+
+	want := "#EXTM3U\n#EXTINF:-1,Line break\nhttps://example.com/a.mp3\n"
+	if string(data) != want {
+		t.Errorf("exportM3U() = %q, want %q", data, want)
+	}
+}
+
+func dumpSongs(songs []*bot.Song) string {
+	data, err := json.MarshalIndent(songs, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
@@ -0,0 +1,95 @@
+package playlist
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+const xspfNamespace = "http://xspf.org/ns/0/"
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Version string      `xml:"version,attr"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location   string `xml:"location"`
+	Title      string `xml:"title,omitempty"`
+	Creator    string `xml:"creator,omitempty"`
+	Album      string `xml:"album,omitempty"`
+	Annotation string `xml:"annotation,omitempty"`
+	Image      string `xml:"image,omitempty"`
+	// Duration is in milliseconds, as required by the spec.
+	Duration int64 `xml:"duration,omitempty"`
+}
+
+func exportXSPF(songs []*bot.Song) ([]byte, error) {
+	playlist := xspfPlaylist{
+		Version: "1",
+		XMLNS:   xspfNamespace,
+		Tracks:  make([]xspfTrack, 0, len(songs)),
+	}
+
+	for _, song := range songs {
+		track := xspfTrack{
+			Location: song.URL,
+			Title:    song.Title,
+			Creator:  song.Artist,
+			Album:    song.Album,
+			Duration: song.Duration.Milliseconds(),
+		}
+		if song.ThumbnailURL != nil {
+			track.Image = *song.ThumbnailURL
+		}
+		if song.RequestedBy != nil {
+			track.Annotation = fmt.Sprintf("Requested by %s", *song.RequestedBy)
+		}
+
+		playlist.Tracks = append(playlist.Tracks, track)
+	}
+
+	data, err := xml.MarshalIndent(playlist, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("while marshaling XSPF: %w", err)
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
+
+func importXSPF(data []byte) ([]*bot.Song, error) {
+	var playlist xspfPlaylist
+	if err := xml.Unmarshal(data, &playlist); err != nil {
+		return nil, fmt.Errorf("while unmarshaling XSPF: %w", err)
+	}
+
+	songs := make([]*bot.Song, 0, len(playlist.Tracks))
+	for _, track := range playlist.Tracks {
+		location := strings.TrimSpace(track.Location)
+		if location == "" {
+			continue
+		}
+
+		song := &bot.Song{
+			Title:    strings.TrimSpace(track.Title),
+			Artist:   strings.TrimSpace(track.Creator),
+			Album:    strings.TrimSpace(track.Album),
+			URL:      location,
+			Playable: true,
+			Duration: time.Duration(track.Duration) * time.Millisecond,
+		}
+		if track.Image != "" {
+			image := track.Image
+			song.ThumbnailURL = &image
+		}
+
+		songs = append(songs, song)
+	}
+
+	return songs, nil
+}
@@ -0,0 +1,121 @@
+package playlist
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+func TestImportXSPF(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []*bot.Song
+		wantErr bool
+	}{
+		{
+			name: "full track",
+			input: `<?xml version="1.0" encoding="UTF-8"?>
+<playlist version="1" xmlns="http://xspf.org/ns/0/">
+  <trackList>
+    <track>
+      <location>https://www.youtube.com/watch?v=K0HSD_i2DvA</location>
+      <title> Around The World </title>
+      <creator>Daft Punk</creator>
+      <album>Homework</album>
+      <image>https://i.ytimg.com/vi/K0HSD_i2DvA/maxresdefault.jpg</image>
+      <duration>429500</duration>
+    </track>
+  </trackList>
+</playlist>`,
+			want: []*bot.Song{
+				{
+					Title:        "Around The World",
+					Artist:       "Daft Punk",
+					Album:        "Homework",
+					URL:          "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+					Playable:     true,
+					ThumbnailURL: strPtr("https://i.ytimg.com/vi/K0HSD_i2DvA/maxresdefault.jpg"),
+					Duration:     429500 * time.Millisecond,
+				},
+			},
+		},
+		{
+			name: "empty and blank locations",
+			input: `<playlist version="1" xmlns="http://xspf.org/ns/0/"><trackList>
+  <track><title>No location</title></track>
+  <track><location>   </location><title>Blank</title></track>
+  <track><location> https://example.com/a.mp3 </location></track>
+</trackList></playlist>`,
+			want: []*bot.Song{
+				{URL: "https://example.com/a.mp3", Playable: true},
+			},
+		},
+		{
+			name:  "no duration",
+			input: `<playlist><trackList><track><location>https://example.com/a.mp3</location><title>A</title></track></trackList></playlist>`,
+			want: []*bot.Song{
+				{Title: "A", URL: "https://example.com/a.mp3", Playable: true},
+			},
+		},
+		{
+			name:    "invalid duration",
+			input:   `<playlist><trackList><track><location>https://example.com/a.mp3</location><duration>3:20</duration></track></trackList></playlist>`,
+			wantErr: true,
+		},
+		{
+			name:    "not XML",
+			input:   `<playlist><trackList>`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			songs, err := importXSPF([]byte(tt.input))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("importXSPF() = %s, want an error", dumpSongs(songs))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("importXSPF() error = %v", err)
+			}
+			if !reflect.DeepEqual(songs, tt.want) {
+				t.Errorf("importXSPF() = %s, want %s", dumpSongs(songs), dumpSongs(tt.want))
+			}
+		})
+	}
+}
+
+func TestXSPFRoundTrip(t *testing.T) {
+	songs := []*bot.Song{
+		{
+			Title:        "Around The World",
+			Artist:       "Daft Punk",
+			Album:        "Homework",
+			URL:          "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+			Playable:     true,
+			ThumbnailURL: strPtr("https://i.ytimg.com/vi/K0HSD_i2DvA/maxresdefault.jpg"),
+			Duration:     429500 * time.Millisecond,
+		},
+		{Title: "Title with <markup> & \"quotes\"", URL: "https://example.com/a.mp3?x=1&y=2", Playable: true},
+	}
+
+	data, err := Export(FormatXSPF, songs)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	// no extension, so the format is detected from the content
+	imported, err := Import("queue", data)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if !reflect.DeepEqual(imported, songs) {
+		t.Errorf("Import() = %s, want %s", dumpSongs(imported), dumpSongs(songs))
+	}
+}
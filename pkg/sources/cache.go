@@ -0,0 +1,446 @@
+package sources
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	cacheFileMagic     = "AIROPUS1"
+	cacheFileExtension = ".opus-frames"
+
+	// cacheDurationTolerance is how much shorter than the song duration the
+	// audio may be, to still be considered complete.
+	cacheDurationTolerance = 2 * time.Second
+)
+
+var ErrInvalidCacheFile = errors.New("invalid cache file")
+
+// AudioCache stores the Opus frames of played songs on disk, so songs played
+// again are streamed without downloading and encoding them. The least
+// recently used songs are evicted, when the cache exceeds its size limit.
+//
+// A cache file starts with cacheFileMagic followed by the frames, each
+// prefixed with its length as a little-endian uint16.
+type AudioCache struct {
+	Logger *slog.Logger
+
+	dir     string
+	maxSize int64
+
+	mutex   sync.Mutex
+	entries map[string]*cacheEntry
+	size    int64
+	hits    int64
+	misses  int64
+}
+
+type cacheEntry struct {
+	size       int64
+	lastAccess time.Time
+}
+
+// CacheStats are the counters of an AudioCache.
+type CacheStats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+	Size    int64
+}
+
+func (s CacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+func NewAudioCache(dir string, maxSize int64) (*AudioCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("while creating cache directory: %w", err)
+	}
+
+	c := &AudioCache{
+		Logger:  slog.Default(),
+		dir:     dir,
+		maxSize: maxSize,
+		entries: make(map[string]*cacheEntry),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("while reading cache directory: %w", err)
+	}
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasSuffix(name, cacheFileExtension) {
+			// leftovers of interrupted writes
+			if strings.HasSuffix(name, ".tmp") {
+				os.Remove(filepath.Join(dir, name))
+			}
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		key := strings.TrimSuffix(name, cacheFileExtension)
+		c.entries[key] = &cacheEntry{size: info.Size(), lastAccess: info.ModTime()}
+		c.size += info.Size()
+	}
+
+	c.mutex.Lock()
+	c.evict()
+	c.mutex.Unlock()
+
+	return c, nil
+}
+
+func (c *AudioCache) Stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return CacheStats{
+		Hits:    c.hits,
+		Misses:  c.misses,
+		Entries: len(c.entries),
+		Size:    c.size,
+	}
+}
+
+// GetAudio streams the song from the cache or, if it is not cached, from
+// fetch, storing the frames for the next time.
+func (c *AudioCache) GetAudio(ctx context.Context, song *bot.Song, fetch func(context.Context, *bot.Song) (*bot.AudioStream, error)) (*bot.AudioStream, error) {
+	key := cacheKey(song.URL, bot.EncoderProfileFromContext(ctx))
+
+	if stream, err := c.open(ctx, key, song.StartPosition); err == nil {
+		c.record(true)
+		return stream, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		c.Logger.Error("failed to read cached audio", "error", err, "url", song.URL)
+		c.remove(key)
+	}
+	c.record(false)
+
+	// audio starting in the middle of the song cannot be cached
+	if song.StartPosition > 0 {
+		return fetch(ctx, song)
+	}
+
+	source, err := fetch(ctx, song)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := bot.NewAudioStream()
+	go c.store(ctx, key, song, source, stream)
+
+	return stream, nil
+}
+
+func (c *AudioCache) record(hit bool) {
+	c.mutex.Lock()
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	stats := CacheStats{Hits: c.hits, Misses: c.misses, Entries: len(c.entries), Size: c.size}
+	c.mutex.Unlock()
+
+	c.Logger.Debug("audio cache lookup", "hit", hit, "hit_rate", stats.HitRate(), "entries", stats.Entries, "size", stats.Size)
+}
+
+func (c *AudioCache) open(ctx context.Context, key string, startPosition time.Duration) (*bot.AudioStream, error) {
+	file, err := os.Open(c.path(key))
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(file)
+
+	magic := make([]byte, len(cacheFileMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != cacheFileMagic {
+		file.Close()
+		return nil, ErrInvalidCacheFile
+	}
+
+	c.touch(key)
+
+	skipFrames := int(startPosition / frameLength)
+	stream := bot.NewAudioStream()
+
+	go func() {
+		defer file.Close()
+
+		for i := 0; ; i++ {
+			frame, err := readCacheFrame(reader)
+			if errors.Is(err, io.EOF) {
+				stream.Close(nil)
+				return
+			}
+			if err != nil {
+				c.Logger.Error("failed to read cached frame", "error", err, "key", key)
+				// the file is read again, when the song is resumed
+				c.remove(key)
+				stream.Close(err)
+				return
+			}
+
+			if i < skipFrames {
+				continue
+			}
+
+			if !stream.Send(ctx, frame) {
+				stream.Close(nil)
+				return
+			}
+		}
+	}()
+
+	return stream, nil
+}
+
+// store passes the frames from the source to the stream and commits them to
+// the cache, if the whole song was received.
+func (c *AudioCache) store(ctx context.Context, key string, song *bot.Song, source, stream *bot.AudioStream) {
+	// the stream ends, like the source does
+	defer func() {
+		stream.SetDiagnostics(source.Diagnostics())
+		stream.Close(source.Err())
+	}()
+
+	tmp, err := os.CreateTemp(c.dir, key+"-*.tmp")
+	if err != nil {
+		c.Logger.Error("failed to create cache file", "error", err)
+	}
+
+	var writer *bufio.Writer
+	if tmp != nil {
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+
+		writer = bufio.NewWriter(tmp)
+		if _, err := writer.WriteString(cacheFileMagic); err != nil {
+			writer = nil
+		}
+	}
+
+	frames := 0
+	for frame := range source.Frames() {
+		if writer != nil {
+			if err := writeCacheFrame(writer, frame); err != nil {
+				c.Logger.Error("failed to write cache file", "error", err)
+				writer = nil
+			}
+		}
+		frames++
+
+		if !stream.Send(ctx, frame) {
+			// drain the source, so it can finish
+			for range source.Frames() {
+			}
+			return
+		}
+	}
+
+	if writer == nil || ctx.Err() != nil || source.Err() != nil {
+		return
+	}
+
+	// a failed download also ends the stream, so it is cached only, if it
+	// is not much shorter than the song
+	received := time.Duration(frames) * frameLength
+	if frames == 0 || (song.Duration > 0 && received < song.Duration-cacheDurationTolerance) {
+		c.Logger.Info("not caching incomplete audio", "url", song.URL, "received", received, "duration", song.Duration)
+		return
+	}
+
+	if err := writer.Flush(); err != nil {
+		c.Logger.Error("failed to write cache file", "error", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		c.Logger.Error("failed to write cache file", "error", err)
+		return
+	}
+
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		c.Logger.Error("failed to commit cache file", "error", err)
+		return
+	}
+
+	info, err := os.Stat(c.path(key))
+	if err != nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		c.size -= entry.size
+	}
+	c.entries[key] = &cacheEntry{size: info.Size(), lastAccess: time.Now()}
+	c.size += info.Size()
+	c.evict()
+}
+
+func (c *AudioCache) touch(key string) {
+	now := time.Now()
+
+	c.mutex.Lock()
+	if entry, ok := c.entries[key]; ok {
+		entry.lastAccess = now
+	}
+	c.mutex.Unlock()
+
+	// the modification time keeps the access order across restarts
+	if err := os.Chtimes(c.path(key), now, now); err != nil {
+		c.Logger.Debug("failed to update cache file time", "error", err)
+	}
+}
+
+func (c *AudioCache) remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		c.size -= entry.size
+		delete(c.entries, key)
+	}
+	os.Remove(c.path(key))
+}
+
+// evict removes the least recently used entries, until the cache fits its
+// size limit. The mutex has to be held.
+func (c *AudioCache) evict() {
+	if c.size <= c.maxSize {
+		return
+	}
+
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].lastAccess.Before(c.entries[keys[j]].lastAccess)
+	})
+
+	for _, key := range keys {
+		if c.size <= c.maxSize {
+			break
+		}
+
+		// files being read can be removed, readers keep them open
+		if err := os.Remove(c.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.Logger.Error("failed to evict cache file", "error", err)
+			continue
+		}
+
+		c.size -= c.entries[key].size
+		delete(c.entries, key)
+	}
+}
+
+func (c *AudioCache) path(key string) string {
+	return filepath.Join(c.dir, key+cacheFileExtension)
+}
+
+func readCacheFrame(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, fmt.Errorf("%w: truncated frame", ErrInvalidCacheFile)
+	}
+
+	return frame, nil
+}
+
+func writeCacheFrame(w io.Writer, frame []byte) error {
+	if err := binary.Write(w, binary.LittleEndian, uint16(len(frame))); err != nil {
+		return err
+	}
+
+	_, err := w.Write(frame)
+	return err
+}
+
+// cacheKey hashes the normalized URL, so the same song requested with
+// different URLs shares the cache entry, and the encoder settings, as the
+// frames are encoded with them.
+func cacheKey(rawURL string, profile bot.EncoderProfile) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s/%d/%d/%t/%d/%d",
+		normalizeURL(rawURL),
+		profile.Application,
+		profile.Bitrate,
+		profile.Complexity,
+		profile.InbandFEC,
+		profile.PacketLossPerc,
+		profile.Volume,
+	)))
+	return hex.EncodeToString(sum[:])
+}
+
+// ignoredQueryParams do not change, which audio the URL points to.
+var ignoredQueryParams = []string{"feature", "si", "list", "index", "t", "start_radio", "pp", "ab_channel"}
+
+func normalizeURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, prefix := range []string{"www.", "m.", "music."} {
+		host = strings.TrimPrefix(host, prefix)
+	}
+
+	query := u.Query()
+	path := strings.TrimSuffix(u.Path, "/")
+
+	if host == "youtu.be" {
+		host = "youtube.com"
+		query.Set("v", strings.TrimPrefix(path, "/"))
+		path = "/watch"
+	}
+
+	for key := range query {
+		if strings.HasPrefix(key, "utm_") || contains(ignoredQueryParams, key) {
+			query.Del(key)
+		}
+	}
+
+	normalized := url.URL{
+		Scheme:   "https",
+		Host:     host,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+
+	return normalized.String()
+}
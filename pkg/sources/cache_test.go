@@ -0,0 +1,265 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+func TestCacheKey(t *testing.T) {
+	music := bot.GetEncoderProfile(&bot.GuildSettings{EncoderProfile: "music"}, 96000)
+	voice := bot.GetEncoderProfile(&bot.GuildSettings{EncoderProfile: "voice"}, 96000)
+	musicLowBitrate := bot.GetEncoderProfile(&bot.GuildSettings{EncoderProfile: "music"}, 64000)
+	musicQuiet := bot.GetEncoderProfile(&bot.GuildSettings{EncoderProfile: "music", DefaultVolume: 50}, 96000)
+
+	key := cacheKey("https://www.youtube.com/watch?v=K0HSD_i2DvA", music)
+
+	if got := cacheKey("https://youtu.be/K0HSD_i2DvA?si=abc", music); got != key {
+		t.Error("cacheKey() differs for URLs of the same song")
+	}
+	if got := cacheKey("https://www.youtube.com/watch?v=K0HSD_i2DvA", voice); got == key {
+		t.Error("cacheKey() is the same for different encoder profiles")
+	}
+	if got := cacheKey("https://www.youtube.com/watch?v=K0HSD_i2DvA", musicLowBitrate); got == key {
+		t.Error("cacheKey() is the same for different bitrates")
+	}
+	if got := cacheKey("https://www.youtube.com/watch?v=K0HSD_i2DvA", musicQuiet); got == key {
+		t.Error("cacheKey() is the same for different volumes")
+	}
+	if got := cacheKey("https://www.youtube.com/watch?v=FGBhQbmPwH8", music); got == key {
+		t.Error("cacheKey() is the same for different songs")
+	}
+}
+
+const (
+	testFrameSize = 100
+	// testEntrySize is the size of a cache file with 5 test frames, each
+	// prefixed with its length.
+	testEntrySize = int64(len(cacheFileMagic) + 5*(2+testFrameSize))
+)
+
+// fakeFetch returns streams of the given frames and counts its calls.
+type fakeFetch struct {
+	frames int
+	err    error
+	calls  int
+}
+
+func (f *fakeFetch) GetAudio(ctx context.Context, song *bot.Song) (*bot.AudioStream, error) {
+	f.calls++
+
+	stream := bot.NewAudioStream()
+	for i := 0; i < f.frames; i++ {
+		stream.Send(ctx, bytes.Repeat([]byte{byte(i)}, testFrameSize))
+	}
+	stream.Close(f.err)
+
+	return stream, nil
+}
+
+// playCached reads the whole song through the cache, so the song is cached
+// after it returns, if it can be.
+func playCached(t *testing.T, cache *AudioCache, song *bot.Song, fetch *fakeFetch) ([][]byte, error) {
+	t.Helper()
+
+	stream, err := cache.GetAudio(context.Background(), song, fetch.GetAudio)
+	if err != nil {
+		t.Fatalf("GetAudio() error = %v", err)
+	}
+
+	frames := [][]byte{}
+	for frame := range stream.Frames() {
+		frames = append(frames, frame)
+	}
+
+	return frames, stream.Err()
+}
+
+func cachedSong(url string) *bot.Song {
+	return &bot.Song{URL: url, Duration: 100 * time.Millisecond}
+}
+
+func TestAudioCacheHitSkipsFetch(t *testing.T) {
+	cache, err := NewAudioCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	song := cachedSong("https://example.com/a")
+	fetch := &fakeFetch{frames: 5}
+
+	fetched, err := playCached(t, cache, song, fetch)
+	if err != nil {
+		t.Fatalf("stream error = %v", err)
+	}
+	cached, err := playCached(t, cache, song, fetch)
+	if err != nil {
+		t.Fatalf("cached stream error = %v", err)
+	}
+
+	if fetch.calls != 1 {
+		t.Errorf("fetch calls = %d, want 1", fetch.calls)
+	}
+	if len(cached) != 5 || !bytes.Equal(cached[4], fetched[4]) {
+		t.Errorf("cached frames differ from the fetched ones")
+	}
+
+	want := CacheStats{Hits: 1, Misses: 1, Entries: 1, Size: testEntrySize}
+	if got := cache.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	// a song started in the middle is read from the cache too
+	resumed := cachedSong(song.URL)
+	resumed.StartPosition = 60 * time.Millisecond
+	frames, _ := playCached(t, cache, resumed, fetch)
+	if fetch.calls != 1 || len(frames) != 2 {
+		t.Errorf("resumed song: fetch calls = %d, frames = %d, want 1 and 2", fetch.calls, len(frames))
+	}
+}
+
+func TestAudioCacheDoesNotCommitFailedAudio(t *testing.T) {
+	tests := []struct {
+		name    string
+		fetch   *fakeFetch
+		wantErr bool
+	}{
+		{name: "download failed", fetch: &fakeFetch{frames: 5, err: errors.New("broken pipe")}, wantErr: true},
+		{name: "shorter than the song", fetch: &fakeFetch{frames: 5}},
+		{name: "no frames", fetch: &fakeFetch{frames: 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cache, err := NewAudioCache(dir, 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			song := cachedSong("https://example.com/a")
+			song.Duration = time.Minute
+
+			for i := 0; i < 2; i++ {
+				if _, err := playCached(t, cache, song, tt.fetch); (err != nil) != tt.wantErr {
+					t.Fatalf("stream error = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+
+			if tt.fetch.calls != 2 {
+				t.Errorf("fetch calls = %d, want 2", tt.fetch.calls)
+			}
+			if stats := cache.Stats(); stats.Entries != 0 || stats.Size != 0 {
+				t.Errorf("Stats() = %+v, want no entries", stats)
+			}
+
+			files, _ := os.ReadDir(dir)
+			if len(files) != 0 {
+				t.Errorf("cache directory has %d files, want none", len(files))
+			}
+		})
+	}
+}
+
+func TestAudioCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	// two songs fit in the cache
+	cache, err := NewAudioCache(t.TempDir(), 2*testEntrySize+testEntrySize/2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetch := &fakeFetch{frames: 5}
+	play := func(url string) {
+		t.Helper()
+		if _, err := playCached(t, cache, cachedSong(url), fetch); err != nil {
+			t.Fatal(err)
+		}
+		// the access times differ
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	play("https://example.com/a")
+	play("https://example.com/b")
+	play("https://example.com/a")
+	play("https://example.com/c")
+
+	if got := cache.Stats(); got.Entries != 2 || got.Size != 2*testEntrySize {
+		t.Errorf("Stats() = %+v, want 2 entries", got)
+	}
+
+	// a and c are cached, b was evicted
+	calls := fetch.calls
+	play("https://example.com/a")
+	play("https://example.com/c")
+	if fetch.calls != calls {
+		t.Errorf("a or c was evicted")
+	}
+	play("https://example.com/b")
+	if fetch.calls != calls+1 {
+		t.Errorf("b was not evicted")
+	}
+}
+
+func TestAudioCacheSizeLimit(t *testing.T) {
+	t.Run("songs larger than the cache", func(t *testing.T) {
+		dir := t.TempDir()
+		cache, err := NewAudioCache(dir, testEntrySize-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := playCached(t, cache, cachedSong("https://example.com/a"), &fakeFetch{frames: 5}); err != nil {
+			t.Fatal(err)
+		}
+
+		if stats := cache.Stats(); stats.Entries != 0 || stats.Size != 0 {
+			t.Errorf("Stats() = %+v, want no entries", stats)
+		}
+		if files, _ := os.ReadDir(dir); len(files) != 0 {
+			t.Errorf("cache directory has %d files, want none", len(files))
+		}
+	})
+
+	t.Run("existing files", func(t *testing.T) {
+		dir := t.TempDir()
+
+		// the oldest files are evicted, when the cache is opened
+		now := time.Now()
+		for i, name := range []string{"old", "middle", "new"} {
+			path := filepath.Join(dir, name+cacheFileExtension)
+			if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+				t.Fatal(err)
+			}
+			modTime := now.Add(time.Duration(i) * time.Minute)
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// leftovers of an interrupted write
+		if err := os.WriteFile(filepath.Join(dir, "partial-1.tmp"), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cache, err := NewAudioCache(dir, 200)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if stats := cache.Stats(); stats.Entries != 2 || stats.Size != 200 {
+			t.Errorf("Stats() = %+v, want 2 entries of 200 bytes", stats)
+		}
+
+		for name, want := range map[string]bool{"old" + cacheFileExtension: false, "middle" + cacheFileExtension: true, "new" + cacheFileExtension: true, "partial-1.tmp": false} {
+			_, err := os.Stat(filepath.Join(dir, name))
+			if exists := err == nil; exists != want {
+				t.Errorf("%s exists = %t, want %t", name, exists, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package sources
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+// maxDiagnosticsLength limits the command output kept with a failed stream.
+const maxDiagnosticsLength = 4096
+
+// errorClasses map messages of yt-dlp and ffmpeg to the playback errors.
+var errorClasses = []struct {
+	err      error
+	messages []string
+}{
+	{bot.ErrGeoBlocked, []string{
+		"available in your country",
+		"not available from your location",
+		"geo restriction",
+		"geo-restricted",
+		"blocked it in your country",
+	}},
+	{bot.ErrAgeRestricted, []string{
+		"confirm your age",
+		"age-restricted",
+		"age restricted",
+		"inappropriate for some users",
+	}},
+	// private videos, which can be played with the cookies of an account
+	// with access, are not removed
+	{bot.ErrLoginRequired, []string{
+		"members-only",
+		"join this channel to get access",
+		"sign in if you've been granted access",
+		"sign in to confirm you",
+		"login required",
+		"requires authentication",
+		"account cookies",
+		"--cookies",
+	}},
+	{bot.ErrRemoved, []string{
+		"video unavailable",
+		"has been removed",
+		"private video",
+		"has been terminated",
+		"no longer available",
+		"http error 404",
+		"http error 410",
+		"server returned 404",
+	}},
+	{bot.ErrNetwork, []string{
+		"unable to download",
+		"timed out",
+		"connection reset",
+		"connection refused",
+		"temporary failure in name resolution",
+		"network is unreachable",
+		"incompleteread",
+		"http error 5",
+		"server returned 5",
+		"end of file",
+	}},
+}
+
+// classifyError wraps err with the playback error matching the output of the
+// command, so the player can tell the users why the song failed.
+func classifyError(err error, output string) error {
+	output = strings.ToLower(output)
+
+	for _, class := range errorClasses {
+		for _, message := range class.messages {
+			if strings.Contains(output, message) {
+				return fmt.Errorf("%w: %w", class.err, err)
+			}
+		}
+	}
+
+	return err
+}
+
+// diagnostics returns the end of the command output, which has the errors.
+func diagnostics(output string) string {
+	if len(output) <= maxDiagnosticsLength {
+		return output
+	}
+
+	return "…" + output[len(output)-maxDiagnosticsLength:]
+}
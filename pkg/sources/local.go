@@ -0,0 +1,562 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"golang.org/x/exp/slog"
+)
+
+const LocalSongType = "local"
+
+var (
+	localAudioExtensions = map[string]bool{
+		".mp3":  true,
+		".flac": true,
+		".ogg":  true,
+		".opus": true,
+		".m4a":  true,
+	}
+
+	// opusExtensions are the files, which may contain Opus audio to pass
+	// through without encoding.
+	opusExtensions = map[string]bool{
+		".ogg":  true,
+		".opus": true,
+	}
+
+	ErrOutsideLibrary = errors.New("path is outside of the library")
+)
+
+type localTrack struct {
+	path    string
+	modTime time.Time
+
+	title    string
+	artist   string
+	album    string
+	duration time.Duration
+	coverID  string
+
+	words []string
+}
+
+// LocalLibrary plays audio files from a directory. The files are indexed in
+// the background using ffprobe.
+type LocalLibrary struct {
+	Logger *slog.Logger
+
+	dir string
+
+	// coverDir and coverURL are used to publish embedded covers, so they can
+	// be shown in Discord. Covers are skipped, if any of them is empty.
+	coverDir string
+	coverURL string
+
+	// supervisor runs the processes indexing the files, if set.
+	supervisor *ProcessSupervisor
+
+	ffmpegBinary  string
+	ffprobeBinary string
+
+	mutex  sync.RWMutex
+	tracks map[string]*localTrack
+}
+
+type LocalLibraryOption func(l *LocalLibrary)
+
+func WithCovers(dir, url string) LocalLibraryOption {
+	return func(l *LocalLibrary) {
+		l.coverDir = dir
+		l.coverURL = strings.TrimSuffix(url, "/")
+	}
+}
+
+// WithLibrarySupervisor runs ffprobe and the cover extraction with the limits
+// of the supervisor, like the processes playing songs.
+func WithLibrarySupervisor(supervisor *ProcessSupervisor) LocalLibraryOption {
+	return func(l *LocalLibrary) {
+		l.supervisor = supervisor
+	}
+}
+
+// WithLibraryBinaries sets the paths of ffmpeg and ffprobe. Empty values keep
+// the defaults, an empty ffprobe is looked up next to ffmpeg.
+func WithLibraryBinaries(ffmpegBinary, ffprobeBinary string) LocalLibraryOption {
+	return func(l *LocalLibrary) {
+		if ffmpegBinary != "" {
+			l.ffmpegBinary = ffmpegBinary
+			l.ffprobeBinary = ffprobeBinaryFor(ffmpegBinary)
+		}
+		if ffprobeBinary != "" {
+			l.ffprobeBinary = ffprobeBinary
+		}
+	}
+}
+
+func NewLocalLibrary(dir string, opts ...LocalLibraryOption) *LocalLibrary {
+	l := &LocalLibrary{
+		Logger:        slog.Default(),
+		dir:           dir,
+		tracks:        make(map[string]*localTrack),
+		ffmpegBinary:  defaultFFmpegBinary,
+		ffprobeBinary: defaultFFprobeBinary,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
+}
+
+// Run indexes the library and rescans it every interval until the context
+// is done.
+func (l *LocalLibrary) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := l.Scan(ctx); err != nil {
+			l.Logger.Error("failed to scan local library", "error", err)
+		}
+
+		if interval <= 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Scan updates the index. Only new or modified files are probed.
+func (l *LocalLibrary) Scan(ctx context.Context) error {
+	l.mutex.RLock()
+	known := make(map[string]*localTrack, len(l.tracks))
+	for path, track := range l.tracks {
+		known[path] = track
+	}
+	l.mutex.RUnlock()
+
+	tracks := make(map[string]*localTrack)
+
+	err := filepath.WalkDir(l.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if d.IsDir() || !localAudioExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(l.dir, path)
+		if err != nil {
+			return err
+		}
+
+		if track, ok := known[relPath]; ok && track.modTime.Equal(info.ModTime()) {
+			tracks[relPath] = track
+			return nil
+		}
+
+		track, err := l.probe(ctx, relPath)
+		if err != nil {
+			l.Logger.Info("failed to probe file", "path", path, "error", err)
+			return nil
+		}
+		track.modTime = info.ModTime()
+
+		tracks[relPath] = track
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("while walking library directory: %w", err)
+	}
+
+	l.mutex.Lock()
+	l.tracks = tracks
+	l.mutex.Unlock()
+
+	l.Logger.Info("indexed local library", "dir", l.dir, "tracks", len(tracks))
+	return nil
+}
+
+// LookupSongs accepts a `file:` path relative to the library, which can
+// point to a single file or a directory, or a search query. The library root
+// itself is not expanded, as it would queue every file.
+func (l *LocalLibrary) LookupSongs(ctx context.Context, input string) ([]*bot.Song, error) {
+	input = strings.TrimSpace(strings.TrimPrefix(input, "file:"))
+
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	if relPath, err := l.relativePath(input); err == nil && relPath != "." {
+		if track, ok := l.tracks[relPath]; ok {
+			return []*bot.Song{l.song(track)}, nil
+		}
+
+		if songs := l.directorySongs(relPath); len(songs) > 0 {
+			return songs, nil
+		}
+	}
+
+	tracks := l.search(input, searchLimit(ctx))
+
+	songs := make([]*bot.Song, 0, len(tracks))
+	for _, track := range tracks {
+		songs = append(songs, l.song(track))
+	}
+
+	return songs, nil
+}
+
+func (l *LocalLibrary) GetAudio(ctx context.Context, song *bot.Song) (*bot.AudioStream, error) {
+	relPath, err := l.relativePath(strings.TrimPrefix(song.URL, "file:"))
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(l.dir, relPath)
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("while opening file: %w", err)
+	}
+
+	if opusExtensions[strings.ToLower(filepath.Ext(path))] {
+		return l.streamFile(ctx, path, song.StartPosition)
+	}
+
+	args := []string{}
+	if song.StartPosition > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(song.StartPosition.Seconds(), 'f', 3, 64))
+	}
+	args = append(args, "-i", path, "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1")
+
+	cmd := newCommand(ctx, l.ffmpegBinary, args...)
+	stderrBuf := &bytes.Buffer{}
+	cmd.Stderr = stderrBuf
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("while creating ffmpeg pipe: %w", err)
+	}
+
+	if err := startCommand(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("while starting ffmpeg: %w", err)
+	}
+
+	stream := bot.NewAudioStream()
+
+	go func() {
+		streamErr := encodeOpus(ctx, stdout, stream)
+
+		if err := waitCommand(ctx, cmd); err != nil && ctx.Err() == nil {
+			stream.SetDiagnostics(diagnostics(stderrBuf.String()))
+			streamErr = fmt.Errorf("while executing ffmpeg: %w", err)
+		}
+
+		if ctx.Err() != nil {
+			streamErr = nil
+		}
+		stream.Close(streamErr)
+	}()
+
+	return stream, nil
+}
+
+// streamFile passes the Opus audio of the file through, transcoding it only,
+// if it cannot be sent as it is.
+func (l *LocalLibrary) streamFile(ctx context.Context, path string, startPosition time.Duration) (*bot.AudioStream, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("while opening file: %w", err)
+	}
+
+	stream := bot.NewAudioStream()
+
+	go func() {
+		defer file.Close()
+
+		streamErr := streamOpus(ctx, file, startPosition, stream, l.ffmpegBinary, l.Logger)
+		if ctx.Err() != nil {
+			streamErr = nil
+		}
+		stream.Close(streamErr)
+	}()
+
+	return stream, nil
+}
+
+// relativePath cleans the path and makes sure it stays inside the library.
+func (l *LocalLibrary) relativePath(input string) (string, error) {
+	relPath := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(input, "/")))
+	if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) || filepath.IsAbs(relPath) {
+		return "", ErrOutsideLibrary
+	}
+
+	return relPath, nil
+}
+
+func (l *LocalLibrary) directorySongs(relDir string) []*bot.Song {
+	paths := make([]string, 0)
+	for path := range l.tracks {
+		if strings.HasPrefix(path, relDir+string(filepath.Separator)) {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	songs := make([]*bot.Song, 0, len(paths))
+	for _, path := range paths {
+		songs = append(songs, l.song(l.tracks[path]))
+	}
+
+	return songs
+}
+
+// search returns up to limit tracks best matching the query. Every word of
+// the query has to match a word of the artist, album, title or file name.
+func (l *LocalLibrary) search(query string, limit int) []*localTrack {
+	queryWords := splitWords(query)
+	if len(queryWords) == 0 {
+		return nil
+	}
+
+	type match struct {
+		track *localTrack
+		score int
+	}
+	matches := make([]match, 0)
+
+	for _, track := range l.tracks {
+		score := 0
+		for _, queryWord := range queryWords {
+			wordScore := 0
+			for _, word := range track.words {
+				if s := matchWord(queryWord, word); s > wordScore {
+					wordScore = s
+				}
+			}
+
+			if wordScore == 0 {
+				score = 0
+				break
+			}
+			score += wordScore
+		}
+
+		if score > 0 {
+			matches = append(matches, match{track: track, score: score})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].track.path < matches[j].track.path
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	tracks := make([]*localTrack, 0, len(matches))
+	for _, m := range matches {
+		tracks = append(tracks, m.track)
+	}
+
+	return tracks
+}
+
+func matchWord(queryWord, word string) int {
+	switch {
+	case queryWord == word:
+		return 4
+	case strings.HasPrefix(word, queryWord):
+		return 3
+	case strings.Contains(word, queryWord):
+		return 2
+	case len(queryWord) >= 4 && editDistance(queryWord, word) <= 1:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// editDistance is the optimal string alignment distance, so swapped letters
+// count as a single typo.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prevPrev := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = min(curr[j], prevPrev[j-2]+1)
+			}
+		}
+		prevPrev, prev, curr = prev, curr, prevPrev
+	}
+
+	return prev[len(rb)]
+}
+
+func splitWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func (l *LocalLibrary) song(track *localTrack) *bot.Song {
+	song := &bot.Song{
+		Type:     LocalSongType,
+		Title:    track.title,
+		Artist:   track.artist,
+		Album:    track.album,
+		URL:      "file:" + filepath.ToSlash(track.path),
+		Playable: true,
+		Duration: track.duration,
+	}
+
+	if track.coverID != "" && l.coverURL != "" {
+		thumbnailURL := fmt.Sprintf("%s/%s.jpg", l.coverURL, track.coverID)
+		song.ThumbnailURL = &thumbnailURL
+	}
+
+	return song
+}
+
+type ffprobeOutput struct {
+	Format struct {
+		Duration string            `json:"duration"`
+		Tags     map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType   string            `json:"codec_type"`
+		Tags        map[string]string `json:"tags"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+}
+
+func (l *LocalLibrary) probe(ctx context.Context, relPath string) (*localTrack, error) {
+	path := filepath.Join(l.dir, relPath)
+
+	if l.supervisor != nil {
+		pipeline := l.supervisor.NewPipeline("index " + relPath)
+		defer pipeline.Close()
+		ctx = withPipeline(ctx, pipeline)
+	}
+
+	cmd := newCommand(ctx, l.ffprobeBinary, "-v", "quiet", "-print_format", "json", "-show_format", "-show_streams", path)
+	out, err := outputCommand(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("while executing ffprobe: %w", err)
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, fmt.Errorf("while parsing ffprobe output: %w", err)
+	}
+
+	// tags are in the format for most containers, but in the stream for Ogg
+	tags := make(map[string]string)
+	hasCover := false
+	for _, stream := range probe.Streams {
+		if stream.Disposition.AttachedPic == 1 {
+			hasCover = true
+			continue
+		}
+		if stream.CodecType == "audio" {
+			for k, v := range stream.Tags {
+				tags[strings.ToLower(k)] = v
+			}
+		}
+	}
+	for k, v := range probe.Format.Tags {
+		tags[strings.ToLower(k)] = v
+	}
+
+	track := &localTrack{
+		path:   relPath,
+		title:  tags["title"],
+		artist: tags["artist"],
+		album:  tags["album"],
+	}
+
+	if track.title == "" {
+		track.title = strings.TrimSuffix(filepath.Base(relPath), filepath.Ext(relPath))
+	}
+
+	if seconds, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		track.duration = time.Duration(seconds * float64(time.Second))
+	}
+
+	if hasCover && l.coverDir != "" && l.coverURL != "" {
+		coverID, err := l.extractCover(ctx, relPath)
+		if err != nil {
+			l.Logger.Info("failed to extract cover", "path", path, "error", err)
+		}
+		track.coverID = coverID
+	}
+
+	track.words = splitWords(strings.Join([]string{track.artist, track.album, track.title, relPath}, " "))
+
+	return track, nil
+}
+
+func (l *LocalLibrary) extractCover(ctx context.Context, relPath string) (string, error) {
+	hash := sha1.Sum([]byte(relPath))
+	coverID := hex.EncodeToString(hash[:])
+
+	if err := os.MkdirAll(l.coverDir, 0755); err != nil {
+		return "", fmt.Errorf("while creating cover directory: %w", err)
+	}
+
+	coverPath := filepath.Join(l.coverDir, coverID+".jpg")
+	cmd := newCommand(ctx, l.ffmpegBinary, "-y", "-v", "quiet", "-i", filepath.Join(l.dir, relPath), "-an", "-frames:v", "1", coverPath)
+	if _, err := outputCommand(ctx, cmd); err != nil {
+		return "", fmt.Errorf("while executing ffmpeg: %w", err)
+	}
+
+	return coverID, nil
+}
@@ -0,0 +1,129 @@
+package sources
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/sources/sourcestest"
+	"golang.org/x/exp/slog"
+)
+
+func TestLocalLibraryLookupSongsPaths(t *testing.T) {
+	library := NewLocalLibrary(t.TempDir())
+	library.tracks = map[string]*localTrack{
+		"a.mp3":            {path: "a.mp3", title: "A", words: []string{"a"}},
+		"DJ Sets/one.flac": {path: "DJ Sets/one.flac", title: "One", words: []string{"one"}},
+		"DJ Sets/two.flac": {path: "DJ Sets/two.flac", title: "Two", words: []string{"two"}},
+	}
+
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{input: "a.mp3", want: []string{"A"}},
+		{input: "DJ Sets", want: []string{"One", "Two"}},
+		{input: "DJ Sets/", want: []string{"One", "Two"}},
+		{input: ".", want: []string{}},
+		{input: "/", want: []string{}},
+		{input: "../a.mp3", want: []string{}},
+		{input: "two", want: []string{"Two"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			songs, err := library.LookupSongs(context.Background(), tt.input)
+			if err != nil {
+				t.Fatalf("LookupSongs() error = %v", err)
+			}
+
+			titles := make([]string, 0, len(songs))
+			for _, song := range songs {
+				titles = append(titles, song.Title)
+			}
+			if len(titles) != len(tt.want) {
+				t.Fatalf("LookupSongs() = %q, want %q", titles, tt.want)
+			}
+			for i := range titles {
+				if titles[i] != tt.want[i] {
+					t.Fatalf("LookupSongs() = %q, want %q", titles, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalLibraryScanAndPlay(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "DJ Sets"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "DJ Sets", "2024-06.flac"), []byte("fLaC"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	bin := sourcestest.NewBin(t)
+	ffprobe := bin.Install("custom-ffprobe", sourcestest.Script{
+		Stdout: []byte(`{"format": {"duration": "3600.5", "tags": {"TITLE": "June Mix", "ARTIST": "DJ Test"}}, "streams": [{"codec_type": "audio"}]}`),
+	})
+	ffmpeg := bin.Install("custom-ffmpeg", sourcestest.Script{
+		Stdout: sourcestest.PCM(100 * time.Millisecond),
+	})
+
+	library := NewLocalLibrary(dir, WithLibraryBinaries(ffmpeg, ffprobe))
+	library.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	if err := library.Scan(context.Background()); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	songs, err := library.LookupSongs(context.Background(), "june mix")
+	if err != nil {
+		t.Fatalf("LookupSongs() error = %v", err)
+	}
+	if len(songs) != 1 || songs[0].Title != "June Mix" || songs[0].Artist != "DJ Test" || songs[0].Duration != 3600500*time.Millisecond {
+		t.Fatalf("LookupSongs() = %s", dumpSongs(songs))
+	}
+
+	song := songs[0]
+	song.StartPosition = 30 * time.Second
+
+	stream, err := library.GetAudio(context.Background(), song)
+	if err != nil {
+		t.Fatalf("GetAudio() error = %v", err)
+	}
+	if frames := readStream(t, stream); frames != 5 {
+		t.Errorf("GetAudio() sent %d frames, want 5", frames)
+	}
+
+	calls := bin.Calls("custom-ffmpeg")
+	want := []string{"-ss", "30.000", "-i", filepath.Join(dir, "DJ Sets", "2024-06.flac"), "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1"}
+	if len(calls) != 1 || !slices.Equal(calls[0], want) {
+		t.Errorf("ffmpeg calls = %q, want %q", calls, want)
+	}
+	if len(bin.Calls("custom-ffprobe")) != 1 {
+		t.Errorf("ffprobe was called %d times, want once", len(bin.Calls("custom-ffprobe")))
+	}
+}
+
+func TestWithLibraryBinaries(t *testing.T) {
+	tests := []struct {
+		ffmpeg, ffprobe         string
+		wantFFmpeg, wantFFprobe string
+	}{
+		{wantFFmpeg: "ffmpeg", wantFFprobe: "ffprobe"},
+		{ffmpeg: "/opt/ffmpeg/bin/ffmpeg", wantFFmpeg: "/opt/ffmpeg/bin/ffmpeg", wantFFprobe: "/opt/ffmpeg/bin/ffprobe"},
+		{ffmpeg: "/opt/ffmpeg/bin/ffmpeg", ffprobe: "/usr/bin/ffprobe", wantFFmpeg: "/opt/ffmpeg/bin/ffmpeg", wantFFprobe: "/usr/bin/ffprobe"},
+	}
+
+	for _, tt := range tests {
+		library := NewLocalLibrary(t.TempDir(), WithLibraryBinaries(tt.ffmpeg, tt.ffprobe))
+		if library.ffmpegBinary != tt.wantFFmpeg || library.ffprobeBinary != tt.wantFFprobe {
+			t.Errorf("WithLibraryBinaries(%q, %q) = %q, %q, want %q, %q", tt.ffmpeg, tt.ffprobe, library.ffmpegBinary, library.ffprobeBinary, tt.wantFFmpeg, tt.wantFFprobe)
+		}
+	}
+}
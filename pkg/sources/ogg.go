@@ -0,0 +1,167 @@
+package sources
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	oggPageMagic    = "OggS"
+	oggHeaderLength = 27
+)
+
+// oggDemuxer reads the Opus packets of the first logical stream of an Ogg
+// stream. Chained streams are followed, pages of other streams are skipped.
+type oggDemuxer struct {
+	r      *bufio.Reader
+	serial uint32
+	// ended is set after the last page of the selected stream
+	ended bool
+
+	// packets is the queue of complete packets of the last page, partial
+	// holds the start of a packet continued on the next page.
+	packets [][]byte
+	partial []byte
+}
+
+func newOggDemuxer(r io.Reader) (*oggDemuxer, error) {
+	d := &oggDemuxer{r: bufio.NewReader(r)}
+
+	if err := d.readHead(true); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// readHead reads the OpusHead and OpusTags header packets of a stream.
+func (d *oggDemuxer) readHead(first bool) error {
+	head, err := d.nextPacket(first)
+	if err != nil {
+		return err
+	}
+
+	if len(head) < 19 || string(head[:8]) != "OpusHead" {
+		return fmt.Errorf("%w: missing OpusHead", errNotOpus)
+	}
+
+	channelCount := head[9]
+	mappingFamily := head[18]
+	if channelCount > channels || mappingFamily != 0 {
+		return fmt.Errorf("%w: %d channels with mapping family %d", errNotOpus, channelCount, mappingFamily)
+	}
+
+	tags, err := d.nextPacket(false)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if !bytes.HasPrefix(tags, []byte("OpusTags")) {
+		return fmt.Errorf("%w: missing OpusTags", errNotOpus)
+	}
+
+	return nil
+}
+
+func (d *oggDemuxer) ReadPacket() ([]byte, error) {
+	for {
+		packet, err := d.nextPacket(false)
+		if err != nil {
+			return nil, err
+		}
+
+		// a chained stream starts with new headers
+		if bytes.HasPrefix(packet, []byte("OpusHead")) {
+			d.packets = append([][]byte{packet}, d.packets...)
+			if err := d.readHead(false); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		return packet, nil
+	}
+}
+
+// nextPacket returns the next packet of the selected stream. The stream of
+// the first page is selected, when first is set.
+func (d *oggDemuxer) nextPacket(first bool) ([]byte, error) {
+	for len(d.packets) == 0 {
+		if err := d.readPage(first); err != nil {
+			return nil, err
+		}
+		first = false
+	}
+
+	packet := d.packets[0]
+	d.packets = d.packets[1:]
+	return packet, nil
+}
+
+func (d *oggDemuxer) readPage(selectStream bool) error {
+	header := make([]byte, oggHeaderLength)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return err
+	}
+
+	if string(header[:4]) != oggPageMagic {
+		return fmt.Errorf("%w: invalid Ogg page", errNotOpus)
+	}
+
+	headerType := header[5]
+	serial := binary.LittleEndian.Uint32(header[14:18])
+	segmentCount := int(header[26])
+
+	segments := make([]byte, segmentCount)
+	if _, err := io.ReadFull(d.r, segments); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	bodyLength := 0
+	for _, s := range segments {
+		bodyLength += int(s)
+	}
+
+	body := make([]byte, bodyLength)
+	if _, err := io.ReadFull(d.r, body); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	const (
+		continuedPacket   = 0x01
+		beginningOfStream = 0x02
+		endOfStream       = 0x04
+	)
+
+	// a chained stream follows the end of the previous one
+	if selectStream || d.ended && headerType&beginningOfStream != 0 {
+		d.serial = serial
+		d.ended = false
+	}
+	if serial != d.serial {
+		return nil
+	}
+	if headerType&endOfStream != 0 {
+		d.ended = true
+	}
+
+	if headerType&continuedPacket == 0 {
+		d.partial = nil
+	}
+
+	offset := 0
+	for _, s := range segments {
+		d.partial = append(d.partial, body[offset:offset+int(s)]...)
+		offset += int(s)
+
+		// a segment shorter than 255 bytes ends the packet
+		if s < 255 {
+			d.packets = append(d.packets, d.partial)
+			d.partial = nil
+		}
+	}
+
+	return nil
+}
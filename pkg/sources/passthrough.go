@@ -0,0 +1,284 @@
+package sources
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// passthroughProbePackets is the number of packets checked, before the
+	// stream is passed through.
+	passthroughProbePackets = 50
+	// maxPassthroughProbeSize is the amount of data kept to transcode the
+	// stream, if the probe fails.
+	maxPassthroughProbeSize = 4 << 20
+)
+
+var (
+	errNotOpus       = errors.New("not 48kHz Opus audio")
+	errProbeTooLarge = fmt.Errorf("%w: probe too large", errNotOpus)
+	// errBitrateTooHigh is returned for Opus audio, which would exceed the
+	// bitrate of the encoder profile, e.g. the bitrate of the voice channel.
+	errBitrateTooHigh = errors.New("bitrate above the encoder profile")
+)
+
+type opusDemuxer interface {
+	ReadPacket() ([]byte, error)
+}
+
+// streamOpus sends the Opus packets of a WebM or Ogg stream to the stream without
+// re-encoding them. Streams in other formats, with packets other than 20ms or
+// with a bitrate above the encoder profile are transcoded with ffmpeg instead,
+// like all streams played with a changed volume.
+func streamOpus(ctx context.Context, r io.Reader, startPosition time.Duration, stream *bot.AudioStream, ffmpegBinary string, logger *slog.Logger) error {
+	profile := bot.EncoderProfileFromContext(ctx)
+	if profile.ChangesVolume() {
+		logger.Info("transcoding audio", "reason", "volume changed")
+		return transcodeOpus(ctx, r, startPosition, stream, ffmpegBinary)
+	}
+
+	recorder := &recordingReader{r: r, limit: maxPassthroughProbeSize}
+
+	demuxer, packets, err := probeOpus(bufio.NewReader(recorder))
+	if err == nil {
+		err = checkPassthroughBitrate(packets, profile)
+	}
+	if errors.Is(err, errNotOpus) || errors.Is(err, errBitrateTooHigh) {
+		logger.Info("transcoding audio", "reason", err)
+		return transcodeOpus(ctx, io.MultiReader(bytes.NewReader(recorder.data), r), startPosition, stream, ffmpegBinary)
+	}
+	if err != nil {
+		return fmt.Errorf("while probing audio: %w", err)
+	}
+
+	recorder.stop()
+
+	skipPackets := int(startPosition / frameLength)
+	dropped := false
+
+	for {
+		for _, packet := range packets {
+			if opusPacketDuration(packet) != frameLength {
+				if !dropped {
+					logger.Warn("dropping Opus packets not matching the frame length")
+					dropped = true
+				}
+				continue
+			}
+
+			if skipPackets > 0 {
+				skipPackets--
+				continue
+			}
+
+			if !stream.Send(ctx, packet) {
+				return nil
+			}
+		}
+
+		packet, err := demuxer.ReadPacket()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("while demuxing audio: %w", err)
+		}
+
+		packets = [][]byte{packet}
+	}
+}
+
+// probeOpus detects the container of the stream and reads the first packets,
+// to check they can be sent to Discord as they are.
+func probeOpus(r *bufio.Reader) (opusDemuxer, [][]byte, error) {
+	magic, err := r.Peek(4)
+	if len(magic) == 0 {
+		return nil, nil, err
+	}
+
+	var demuxer opusDemuxer
+	switch {
+	case bytes.Equal(magic, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		demuxer, err = newWebMDemuxer(r)
+	case string(magic) == oggPageMagic:
+		demuxer, err = newOggDemuxer(r)
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown container", errNotOpus)
+	}
+	if err != nil {
+		return nil, nil, probeError(err)
+	}
+
+	packets := make([][]byte, 0, passthroughProbePackets)
+	for len(packets) < passthroughProbePackets {
+		packet, err := demuxer.ReadPacket()
+		if errors.Is(err, io.EOF) && len(packets) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, nil, probeError(err)
+		}
+
+		if duration := opusPacketDuration(packet); duration != frameLength {
+			return nil, nil, fmt.Errorf("%w: %v packets", errNotOpus, duration)
+		}
+
+		packets = append(packets, packet)
+	}
+
+	return demuxer, packets, nil
+}
+
+// checkPassthroughBitrate refuses packets with an average bitrate above the
+// bitrate of the profile. A profile without a bitrate accepts any packets.
+func checkPassthroughBitrate(packets [][]byte, profile bot.EncoderProfile) error {
+	if profile.Bitrate <= 0 {
+		return nil
+	}
+
+	if bitrate := opusBitrate(packets); bitrate > profile.Bitrate {
+		return fmt.Errorf("%w: %d > %d bps", errBitrateTooHigh, bitrate, profile.Bitrate)
+	}
+
+	return nil
+}
+
+// opusBitrate returns the average bitrate of the packets in bits per second.
+func opusBitrate(packets [][]byte) int {
+	var size int
+	var duration time.Duration
+	for _, packet := range packets {
+		size += len(packet)
+		duration += opusPacketDuration(packet)
+	}
+
+	if duration <= 0 {
+		return 0
+	}
+
+	return int(float64(size*8) / duration.Seconds())
+}
+
+// probeError makes the stream fall back to transcoding, unless it cannot be
+// read at all.
+func probeError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %v", errNotOpus, err)
+	}
+
+	return err
+}
+
+// opusPacketDuration returns the duration of the audio in the packet, based
+// on its TOC byte (RFC 6716, section 3.1).
+func opusPacketDuration(packet []byte) time.Duration {
+	if len(packet) == 0 {
+		return 0
+	}
+
+	config := packet[0] >> 3
+
+	var frameDuration time.Duration
+	switch {
+	case config < 12:
+		// SILK
+		frameDuration = []time.Duration{10, 20, 40, 60}[config%4] * time.Millisecond
+	case config < 16:
+		// Hybrid
+		frameDuration = []time.Duration{10, 20}[config%2] * time.Millisecond
+	default:
+		// CELT
+		frameDuration = []time.Duration{2500, 5000, 10000, 20000}[config%4] * time.Microsecond
+	}
+
+	frames := 1
+	switch packet[0] & 0x03 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(packet) < 2 {
+			return 0
+		}
+		frames = int(packet[1] & 0x3F)
+	}
+
+	return time.Duration(frames) * frameDuration
+}
+
+// transcodeOpus decodes the stream with ffmpeg and encodes it to Opus.
+func transcodeOpus(ctx context.Context, r io.Reader, startPosition time.Duration, stream *bot.AudioStream, ffmpegBinary string) error {
+	args := []string{"-i", "pipe:0"}
+	if startPosition > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(startPosition.Seconds(), 'f', 3, 64))
+	}
+	args = append(args, "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1")
+
+	cmd := newCommand(ctx, ffmpegBinary, args...)
+	cmd.Stdin = r
+	stderrBuf := &bytes.Buffer{}
+	cmd.Stderr = stderrBuf
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("while creating ffmpeg pipe: %w", err)
+	}
+
+	if err := startCommand(ctx, cmd); err != nil {
+		return fmt.Errorf("while starting ffmpeg: %w", err)
+	}
+
+	encodeErr := encodeOpus(ctx, stdout, stream)
+
+	// ffmpeg cannot finish, until its output is read
+	io.Copy(io.Discard, stdout)
+
+	if err := waitCommand(ctx, cmd); err != nil && ctx.Err() == nil {
+		stream.SetDiagnostics(diagnostics(stderrBuf.String()))
+		return classifyError(fmt.Errorf("while executing ffmpeg: %w", err), stderrBuf.String())
+	}
+
+	return encodeErr
+}
+
+// recordingReader keeps the data read from r, until it is stopped, so it can
+// be read again.
+type recordingReader struct {
+	r     io.Reader
+	data  []byte
+	limit int
+
+	stopped bool
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	if r.stopped {
+		return r.r.Read(p)
+	}
+
+	remaining := r.limit - len(r.data)
+	if remaining <= 0 {
+		return 0, errProbeTooLarge
+	}
+	if len(p) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := r.r.Read(p)
+	r.data = append(r.data, p[:n]...)
+
+	return n, err
+}
+
+func (r *recordingReader) stop() {
+	r.stopped = true
+	r.data = nil
+}
@@ -0,0 +1,204 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/sources/sourcestest"
+	"golang.org/x/exp/slog"
+)
+
+// opusPackets returns n 20ms CELT packets of the size.
+func opusPackets(n, size int) [][]byte {
+	packets := make([][]byte, n)
+	for i := range packets {
+		packet := make([]byte, size)
+		// config 31: CELT fullband 20ms, code 0: one frame
+		packet[0] = 31 << 3
+		packets[i] = packet
+	}
+
+	return packets
+}
+
+func TestCheckPassthroughBitrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		packets [][]byte
+		bitrate int
+		wantErr error
+	}{
+		// 320 bytes every 20ms are 128kbps
+		{name: "below the profile", packets: opusPackets(50, 320), bitrate: 160000},
+		{name: "equal to the profile", packets: opusPackets(50, 320), bitrate: 128000},
+		{name: "above the profile", packets: opusPackets(50, 320), bitrate: 64000, wantErr: errBitrateTooHigh},
+		{name: "profile without bitrate", packets: opusPackets(50, 320), bitrate: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPassthroughBitrate(tt.packets, bot.EncoderProfile{Bitrate: tt.bitrate})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("checkPassthroughBitrate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStreamOpus(t *testing.T) {
+	tests := []struct {
+		name          string
+		fixture       string
+		bitrate       int
+		volume        int
+		startPosition time.Duration
+		// wantFirstPacket is the index of the first packet passed through,
+		// -1 if the audio has to be transcoded
+		wantFirstPacket int
+		wantFrames      int
+	}{
+		{name: "webm", fixture: "opus_20ms.webm", wantFirstPacket: 0, wantFrames: 60},
+		{name: "ogg", fixture: "opus_20ms.ogg", wantFirstPacket: 0, wantFrames: 60},
+		{name: "ogg below the profile bitrate", fixture: "opus_20ms.ogg", bitrate: 64000, wantFirstPacket: 0, wantFrames: 60},
+		{name: "webm with start position", fixture: "opus_20ms.webm", startPosition: 200 * time.Millisecond, wantFirstPacket: 10, wantFrames: 50},
+		{name: "ogg with start position", fixture: "opus_20ms.ogg", startPosition: time.Second, wantFirstPacket: 50, wantFrames: 10},
+		{name: "webm above the profile bitrate", fixture: "opus_20ms.webm", bitrate: 24000, wantFirstPacket: -1, wantFrames: 20},
+		{name: "ogg with 60ms packets", fixture: "opus_60ms.ogg", wantFirstPacket: -1, wantFrames: 20},
+		{name: "ogg with default volume", fixture: "opus_20ms.ogg", volume: bot.DefaultVolume, wantFirstPacket: 0, wantFrames: 60},
+		{name: "ogg with changed volume", fixture: "opus_20ms.ogg", volume: 50, wantFirstPacket: -1, wantFrames: 20},
+		{name: "webm with vorbis", fixture: "vorbis.webm", wantFirstPacket: -1, wantFrames: 20},
+		{name: "transcode with start position", fixture: "vorbis.webm", startPosition: 200 * time.Millisecond, wantFirstPacket: -1, wantFrames: 20},
+		{name: "unknown container", fixture: "video.jsonl", wantFirstPacket: -1, wantFrames: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin := sourcestest.NewBin(t)
+			bin.Install("ffmpeg", sourcestest.Script{
+				Stdout:    sourcestest.PCM(400 * time.Millisecond),
+				ReadStdin: true,
+			})
+
+			data, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := bot.WithEncoderProfile(context.Background(), bot.EncoderProfile{
+				Application: bot.EncoderApplicationAudio,
+				Bitrate:     tt.bitrate,
+				Volume:      tt.volume,
+			})
+			logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+			stream := bot.NewAudioStream()
+			if err := streamOpus(ctx, bytes.NewReader(data), tt.startPosition, stream, "ffmpeg", logger); err != nil {
+				t.Fatalf("streamOpus() error = %v", err)
+			}
+			stream.Close(nil)
+
+			frames := make([][]byte, 0)
+			for frame := range stream.Frames() {
+				frames = append(frames, frame)
+			}
+			if len(frames) != tt.wantFrames {
+				t.Fatalf("streamOpus() sent %d frames, want %d", len(frames), tt.wantFrames)
+			}
+
+			calls := bin.Calls("ffmpeg")
+
+			if tt.wantFirstPacket < 0 {
+				if len(calls) != 1 {
+					t.Fatalf("ffmpeg was called %d times, want once", len(calls))
+				}
+				// the data read while probing is replayed
+				if !bytes.Equal(bin.Stdin("ffmpeg"), data) {
+					t.Error("ffmpeg did not receive the whole audio")
+				}
+
+				hasSeek := slices.Contains(calls[0], "-ss")
+				if hasSeek != (tt.startPosition > 0) {
+					t.Errorf("ffmpeg arguments = %q, want seeking %v", calls[0], tt.startPosition > 0)
+				}
+				return
+			}
+
+			if len(calls) != 0 {
+				t.Errorf("ffmpeg was called for passed through audio: %q", calls)
+			}
+			for i, frame := range frames {
+				if len(frame) < 2 || frame[1] != byte(tt.wantFirstPacket+i) {
+					t.Fatalf("frame %d is not packet %d", i, tt.wantFirstPacket+i)
+				}
+			}
+		})
+	}
+}
+
+func TestOpusPacketDuration(t *testing.T) {
+	toc := func(config, code byte) byte {
+		return config<<3 | code
+	}
+
+	tests := []struct {
+		name   string
+		packet []byte
+		want   time.Duration
+	}{
+		{name: "empty", packet: []byte{}, want: 0},
+
+		{name: "SILK 10ms code 0", packet: []byte{toc(0, 0)}, want: 10 * time.Millisecond},
+		{name: "SILK 20ms code 0", packet: []byte{toc(5, 0)}, want: 20 * time.Millisecond},
+		{name: "SILK 20ms code 1", packet: []byte{toc(1, 1)}, want: 40 * time.Millisecond},
+		{name: "SILK 60ms code 2", packet: []byte{toc(3, 2)}, want: 120 * time.Millisecond},
+		{name: "SILK 40ms code 3 with 3 frames", packet: []byte{toc(10, 3), 3}, want: 120 * time.Millisecond},
+
+		{name: "Hybrid 10ms code 0", packet: []byte{toc(12, 0)}, want: 10 * time.Millisecond},
+		{name: "Hybrid 20ms code 0", packet: []byte{toc(15, 0)}, want: 20 * time.Millisecond},
+		{name: "Hybrid 10ms code 2", packet: []byte{toc(14, 2)}, want: 20 * time.Millisecond},
+		{name: "Hybrid 20ms code 3 with 1 frame", packet: []byte{toc(13, 3), 0x81}, want: 20 * time.Millisecond},
+
+		{name: "CELT 2.5ms code 0", packet: []byte{toc(16, 0)}, want: 2500 * time.Microsecond},
+		{name: "CELT 20ms code 0", packet: []byte{toc(31, 0)}, want: 20 * time.Millisecond},
+		{name: "CELT 10ms code 1", packet: []byte{toc(30, 1)}, want: 20 * time.Millisecond},
+		{name: "CELT 5ms code 3 with 4 frames", packet: []byte{toc(25, 3), 4}, want: 20 * time.Millisecond},
+		{name: "CELT 2.5ms code 3 with 8 frames and padding", packet: []byte{toc(28, 3), 0x48}, want: 20 * time.Millisecond},
+		{name: "code 3 without frame count", packet: []byte{toc(31, 3)}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := opusPacketDuration(tt.packet); got != tt.want {
+				t.Errorf("opusPacketDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleVolume(t *testing.T) {
+	tests := []struct {
+		volume int
+		want   []int16
+	}{
+		{volume: 100, want: []int16{1000, -1000, 20000, -20000, math.MaxInt16, math.MinInt16}},
+		{volume: 50, want: []int16{500, -500, 10000, -10000, math.MaxInt16 / 2, math.MinInt16 / 2}},
+		{volume: 200, want: []int16{2000, -2000, math.MaxInt16, math.MinInt16, math.MaxInt16, math.MinInt16}},
+	}
+
+	for _, tt := range tests {
+		pcm := []int16{1000, -1000, 20000, -20000, math.MaxInt16, math.MinInt16}
+		scaleVolume(pcm, tt.volume)
+		if !slices.Equal(pcm, tt.want) {
+			t.Errorf("scaleVolume(%d) = %v, want %v", tt.volume, pcm, tt.want)
+		}
+	}
+}
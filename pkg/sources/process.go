@@ -0,0 +1,306 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// processWaitDelay is how long the output of a killed process is read, before
+// its pipes are closed.
+const processWaitDelay = 5 * time.Second
+
+// ProcessLimits are applied to the processes of the audio pipelines.
+type ProcessLimits struct {
+	// MaxPipelines is the number of songs, which can be downloaded and
+	// encoded at the same time across all guilds. Zero is unlimited.
+	MaxPipelines int
+	// MaxMemory limits the address space of each process in bytes. Zero is
+	// unlimited.
+	MaxMemory uint64
+	// Nice is the scheduling priority of the processes.
+	Nice int
+}
+
+// ProcessSupervisor runs the processes, which produce the audio of songs,
+// like yt-dlp and ffmpeg. The processes of a song form a pipeline, which
+// takes one of the limited slots while its processes run.
+type ProcessSupervisor struct {
+	Logger *slog.Logger
+
+	limits ProcessLimits
+	slots  chan struct{}
+
+	mutex     sync.Mutex
+	pipelines map[int]*Pipeline
+	nextID    int
+}
+
+func NewProcessSupervisor(limits ProcessLimits) *ProcessSupervisor {
+	s := &ProcessSupervisor{
+		Logger:    slog.Default(),
+		limits:    limits,
+		pipelines: make(map[int]*Pipeline),
+	}
+
+	if limits.MaxPipelines > 0 {
+		s.slots = make(chan struct{}, limits.MaxPipelines)
+	}
+
+	return s
+}
+
+// Pipeline is a group of processes producing the audio of a song.
+type Pipeline struct {
+	supervisor *ProcessSupervisor
+
+	id        int
+	name      string
+	startedAt time.Time
+
+	mutex     sync.Mutex
+	hasSlot   bool
+	processes map[*exec.Cmd]time.Time
+	closed    bool
+}
+
+// PipelineInfo describes a running pipeline for diagnostics.
+type PipelineInfo struct {
+	ID        int
+	Name      string
+	StartedAt time.Time
+	Processes []ProcessInfo
+}
+
+type ProcessInfo struct {
+	PID       int
+	Command   string
+	StartedAt time.Time
+}
+
+// NewPipeline registers a pipeline. It has to be closed, when its processes
+// finished.
+func (s *ProcessSupervisor) NewPipeline(name string) *Pipeline {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextID++
+	p := &Pipeline{
+		supervisor: s,
+		id:         s.nextID,
+		name:       name,
+		startedAt:  time.Now(),
+		processes:  make(map[*exec.Cmd]time.Time),
+	}
+	s.pipelines[p.id] = p
+
+	return p
+}
+
+// Pipelines returns the registered pipelines, the oldest first.
+func (s *ProcessSupervisor) Pipelines() []PipelineInfo {
+	s.mutex.Lock()
+	pipelines := make([]*Pipeline, 0, len(s.pipelines))
+	for _, p := range s.pipelines {
+		pipelines = append(pipelines, p)
+	}
+	s.mutex.Unlock()
+
+	infos := make([]PipelineInfo, 0, len(pipelines))
+	for _, p := range pipelines {
+		infos = append(infos, p.info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+
+	return infos
+}
+
+func (p *Pipeline) info() PipelineInfo {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	info := PipelineInfo{
+		ID:        p.id,
+		Name:      p.name,
+		StartedAt: p.startedAt,
+		Processes: make([]ProcessInfo, 0, len(p.processes)),
+	}
+	for cmd, startedAt := range p.processes {
+		info.Processes = append(info.Processes, ProcessInfo{
+			PID:       cmd.Process.Pid,
+			Command:   strings.Join(commandArgs(cmd), " "),
+			StartedAt: startedAt,
+		})
+	}
+	sort.Slice(info.Processes, func(i, j int) bool {
+		return info.Processes[i].StartedAt.Before(info.Processes[j].StartedAt)
+	})
+
+	return info
+}
+
+// start starts the command, waiting for a free slot, if the pipeline does
+// not have one yet.
+func (p *Pipeline) start(ctx context.Context, cmd *exec.Cmd) error {
+	if err := p.acquireSlot(ctx); err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	p.mutex.Lock()
+	p.processes[cmd] = time.Now()
+	p.mutex.Unlock()
+
+	return nil
+}
+
+func (p *Pipeline) acquireSlot(ctx context.Context) error {
+	p.mutex.Lock()
+	closed, hasSlot := p.closed, p.hasSlot
+	p.mutex.Unlock()
+
+	if closed {
+		return fmt.Errorf("pipeline %d is closed", p.id)
+	}
+	if hasSlot || p.supervisor.slots == nil {
+		return nil
+	}
+
+	select {
+	case p.supervisor.slots <- struct{}{}:
+	default:
+		p.supervisor.Logger.Info("waiting for a free pipeline slot", "pipeline", p.name)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case p.supervisor.slots <- struct{}{}:
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// the pipeline was closed or got a slot in the meantime
+	if p.closed || p.hasSlot {
+		<-p.supervisor.slots
+		if p.closed {
+			return fmt.Errorf("pipeline %d is closed", p.id)
+		}
+		return nil
+	}
+
+	p.hasSlot = true
+	return nil
+}
+
+func (p *Pipeline) finished(cmd *exec.Cmd) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.processes, cmd)
+}
+
+// Close unregisters the pipeline and frees its slot.
+func (p *Pipeline) Close() {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	if !p.closed && p.hasSlot {
+		<-p.supervisor.slots
+	}
+	p.closed = true
+	p.hasSlot = false
+	p.mutex.Unlock()
+
+	p.supervisor.mutex.Lock()
+	delete(p.supervisor.pipelines, p.id)
+	p.supervisor.mutex.Unlock()
+}
+
+type pipelineKey struct{}
+
+func withPipeline(ctx context.Context, p *Pipeline) context.Context {
+	return context.WithValue(ctx, pipelineKey{}, p)
+}
+
+// newCommand creates a command, which is killed with all its children, when
+// the context is done. In the pipeline of the context, the command runs with
+// the limits of its supervisor.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if p, ok := ctx.Value(pipelineKey{}).(*Pipeline); ok {
+		name, args = limitCommand(p.supervisor.limits, name, args)
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = processWaitDelay
+
+	return cmd
+}
+
+// startCommand starts the command in the pipeline of the context, if there
+// is one.
+func startCommand(ctx context.Context, cmd *exec.Cmd) error {
+	if p, ok := ctx.Value(pipelineKey{}).(*Pipeline); ok {
+		return p.start(ctx, cmd)
+	}
+
+	return cmd.Start()
+}
+
+// outputCommand runs the command created with newCommand and returns its
+// standard output.
+func outputCommand(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	stdout := &bytes.Buffer{}
+	cmd.Stdout = stdout
+
+	if err := startCommand(ctx, cmd); err != nil {
+		return nil, err
+	}
+
+	if err := waitCommand(ctx, cmd); err != nil {
+		return nil, err
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// waitCommand waits for the command started with startCommand.
+func waitCommand(ctx context.Context, cmd *exec.Cmd) error {
+	err := cmd.Wait()
+
+	if p, ok := ctx.Value(pipelineKey{}).(*Pipeline); ok {
+		p.finished(cmd)
+	}
+
+	return err
+}
+
+// limitWrapperName is the $0 of the shell applying the limits, which marks
+// wrapped commands.
+const limitWrapperName = "airplay-limits"
+
+// commandArgs returns the arguments of the command without the shell
+// applying the limits.
+func commandArgs(cmd *exec.Cmd) []string {
+	if len(cmd.Args) > 4 && cmd.Args[3] == limitWrapperName {
+		return cmd.Args[4:]
+	}
+
+	return cmd.Args
+}
@@ -0,0 +1,44 @@
+package sources
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group, so children
+// of the command are killed with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// limitCommand wraps the command in a shell, which applies the limits and
+// then replaces itself with the command, so the command never runs without
+// them. Commands, which cannot be found, are not wrapped, so starting them
+// fails as usual.
+func limitCommand(limits ProcessLimits, name string, args []string) (string, []string) {
+	if limits.MaxMemory == 0 && limits.Nice == 0 {
+		return name, args
+	}
+
+	if _, err := exec.LookPath(name); err != nil {
+		return name, args
+	}
+
+	script := make([]string, 0, 2)
+	if limits.MaxMemory > 0 {
+		// ulimit takes KiB
+		script = append(script, fmt.Sprintf(`ulimit -v %d || echo "failed to set the memory limit" >&2`, limits.MaxMemory/1024))
+	}
+	if limits.Nice != 0 {
+		script = append(script, fmt.Sprintf(`exec nice -n %d "$@"`, limits.Nice))
+	} else {
+		script = append(script, `exec "$@"`)
+	}
+
+	return "sh", append([]string{"-c", strings.Join(script, "\n"), limitWrapperName, name}, args...)
+}
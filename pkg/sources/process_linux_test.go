@@ -0,0 +1,51 @@
+package sources
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewCommandAppliesLimitsBeforeExec(t *testing.T) {
+	supervisor := NewProcessSupervisor(ProcessLimits{
+		MaxMemory: 512 * 1024 * 1024,
+		Nice:      3,
+	})
+	pipeline := supervisor.NewPipeline("test")
+	defer pipeline.Close()
+	ctx := withPipeline(context.Background(), pipeline)
+
+	// the limits are read by the command itself, so they are set when it starts
+	cmd := newCommand(ctx, "sh", "-c", `echo "$(ulimit -v) $(nice)"`)
+	if got := commandArgs(cmd); !slices.Equal(got, []string{"sh", "-c", `echo "$(ulimit -v) $(nice)"`}) {
+		t.Errorf("commandArgs() = %q", got)
+	}
+
+	out, err := outputCommand(ctx, cmd)
+	if err != nil {
+		t.Fatalf("outputCommand() error = %v", err)
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) != 2 || fields[0] != "524288" {
+		t.Fatalf("command output = %q, want the memory limit of 524288 KiB", out)
+	}
+	if fields[1] == "0" {
+		t.Errorf("command niceness = %s, want a lowered priority", fields[1])
+	}
+}
+
+func TestNewCommandWithoutPipeline(t *testing.T) {
+	cmd := newCommand(context.Background(), "ffmpeg", "-i", "pipe:0")
+	if !slices.Equal(cmd.Args, []string{"ffmpeg", "-i", "pipe:0"}) {
+		t.Errorf("newCommand() args = %q, want the command unchanged", cmd.Args)
+	}
+}
+
+func TestLimitCommandMissingBinary(t *testing.T) {
+	name, args := limitCommand(ProcessLimits{Nice: 5}, "airplay-missing-binary", []string{"-v"})
+	if name != "airplay-missing-binary" || !slices.Equal(args, []string{"-v"}) {
+		t.Errorf("limitCommand() = %s %q, want the command unchanged", name, args)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package sources
+
+import "os/exec"
+
+// setProcessGroup is supported on Linux only. Elsewhere only the command is
+// killed, when its context is done.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// limitCommand is supported on Linux only. Elsewhere the commands run without
+// limits.
+func limitCommand(limits ProcessLimits, name string, args []string) (string, []string) {
+	return name, args
+}
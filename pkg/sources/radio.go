@@ -0,0 +1,471 @@
+package sources
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	RadioSongType = "radio"
+
+	maxStationFileSize = 64 * 1024
+)
+
+var (
+	ErrNotAStream     = errors.New("URL is not an audio stream")
+	ErrPrivateAddress = errors.New("stream address is not public")
+)
+
+// RadioFetcher plays continuous HTTP audio streams, like Icecast, Shoutcast
+// or HLS. M3U and PLS station files are resolved to the streams they list.
+// Streams on loopback, private and link-local addresses are refused, so the
+// URLs given by users cannot reach the network of the bot.
+type RadioFetcher struct {
+	Logger *slog.Logger
+
+	client       *http.Client
+	ffmpegBinary string
+	// allowPrivate disables the address check, for tests with local servers.
+	allowPrivate bool
+}
+
+type RadioFetcherOption func(f *RadioFetcher)
+
+// WithRadioFFmpegBinary sets the path of ffmpeg, an empty path keeps the
+// default.
+func WithRadioFFmpegBinary(path string) RadioFetcherOption {
+	return func(f *RadioFetcher) {
+		if path != "" {
+			f.ffmpegBinary = path
+		}
+	}
+}
+
+func NewRadioFetcher(opts ...RadioFetcherOption) *RadioFetcher {
+	f := &RadioFetcher{
+		Logger:       slog.Default(),
+		ffmpegBinary: defaultFFmpegBinary,
+	}
+
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	dialer := &net.Dialer{
+		Control: f.checkDialAddress,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// the addresses are checked when dialing, which a proxy would bypass
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	f.client = &http.Client{Transport: transport}
+
+	return f
+}
+
+func (f *RadioFetcher) LookupSongs(ctx context.Context, input string) ([]*bot.Song, error) {
+	u, err := parseStreamURL(strings.TrimSpace(input))
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("while creating request: %w", err)
+	}
+	req.Header.Set("Icy-MetaData", "1")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("while requesting stream: %w", err)
+	}
+	// the body of a stream never ends, so only the beginning is read
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	switch {
+	case isPlaylistContentType(contentType) || hasPlaylistExtension(u.Path):
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxStationFileSize))
+		if err != nil {
+			return nil, fmt.Errorf("while reading station file: %w", err)
+		}
+
+		if bytes.Contains(data, []byte("#EXT-X-")) {
+			// HLS playlists are played by ffmpeg directly
+			return []*bot.Song{newRadioSong(u.String(), stationName(resp, u))}, nil
+		}
+
+		return parseStationFile(data, u)
+
+	case strings.HasPrefix(contentType, "audio/") || contentType == "application/ogg" || resp.Header.Get("icy-metaint") != "":
+		return []*bot.Song{newRadioSong(u.String(), stationName(resp, u))}, nil
+
+	default:
+		return nil, ErrNotAStream
+	}
+}
+
+func (f *RadioFetcher) GetAudio(ctx context.Context, song *bot.Song) (*bot.AudioStream, error) {
+	u, err := parseStreamURL(song.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	ffmpegArgs := []string{"-i", u.String(), "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1"}
+
+	var stdin io.ReadCloser
+
+	if strings.Contains(strings.ToLower(u.Path), ".m3u8") {
+		// ffmpeg fetches HLS streams itself, so the host is checked up front
+		if err := f.checkHost(ctx, u.Hostname()); err != nil {
+			return nil, err
+		}
+	} else {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, song.URL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("while creating request: %w", err)
+		}
+		req.Header.Set("Icy-MetaData", "1")
+
+		resp, err := f.client.Do(req)
+		if errors.Is(err, ErrPrivateAddress) {
+			return nil, fmt.Errorf("while requesting stream: %w", err)
+		} else if err != nil {
+			return nil, fmt.Errorf("while requesting stream: %w: %w", bot.ErrNetwork, err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+
+		stdin = resp.Body
+		if metaInt, err := strconv.Atoi(resp.Header.Get("icy-metaint")); err == nil && metaInt > 0 {
+			stdin = newIcyReader(resp.Body, metaInt, func(title string) {
+				bot.ReportStreamTitle(ctx, title)
+			})
+		}
+
+		ffmpegArgs[1] = "pipe:0"
+	}
+
+	cmd := newCommand(ctx, f.ffmpegBinary, ffmpegArgs...)
+	stderrBuf := &bytes.Buffer{}
+	cmd.Stderr = stderrBuf
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("while creating ffmpeg pipe: %w", err)
+	}
+
+	if err := startCommand(ctx, cmd); err != nil {
+		if stdin != nil {
+			stdin.Close()
+		}
+		return nil, fmt.Errorf("while starting ffmpeg: %w", err)
+	}
+
+	stream := bot.NewAudioStream()
+
+	go func() {
+		if stdin != nil {
+			defer stdin.Close()
+		}
+
+		streamErr := encodeOpus(ctx, stdout, stream)
+
+		if err := waitCommand(ctx, cmd); err != nil && ctx.Err() == nil {
+			stream.SetDiagnostics(diagnostics(stderrBuf.String()))
+			streamErr = classifyError(fmt.Errorf("while executing ffmpeg: %w", err), stderrBuf.String())
+		}
+
+		if ctx.Err() != nil {
+			streamErr = nil
+		}
+		stream.Close(streamErr)
+	}()
+
+	return stream, nil
+}
+
+// checkDialAddress is the net.Dialer control function, which refuses
+// connections to non-public addresses. It runs after the name is resolved, so
+// it also covers redirects and DNS names pointing to private addresses.
+func (f *RadioFetcher) checkDialAddress(network, address string, _ syscall.RawConn) error {
+	if f.allowPrivate {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("while parsing address: %w", err)
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+
+	return nil
+}
+
+// checkHost resolves the host and refuses it, if any of its addresses is not
+// public.
+func (f *RadioFetcher) checkHost(ctx context.Context, host string) error {
+	if f.allowPrivate {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("while resolving stream host: %w: %w", bot.ErrNetwork, err)
+	}
+
+	for _, addr := range addrs {
+		if !isPublicIP(addr.IP) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+		}
+	}
+
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast()
+}
+
+func parseStreamURL(input string) (*url.URL, error) {
+	u, err := url.Parse(input)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid stream URL: %s", input)
+	}
+
+	return u, nil
+}
+
+func newRadioSong(streamURL, name string) *bot.Song {
+	return &bot.Song{
+		Type:     RadioSongType,
+		Title:    name,
+		URL:      streamURL,
+		Playable: true,
+		Live:     true,
+	}
+}
+
+func stationName(resp *http.Response, u *url.URL) string {
+	if name := strings.TrimSpace(resp.Header.Get("icy-name")); name != "" {
+		return name
+	}
+
+	return u.Host
+}
+
+func isPlaylistContentType(contentType string) bool {
+	switch contentType {
+	case "audio/x-mpegurl", "audio/mpegurl", "application/x-mpegurl", "application/vnd.apple.mpegurl", "audio/x-scpls", "application/pls+xml":
+		return true
+	default:
+		return false
+	}
+}
+
+func hasPlaylistExtension(path string) bool {
+	path = strings.ToLower(path)
+	return strings.HasSuffix(path, ".m3u") || strings.HasSuffix(path, ".m3u8") || strings.HasSuffix(path, ".pls")
+}
+
+// parseStationFile parses M3U and PLS files, returning a song for every
+// stream listed.
+func parseStationFile(data []byte, base *url.URL) ([]*bot.Song, error) {
+	isPLS := bytes.Contains(bytes.ToLower(data), []byte("[playlist]"))
+
+	files := map[string]string{}
+	titles := map[string]string{}
+	order := []string{}
+
+	var pendingTitle string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if isPLS {
+			key, value, found := strings.Cut(line, "=")
+			if !found {
+				continue
+			}
+
+			key = strings.ToLower(strings.TrimSpace(key))
+			switch {
+			case strings.HasPrefix(key, "file"):
+				index := strings.TrimPrefix(key, "file")
+				files[index] = strings.TrimSpace(value)
+				order = append(order, index)
+			case strings.HasPrefix(key, "title"):
+				titles[strings.TrimPrefix(key, "title")] = strings.TrimSpace(value)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "#EXTINF:") {
+			if _, title, found := strings.Cut(line, ","); found {
+				pendingTitle = strings.TrimSpace(title)
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		index := strconv.Itoa(len(order))
+		files[index] = line
+		titles[index] = pendingTitle
+		order = append(order, index)
+		pendingTitle = ""
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("while reading station file: %w", err)
+	}
+
+	songs := make([]*bot.Song, 0, len(order))
+	for _, index := range order {
+		streamURL, err := base.Parse(files[index])
+		if err != nil || (streamURL.Scheme != "http" && streamURL.Scheme != "https") {
+			continue
+		}
+
+		name := titles[index]
+		if name == "" {
+			name = streamURL.Host
+		}
+
+		songs = append(songs, newRadioSong(streamURL.String(), name))
+	}
+
+	if len(songs) == 0 {
+		return nil, ErrNotAStream
+	}
+
+	return songs, nil
+}
+
+// icyReader strips the ICY metadata blocks, which Shoutcast and Icecast
+// servers interleave with the audio every metaInt bytes.
+type icyReader struct {
+	reader    io.ReadCloser
+	metaInt   int
+	remaining int
+	onTitle   func(title string)
+	lastTitle string
+}
+
+func newIcyReader(r io.ReadCloser, metaInt int, onTitle func(string)) *icyReader {
+	return &icyReader{
+		reader:    r,
+		metaInt:   metaInt,
+		remaining: metaInt,
+		onTitle:   onTitle,
+	}
+}
+
+func (r *icyReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		if err := r.readMetadata(); err != nil {
+			return 0, err
+		}
+		r.remaining = r.metaInt
+	}
+
+	if len(p) > r.remaining {
+		p = p[:r.remaining]
+	}
+
+	n, err := r.reader.Read(p)
+	r.remaining -= n
+	return n, err
+}
+
+func (r *icyReader) Close() error {
+	return r.reader.Close()
+}
+
+func (r *icyReader) readMetadata() error {
+	lengthBuf := make([]byte, 1)
+	if _, err := io.ReadFull(r.reader, lengthBuf); err != nil {
+		return err
+	}
+
+	length := int(lengthBuf[0]) * 16
+	if length == 0 {
+		return nil
+	}
+
+	metadata := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, metadata); err != nil {
+		return err
+	}
+
+	title, ok := parseStreamTitle(string(bytes.TrimRight(metadata, "\x00")))
+	if ok && title != r.lastTitle {
+		r.lastTitle = title
+		r.onTitle(title)
+	}
+
+	return nil
+}
+
+// parseStreamTitle extracts the title from metadata like
+// StreamTitle='Artist - Title';StreamUrl='http://example.com';
+func parseStreamTitle(metadata string) (string, bool) {
+	const key = "StreamTitle='"
+
+	start := strings.Index(metadata, key)
+	if start < 0 {
+		return "", false
+	}
+	value := metadata[start+len(key):]
+
+	end := strings.Index(value, "';")
+	if end < 0 {
+		end = strings.LastIndex(value, "'")
+	}
+	if end < 0 {
+		return "", false
+	}
+
+	return strings.TrimSpace(value[:end]), true
+}
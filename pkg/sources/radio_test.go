@@ -0,0 +1,172 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/sources/sourcestest"
+)
+
+func newRadioTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("icy-name", "Test FM")
+		w.Write([]byte("ID3"))
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/station.pls", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/x-scpls")
+		w.Write([]byte("[playlist]\nFile1=/stream\nTitle1=Test FM\nFile2=file:///etc/passwd\nNumberOfEntries=2\n"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/stream", http.StatusFound)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestRadioFetcherLookupSongs(t *testing.T) {
+	server := newRadioTestServer(t)
+
+	tests := []struct {
+		path      string
+		wantNames []string
+		wantErr   error
+	}{
+		{path: "/stream", wantNames: []string{"Test FM"}},
+		{path: "/redirect", wantNames: []string{"Test FM"}},
+		{path: "/station.pls", wantNames: []string{"Test FM"}},
+		{path: "/page", wantErr: ErrNotAStream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			fetcher := NewRadioFetcher()
+			fetcher.allowPrivate = true
+
+			songs, err := fetcher.LookupSongs(context.Background(), server.URL+tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("LookupSongs() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LookupSongs() error = %v", err)
+			}
+
+			if len(songs) != len(tt.wantNames) {
+				t.Fatalf("LookupSongs() returned %d songs, want %d", len(songs), len(tt.wantNames))
+			}
+			for i, song := range songs {
+				if song.Title != tt.wantNames[i] || !song.Live || song.Type != RadioSongType {
+					t.Errorf("LookupSongs()[%d] = %+v", i, song)
+				}
+			}
+		})
+	}
+}
+
+func TestRadioFetcherRefusesPrivateAddresses(t *testing.T) {
+	server := newRadioTestServer(t)
+	fetcher := NewRadioFetcher()
+
+	for _, input := range []string{server.URL + "/stream", server.URL + "/station.pls"} {
+		if _, err := fetcher.LookupSongs(context.Background(), input); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("LookupSongs(%s) error = %v, want %v", input, err, ErrPrivateAddress)
+		}
+	}
+
+	_, err := fetcher.GetAudio(context.Background(), &bot.Song{URL: server.URL + "/stream"})
+	if !errors.Is(err, ErrPrivateAddress) || errors.Is(err, bot.ErrNetwork) {
+		t.Errorf("GetAudio() error = %v, want %v", err, ErrPrivateAddress)
+	}
+
+	_, err = fetcher.GetAudio(context.Background(), &bot.Song{URL: "http://localhost/live.m3u8"})
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("GetAudio() of HLS error = %v, want %v", err, ErrPrivateAddress)
+	}
+}
+
+func TestRadioFetcherRefusesOtherSchemes(t *testing.T) {
+	fetcher := NewRadioFetcher()
+
+	for _, input := range []string{"file:///etc/passwd", "ftp://example.com/stream", "/etc/passwd"} {
+		if _, err := fetcher.LookupSongs(context.Background(), input); err == nil {
+			t.Errorf("LookupSongs(%s) error = nil, want an error", input)
+		}
+		if _, err := fetcher.GetAudio(context.Background(), &bot.Song{URL: input}); err == nil {
+			t.Errorf("GetAudio(%s) error = nil, want an error", input)
+		}
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "93.184.216.34", want: true},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{ip: "127.0.0.1", want: false},
+		{ip: "::1", want: false},
+		{ip: "10.0.0.1", want: false},
+		{ip: "172.16.5.4", want: false},
+		{ip: "192.168.1.1", want: false},
+		{ip: "169.254.169.254", want: false},
+		{ip: "fe80::1", want: false},
+		{ip: "fd00::1", want: false},
+		{ip: "0.0.0.0", want: false},
+		{ip: "224.0.0.1", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRadioFetcherGetAudioUsesFFmpegBinary(t *testing.T) {
+	server := newRadioTestServer(t)
+
+	bin := sourcestest.NewBin(t)
+	ffmpeg := bin.Install("custom-ffmpeg", sourcestest.Script{
+		Stdout:    sourcestest.PCM(100 * time.Millisecond),
+		ReadStdin: true,
+	})
+
+	fetcher := NewRadioFetcher(WithRadioFFmpegBinary(ffmpeg))
+	fetcher.allowPrivate = true
+
+	stream, err := fetcher.GetAudio(context.Background(), &bot.Song{URL: server.URL + "/stream"})
+	if err != nil {
+		t.Fatalf("GetAudio() error = %v", err)
+	}
+	if frames := readStream(t, stream); frames != 5 {
+		t.Errorf("GetAudio() sent %d frames, want 5", frames)
+	}
+
+	calls := bin.Calls("custom-ffmpeg")
+	if len(calls) != 1 || calls[0][1] != "pipe:0" {
+		t.Errorf("ffmpeg calls = %q, want the stream read from stdin", calls)
+	}
+	if string(bin.Stdin("custom-ffmpeg")) != "ID3" {
+		t.Errorf("ffmpeg input = %q, want the stream", bin.Stdin("custom-ffmpeg"))
+	}
+}
@@ -0,0 +1,500 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/config"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	ErrNoProvider      = errors.New("no provider found")
+	ErrUnknownSongType = errors.New("unknown song type")
+)
+
+type Provider interface {
+	LookupSongs(ctx context.Context, input string) ([]*bot.Song, error)
+	GetAudio(ctx context.Context, song *bot.Song) (*bot.AudioStream, error)
+}
+
+// Resolver is implemented by providers, which return partial songs.
+type Resolver interface {
+	ResolveSong(ctx context.Context, song *bot.Song) (*bot.Song, error)
+}
+
+// RelatedProvider is implemented by providers, which can find songs related
+// to a song, e.g. for autoplay.
+type RelatedProvider interface {
+	RelatedSongs(ctx context.Context, song *bot.Song) ([]*bot.Song, error)
+}
+
+// ProviderSpec describes, which input is handled by a provider.
+type ProviderSpec struct {
+	// Name can be used as an explicit prefix of the input, e.g. `yt:`.
+	Name string
+	// SongType is the bot.Song.Type of songs returned by the provider.
+	SongType string
+	// Schemes and Hosts match URLs given as input. Hosts match subdomains too.
+	Schemes []string
+	Hosts   []string
+	// Extensions match the file extension of URL paths, e.g. `.pls`.
+	Extensions []string
+	// Match can claim input, which cannot be described by the fields above.
+	Match func(input string) bool
+	// Fallback providers are tried in registration order for input, which
+	// does not match any provider.
+	Fallback bool
+	// Rewrite is applied to the input given with the explicit prefix.
+	Rewrite func(input string) string
+	// Cache enables the audio cache for the songs of the provider.
+	Cache bool
+}
+
+type registeredProvider struct {
+	spec     ProviderSpec
+	provider Provider
+}
+
+// Registry dispatches song lookups to providers by the input and audio
+// fetching by the song type.
+type Registry struct {
+	Logger *slog.Logger
+
+	providers  []registeredProvider
+	cache      *AudioCache
+	supervisor *ProcessSupervisor
+	ytDlp      *YtDlpManager
+
+	segmentRules *SegmentRules
+}
+
+// Diagnostics describes the state of the audio sources.
+type Diagnostics struct {
+	YtDlp     *YtDlpStatus
+	Pipelines []PipelineInfo
+	// Cache is nil, when the audio cache is disabled.
+	Cache *CacheStats
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		Logger:    slog.Default(),
+		providers: make([]registeredProvider, 0),
+	}
+}
+
+// NewRegistryFromConfig creates a registry with all built-in providers
+// enabled in the config. It fails, when a file required by the config cannot
+// be read.
+func NewRegistryFromConfig(ctx context.Context, cfg *config.Config) (*Registry, error) {
+	// the file is read before any provider starts, so an invalid config does
+	// not leave them running
+	var extractorArgs []string
+	if cfg.YtDlp.ExtractorArgsFile != "" {
+		args, err := readExtractorArgs(cfg.YtDlp.ExtractorArgsFile)
+		if err != nil {
+			return nil, fmt.Errorf("while reading yt-dlp extractor args file: %w", err)
+		}
+		extractorArgs = args
+	}
+
+	registry := NewRegistry()
+
+	supervisor := NewProcessSupervisor(ProcessLimits{
+		MaxPipelines: cfg.Process.MaxPipelines,
+		MaxMemory:    uint64(cfg.Process.MaxMemoryMB) * 1024 * 1024,
+		Nice:         cfg.Process.Nice,
+	})
+	registry.WithSupervisor(supervisor)
+
+	if cfg.LocalLibrary.Dir != "" {
+		localLibrary := NewLocalLibrary(cfg.LocalLibrary.Dir,
+			WithCovers(cfg.LocalLibrary.CoverDir, cfg.LocalLibrary.CoverURL),
+			WithLibrarySupervisor(supervisor),
+			WithLibraryBinaries(cfg.YtDlp.FFmpegBinary, cfg.YtDlp.FFprobeBinary),
+		)
+		go localLibrary.Run(ctx, cfg.LocalLibrary.RescanInterval)
+
+		// the library is searched only with the explicit `file:` prefix, so a
+		// loose match of a file does not shadow the yt-dlp search
+		registry.Register(localLibrary, ProviderSpec{
+			Name:     "file",
+			SongType: LocalSongType,
+		})
+	}
+
+	if cfg.Cache.Dir != "" {
+		cache, err := NewAudioCache(cfg.Cache.Dir, int64(cfg.Cache.MaxSizeMB)*1024*1024)
+		if err != nil {
+			registry.Logger.Error("failed to create audio cache, songs will not be cached", "error", err)
+		} else {
+			registry.WithCache(cache)
+		}
+	}
+
+	youtubeFetcherOpts := []Option{
+		WithDefaultSearchBackends(cfg.YtDlp.SearchBackend, cfg.YtDlp.SearchFallback),
+		WithYtDlpBinary(cfg.YtDlp.Binary),
+		WithFFmpegBinary(cfg.YtDlp.FFmpegBinary),
+		WithFormat(cfg.YtDlp.Format),
+		WithRateLimit(cfg.YtDlp.RateLimit),
+		WithCookiesFile(cfg.YtDlp.CookiesFile),
+		WithNetrcFile(cfg.YtDlp.NetrcFile),
+		WithExtraArgs(cfg.YtDlp.ExtraArgs...),
+		WithSponsorBlock(cfg.YtDlp.SponsorBlockCategories...),
+		WithLookupSupervisor(supervisor),
+	}
+	if cfg.YtDlp.Proxy != "" {
+		youtubeFetcherOpts = append(youtubeFetcherOpts, WithProxy(cfg.YtDlp.Proxy))
+	}
+	if len(extractorArgs) > 0 {
+		youtubeFetcherOpts = append(youtubeFetcherOpts, WithExtractorArgs(extractorArgs...))
+	}
+
+	ytDlp := NewYtDlpManager(cfg.YtDlp.Binary)
+	if _, err := ytDlp.DetectVersion(ctx); err != nil {
+		registry.Logger.Error("failed to detect yt-dlp", "error", err)
+	}
+	go ytDlp.Run(ctx, cfg.YtDlp.UpdateInterval)
+	registry.WithYtDlp(ytDlp)
+	youtubeFetcher := NewYoutubeFetcher(youtubeFetcherOpts...)
+
+	registry.Register(youtubeFetcher, ProviderSpec{
+		Name:     "yt",
+		SongType: YtDlpSongType,
+		Schemes:  []string{"http", "https"},
+		Fallback: true,
+		Match:    ytDlpSearchPrefix.MatchString,
+		Rewrite:  searchRewrite("ytsearch"),
+		Cache:    true,
+	})
+	registry.Register(youtubeFetcher, ProviderSpec{
+		Name:     "sc",
+		SongType: YtDlpSongType,
+		Rewrite:  searchRewrite("scsearch"),
+		Cache:    true,
+	})
+
+	// streams without a station file extension are played by yt-dlp, unless
+	// they are forced with the `radio:` prefix
+	registry.Register(NewRadioFetcher(WithRadioFFmpegBinary(cfg.YtDlp.FFmpegBinary)), ProviderSpec{
+		Name:       "radio",
+		SongType:   RadioSongType,
+		Extensions: []string{".pls", ".m3u", ".m3u8"},
+	})
+
+	if cfg.Segments.RulesFile != "" {
+		rules, err := LoadSegmentRules(cfg.Segments.RulesFile)
+		if err != nil {
+			registry.Logger.Error("failed to load segment rules, segments will not be skipped", "error", err)
+		} else {
+			registry.WithSegmentRules(rules)
+		}
+	}
+
+	return registry, nil
+}
+
+func (r *Registry) WithCache(cache *AudioCache) *Registry {
+	r.cache = cache
+	return r
+}
+
+func (r *Registry) WithSupervisor(supervisor *ProcessSupervisor) *Registry {
+	r.supervisor = supervisor
+	return r
+}
+
+func (r *Registry) WithSegmentRules(rules *SegmentRules) *Registry {
+	r.segmentRules = rules
+	return r
+}
+
+func (r *Registry) WithYtDlp(manager *YtDlpManager) *Registry {
+	r.ytDlp = manager
+	return r
+}
+
+// Diagnostics returns the yt-dlp version, the running audio pipelines and the
+// audio cache counters.
+func (r *Registry) Diagnostics() Diagnostics {
+	diagnostics := Diagnostics{
+		Pipelines: r.Pipelines(),
+	}
+
+	if r.ytDlp != nil {
+		status := r.ytDlp.Status()
+		diagnostics.YtDlp = &status
+	}
+
+	if r.cache != nil {
+		stats := r.cache.Stats()
+		diagnostics.Cache = &stats
+	}
+
+	return diagnostics
+}
+
+// Pipelines returns the running audio pipelines for diagnostics.
+func (r *Registry) Pipelines() []PipelineInfo {
+	if r.supervisor == nil {
+		return []PipelineInfo{}
+	}
+
+	return r.supervisor.Pipelines()
+}
+
+func (r *Registry) Register(provider Provider, spec ProviderSpec) *Registry {
+	r.providers = append(r.providers, registeredProvider{
+		spec:     spec,
+		provider: provider,
+	})
+	return r
+}
+
+func (r *Registry) LookupSongs(ctx context.Context, input string) ([]*bot.Song, error) {
+	input = strings.TrimSpace(input)
+
+	candidates, input := r.match(input)
+	if len(candidates) == 0 {
+		return nil, ErrNoProvider
+	}
+
+	var errs []error
+	for _, p := range candidates {
+		providerInput := input
+		if p.spec.Rewrite != nil && p.explicit {
+			providerInput = p.spec.Rewrite(input)
+		}
+
+		songs, err := p.provider.LookupSongs(ctx, providerInput)
+		if err != nil {
+			r.Logger.Info("provider failed to lookup songs", "provider", p.spec.Name, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.spec.Name, err))
+			continue
+		}
+
+		if len(songs) == 0 {
+			continue
+		}
+
+		for _, song := range songs {
+			if song.Type == "" {
+				song.Type = p.spec.SongType
+			}
+		}
+
+		return songs, nil
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return []*bot.Song{}, nil
+}
+
+func (r *Registry) GetAudio(ctx context.Context, song *bot.Song) (*bot.AudioStream, error) {
+	p, err := r.providerForSong(song)
+	if err != nil {
+		return nil, err
+	}
+
+	var pipeline *Pipeline
+	if r.supervisor != nil {
+		pipeline = r.supervisor.NewPipeline(song.URL)
+		ctx = withPipeline(ctx, pipeline)
+	}
+
+	var stream *bot.AudioStream
+	if r.cache != nil && p.spec.Cache && !song.Live {
+		stream, err = r.cache.GetAudio(ctx, song, p.provider.GetAudio)
+	} else {
+		stream, err = p.provider.GetAudio(ctx, song)
+	}
+	if err != nil {
+		pipeline.Close()
+		return nil, err
+	}
+
+	if pipeline != nil {
+		go func() {
+			<-stream.Done()
+			pipeline.Close()
+		}()
+	}
+
+	return stream, nil
+}
+
+// ResolveSong fetches the full metadata of a partial song. Songs of providers,
+// which do not return partial songs, are returned unchanged.
+func (r *Registry) ResolveSong(ctx context.Context, song *bot.Song) (*bot.Song, error) {
+	p, err := r.providerForSong(song)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, ok := p.provider.(Resolver)
+	if !ok {
+		return song, nil
+	}
+
+	resolved, err := resolver.ResolveSong(ctx, song)
+	if err != nil {
+		return nil, err
+	}
+
+	if resolved.Type == "" {
+		resolved.Type = song.Type
+	}
+
+	return resolved, nil
+}
+
+// RelatedSongs returns songs related to the song. Songs of providers, which
+// cannot find related songs, have none.
+func (r *Registry) RelatedSongs(ctx context.Context, song *bot.Song) ([]*bot.Song, error) {
+	p, err := r.providerForSong(song)
+	if err != nil {
+		return nil, err
+	}
+
+	finder, ok := p.provider.(RelatedProvider)
+	if !ok {
+		return nil, nil
+	}
+
+	songs, err := finder.RelatedSongs(ctx, song)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, related := range songs {
+		if related.Type == "" {
+			related.Type = p.spec.SongType
+		}
+	}
+
+	return songs, nil
+}
+
+func (r *Registry) providerForSong(song *bot.Song) (registeredProvider, error) {
+	for _, p := range r.providers {
+		if p.spec.SongType == song.Type {
+			return p, nil
+		}
+	}
+
+	// songs imported from files may not have a type, URLs are routed like
+	// the input of a lookup
+	if song.Type == "" {
+		if u, err := url.Parse(song.URL); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			if candidates, _ := r.match(song.URL); len(candidates) > 0 {
+				return candidates[0].registeredProvider, nil
+			}
+		}
+	}
+
+	return registeredProvider{}, fmt.Errorf("%w: %s", ErrUnknownSongType, song.Type)
+}
+
+type candidate struct {
+	registeredProvider
+	explicit bool
+}
+
+// match returns the providers, which should handle the input in the order
+// they should be tried, and the input without an explicit provider prefix.
+func (r *Registry) match(input string) ([]candidate, string) {
+	if prefix, rest, found := strings.Cut(input, ":"); found && !strings.HasPrefix(rest, "//") {
+		for _, p := range r.providers {
+			if p.spec.Name != "" && strings.EqualFold(p.spec.Name, prefix) {
+				return []candidate{{registeredProvider: p, explicit: true}}, strings.TrimSpace(rest)
+			}
+		}
+	}
+
+	candidates := make([]candidate, 0)
+	added := make(map[int]bool)
+	add := func(i int) {
+		if !added[i] {
+			added[i] = true
+			candidates = append(candidates, candidate{registeredProvider: r.providers[i]})
+		}
+	}
+
+	for i, p := range r.providers {
+		if p.spec.Match != nil && p.spec.Match(input) {
+			add(i)
+		}
+	}
+
+	if u, err := url.Parse(input); err == nil && u.Scheme != "" {
+		for i, p := range r.providers {
+			if matchesHost(p.spec.Hosts, u.Hostname()) {
+				add(i)
+			}
+		}
+
+		for i, p := range r.providers {
+			if contains(p.spec.Extensions, strings.ToLower(path.Ext(u.Path))) {
+				add(i)
+			}
+		}
+
+		for i, p := range r.providers {
+			if len(p.spec.Hosts) == 0 && contains(p.spec.Schemes, strings.ToLower(u.Scheme)) {
+				add(i)
+			}
+		}
+	}
+
+	// fallback providers are tried after the ones matching the URL
+	for i, p := range r.providers {
+		if p.spec.Fallback {
+			add(i)
+		}
+	}
+
+	return candidates, input
+}
+
+func matchesHost(hosts []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range hosts {
+		if host == h || strings.HasSuffix(host, "."+h) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// searchRewrite turns a text query into a yt-dlp search with the given
+// backend, URLs are passed unchanged.
+func searchRewrite(backend string) func(string) string {
+	return func(input string) string {
+		if strings.HasPrefix(input, "https://") || strings.HasPrefix(input, "http://") {
+			return input
+		}
+
+		return fmt.Sprintf("%s:%s", backend, input)
+	}
+}
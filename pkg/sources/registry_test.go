@@ -0,0 +1,131 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/config"
+)
+
+type fakeProvider struct {
+	songType string
+	inputs   []string
+}
+
+func (p *fakeProvider) LookupSongs(ctx context.Context, input string) ([]*bot.Song, error) {
+	p.inputs = append(p.inputs, input)
+	return []*bot.Song{{Title: input, URL: input}}, nil
+}
+
+func (p *fakeProvider) GetAudio(ctx context.Context, song *bot.Song) (*bot.AudioStream, error) {
+	return nil, nil
+}
+
+func newTestRegistry() (*Registry, *fakeProvider, *fakeProvider, *fakeProvider) {
+	local := &fakeProvider{songType: LocalSongType}
+	ytDlp := &fakeProvider{songType: YtDlpSongType}
+	radio := &fakeProvider{songType: RadioSongType}
+
+	registry := NewRegistry().
+		Register(local, ProviderSpec{
+			Name:     "file",
+			SongType: LocalSongType,
+		}).
+		Register(ytDlp, ProviderSpec{
+			Name:     "yt",
+			SongType: YtDlpSongType,
+			Schemes:  []string{"http", "https"},
+			Fallback: true,
+			Rewrite:  searchRewrite("ytsearch"),
+		}).
+		Register(radio, ProviderSpec{
+			Name:       "radio",
+			SongType:   RadioSongType,
+			Extensions: []string{".pls", ".m3u"},
+		})
+
+	return registry, local, ytDlp, radio
+}
+
+func TestRegistryLookupSongs(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantType  string
+		wantInput string
+	}{
+		{input: "daft punk around the world", wantType: YtDlpSongType, wantInput: "daft punk around the world"},
+		{input: "https://www.youtube.com/watch?v=K0HSD_i2DvA", wantType: YtDlpSongType, wantInput: "https://www.youtube.com/watch?v=K0HSD_i2DvA"},
+		{input: "yt: daft punk", wantType: YtDlpSongType, wantInput: "ytsearch:daft punk"},
+		{input: "file:DJ Sets/2024-06.flac", wantType: LocalSongType, wantInput: "DJ Sets/2024-06.flac"},
+		{input: "https://radio.example.com/station.pls", wantType: RadioSongType, wantInput: "https://radio.example.com/station.pls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			registry, local, ytDlp, radio := newTestRegistry()
+
+			songs, err := registry.LookupSongs(context.Background(), tt.input)
+			if err != nil {
+				t.Fatalf("LookupSongs() error = %v", err)
+			}
+			if len(songs) != 1 || songs[0].Type != tt.wantType {
+				t.Fatalf("LookupSongs() = %+v, want a song of type %s", songs, tt.wantType)
+			}
+
+			provider := map[string]*fakeProvider{
+				LocalSongType: local,
+				YtDlpSongType: ytDlp,
+				RadioSongType: radio,
+			}[tt.wantType]
+			if len(provider.inputs) != 1 || provider.inputs[0] != tt.wantInput {
+				t.Errorf("provider inputs = %q, want %q", provider.inputs, tt.wantInput)
+			}
+		})
+	}
+}
+
+func TestRegistryProviderForUntypedSong(t *testing.T) {
+	tests := []struct {
+		url      string
+		wantType string
+		wantErr  error
+	}{
+		{url: "https://www.youtube.com/watch?v=K0HSD_i2DvA", wantType: YtDlpSongType},
+		{url: "http://radio.example.com/station.m3u", wantType: RadioSongType},
+		{url: "file:DJ Sets/2024-06.flac", wantErr: ErrUnknownSongType},
+		{url: "daft punk", wantErr: ErrUnknownSongType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			registry, _, _, _ := newTestRegistry()
+
+			p, err := registry.providerForSong(&bot.Song{URL: tt.url})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("providerForSong() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("providerForSong() error = %v", err)
+			}
+			if p.spec.SongType != tt.wantType {
+				t.Errorf("providerForSong() = %s, want %s", p.spec.SongType, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestNewRegistryFromConfigUnreadableExtractorArgs(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.YtDlp.ExtractorArgsFile = filepath.Join(t.TempDir(), "missing")
+
+	if _, err := NewRegistryFromConfig(context.Background(), cfg); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("NewRegistryFromConfig() error = %v, want %v", err, fs.ErrNotExist)
+	}
+}
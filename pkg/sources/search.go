@@ -0,0 +1,67 @@
+package sources
+
+import (
+	"context"
+	"fmt"
+)
+
+type searchBackendsKey struct{}
+
+// WithSearchBackends returns a context, which overrides the default search
+// backends for text queries, e.g. with the guild settings. Empty backends
+// keep the default at their position and "none" removes it.
+func WithSearchBackends(ctx context.Context, backends ...string) context.Context {
+	return context.WithValue(ctx, searchBackendsKey{}, backends)
+}
+
+func searchBackends(ctx context.Context, defaults []string) []string {
+	overrides, _ := ctx.Value(searchBackendsKey{}).([]string)
+
+	backends := make([]string, 0, len(defaults))
+	seen := make(map[string]bool)
+
+	for i := 0; i < len(defaults) || i < len(overrides); i++ {
+		backend := ""
+		if i < len(defaults) {
+			backend = defaults[i]
+		}
+		if i < len(overrides) && overrides[i] != "" {
+			backend = overrides[i]
+		}
+
+		if backend == "" || backend == "none" || seen[backend] {
+			continue
+		}
+
+		seen[backend] = true
+		backends = append(backends, backend)
+	}
+
+	return backends
+}
+
+type searchLimitKey struct{}
+
+// WithSearchLimit returns a context, which makes text queries return up to
+// limit results instead of the best match only.
+func WithSearchLimit(ctx context.Context, limit int) context.Context {
+	return context.WithValue(ctx, searchLimitKey{}, limit)
+}
+
+func searchLimit(ctx context.Context) int {
+	if limit, ok := ctx.Value(searchLimitKey{}).(int); ok && limit > 1 {
+		return limit
+	}
+
+	return 1
+}
+
+// searchQuery builds the yt-dlp input for the text query, e.g.
+// `ytsearch5:query`.
+func searchQuery(ctx context.Context, backend, query string) string {
+	if limit := searchLimit(ctx); limit > 1 {
+		return fmt.Sprintf("%s%d:%s", backend, limit, query)
+	}
+
+	return fmt.Sprintf("%s:%s", backend, query)
+}
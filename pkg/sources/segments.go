@@ -0,0 +1,88 @@
+package sources
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+// SegmentRules are the skipped segments of songs, read from a JSON file:
+//
+//	{"songs": [{"url": "https://...", "segments": [{"start": "0s", "end": "45s", "category": "intro"}]}]}
+type SegmentRules struct {
+	segments map[string][]bot.Segment
+}
+
+type segmentRulesFile struct {
+	Songs []struct {
+		URL      string `json:"url"`
+		Segments []struct {
+			Start    string `json:"start"`
+			End      string `json:"end"`
+			Category string `json:"category"`
+		} `json:"segments"`
+	} `json:"songs"`
+}
+
+func LoadSegmentRules(path string) (*SegmentRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("while reading segment rules: %w", err)
+	}
+
+	var file segmentRulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("while unmarshaling segment rules: %w", err)
+	}
+
+	rules := &SegmentRules{
+		segments: make(map[string][]bot.Segment),
+	}
+
+	for _, song := range file.Songs {
+		for _, s := range song.Segments {
+			start, err := time.ParseDuration(s.Start)
+			if err != nil {
+				return nil, fmt.Errorf("invalid start of a segment of %s: %w", song.URL, err)
+			}
+			end, err := time.ParseDuration(s.End)
+			if err != nil {
+				return nil, fmt.Errorf("invalid end of a segment of %s: %w", song.URL, err)
+			}
+			if end <= start {
+				return nil, fmt.Errorf("segment of %s ends before it starts", song.URL)
+			}
+
+			rules.segments[song.URL] = append(rules.segments[song.URL], bot.Segment{
+				Start:    start,
+				End:      end,
+				Category: s.Category,
+			})
+		}
+	}
+
+	return rules, nil
+}
+
+// Segments returns the segments of the song, matched by its URL.
+func (r *SegmentRules) Segments(song *bot.Song) []bot.Segment {
+	return r.segments[song.URL]
+}
+
+// SkipSegments returns the segments of the song, which are skipped: the ones
+// found by the provider, like SponsorBlock segments, and the ones from the
+// segment rules.
+func (r *Registry) SkipSegments(ctx context.Context, song *bot.Song) ([]bot.Segment, error) {
+	segments := make([]bot.Segment, 0, len(song.Segments))
+	segments = append(segments, song.Segments...)
+
+	if r.segmentRules != nil {
+		segments = append(segments, r.segmentRules.Segments(song)...)
+	}
+
+	return segments, nil
+}
@@ -0,0 +1,166 @@
+// Package sourcestest provides fake yt-dlp and ffmpeg executables, so the
+// audio sources can be exercised offline. The fakes are shell scripts, which
+// record their arguments and print canned output.
+package sourcestest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	sampleRate = 48000
+	channels   = 2
+)
+
+// Script is the behaviour of a fake executable.
+type Script struct {
+	// Stdout is written to the standard output, e.g. yt-dlp JSON lines or PCM.
+	Stdout []byte
+	// Stderr is written to the standard error, e.g. a yt-dlp error message.
+	Stderr string
+	// ExitCode is the status the executable exits with.
+	ExitCode int
+	// ReadStdin makes the executable read its input before writing the
+	// output, like ffmpeg reading from a pipe. The input is kept for Stdin.
+	ReadStdin bool
+}
+
+// Bin is a directory with fake executables, which is put first in PATH.
+type Bin struct {
+	Dir string
+
+	tb testing.TB
+}
+
+// NewBin creates the directory of the fake executables and prepends it to
+// PATH for the rest of the test.
+func NewBin(tb testing.TB) *Bin {
+	tb.Helper()
+
+	dir := tb.TempDir()
+	tb.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	return &Bin{
+		Dir: dir,
+		tb:  tb,
+	}
+}
+
+// Install writes a fake executable with the name, replacing a previous one.
+// It returns the path of the executable.
+func (b *Bin) Install(name string, script Script) string {
+	b.tb.Helper()
+
+	path := filepath.Join(b.Dir, name)
+	stdoutPath := path + ".stdout"
+	argsPath := path + ".args"
+
+	if err := os.WriteFile(stdoutPath, script.Stdout, 0644); err != nil {
+		b.tb.Fatalf("while writing output of %s: %v", name, err)
+	}
+
+	sh := &strings.Builder{}
+	sh.WriteString("#!/bin/sh\n")
+	// every argument is terminated by NUL, every invocation by \001
+	fmt.Fprintf(sh, "for arg in \"$@\"; do printf '%%s\\0' \"$arg\" >> %s; done\n", quote(argsPath))
+	fmt.Fprintf(sh, "printf '\\001\\0' >> %s\n", quote(argsPath))
+	if script.ReadStdin {
+		fmt.Fprintf(sh, "cat > %s\n", quote(path+".stdin"))
+	}
+	if script.Stderr != "" {
+		fmt.Fprintf(sh, "printf '%%s\\n' %s >&2\n", quote(script.Stderr))
+	}
+	fmt.Fprintf(sh, "cat %s\n", quote(stdoutPath))
+	fmt.Fprintf(sh, "exit %d\n", script.ExitCode)
+
+	if err := os.WriteFile(path, []byte(sh.String()), 0755); err != nil {
+		b.tb.Fatalf("while writing %s: %v", name, err)
+	}
+
+	return path
+}
+
+// Calls returns the arguments of every invocation of the executable, the
+// oldest first.
+func (b *Bin) Calls(name string) [][]string {
+	b.tb.Helper()
+
+	data, err := os.ReadFile(filepath.Join(b.Dir, name+".args"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		b.tb.Fatalf("while reading arguments of %s: %v", name, err)
+	}
+
+	calls := make([][]string, 0)
+	args := make([]string, 0)
+	for _, arg := range bytes.Split(bytes.TrimSuffix(data, []byte{0}), []byte{0}) {
+		if string(arg) == "\001" {
+			calls = append(calls, args)
+			args = make([]string, 0)
+			continue
+		}
+		args = append(args, string(arg))
+	}
+
+	return calls
+}
+
+// Stdin returns the input read by the last invocation of the executable
+// installed with ReadStdin.
+func (b *Bin) Stdin(name string) []byte {
+	b.tb.Helper()
+
+	data, err := os.ReadFile(filepath.Join(b.Dir, name+".stdin"))
+	if err != nil {
+		b.tb.Fatalf("while reading input of %s: %v", name, err)
+	}
+
+	return data
+}
+
+// YtDlpJSON returns the output of `yt-dlp --dump-json` with one line per info,
+// like the videos of a search or the entries of a flat playlist.
+func YtDlpJSON(tb testing.TB, infos ...map[string]any) []byte {
+	tb.Helper()
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	for _, info := range infos {
+		if err := encoder.Encode(info); err != nil {
+			tb.Fatalf("while encoding yt-dlp info: %v", err)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// PCM returns a 440Hz tone in the format written by ffmpeg for the sources,
+// signed 16-bit little endian, 48kHz, stereo.
+func PCM(duration time.Duration) []byte {
+	samples := int(duration.Seconds() * sampleRate)
+
+	buf := bytes.NewBuffer(make([]byte, 0, samples*channels*2))
+	for i := 0; i < samples; i++ {
+		sample := int16(math.Sin(2*math.Pi*440*float64(i)/sampleRate) * math.MaxInt16 / 4)
+		for c := 0; c < channels; c++ {
+			binary.Write(buf, binary.LittleEndian, sample)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// quote quotes the string for the shell.
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,330 @@
+package sources
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Matroska element IDs used by the WebM demuxer.
+const (
+	ebmlIDHeader            = 0x1A45DFA3
+	ebmlIDDocType           = 0x4282
+	ebmlIDSegment           = 0x18538067
+	ebmlIDTracks            = 0x1654AE6B
+	ebmlIDTrackEntry        = 0xAE
+	ebmlIDTrackNumber       = 0xD7
+	ebmlIDTrackType         = 0x83
+	ebmlIDCodecID           = 0x86
+	ebmlIDAudio             = 0xE1
+	ebmlIDSamplingFrequency = 0xB5
+	ebmlIDChannels          = 0x9F
+	ebmlIDCluster           = 0x1F43B675
+	ebmlIDSimpleBlock       = 0xA3
+	ebmlIDBlockGroup        = 0xA0
+	ebmlIDBlock             = 0xA1
+
+	matroskaTrackTypeAudio = 2
+
+	// maxEBMLElementSize protects against allocating huge buffers for broken
+	// input. Elements read into memory are small, blocks are single packets.
+	maxEBMLElementSize = 1 << 20
+)
+
+const ebmlUnknownSize = math.MaxUint64
+
+// webmDemuxer reads the Opus packets of the first audio track of a WebM
+// (Matroska) stream. Only the elements needed to find the packets are parsed.
+type webmDemuxer struct {
+	r     *bufio.Reader
+	track uint64
+}
+
+func newWebMDemuxer(r io.Reader) (*webmDemuxer, error) {
+	d := &webmDemuxer{r: bufio.NewReader(r)}
+
+	id, size, err := d.readElementHeader()
+	if err != nil {
+		return nil, err
+	}
+	if id != ebmlIDHeader {
+		return nil, fmt.Errorf("%w: missing EBML header", errNotOpus)
+	}
+
+	header, err := d.readElementData(size)
+	if err != nil {
+		return nil, err
+	}
+	if docType := findEBMLString(header, ebmlIDDocType); docType != "webm" && docType != "matroska" {
+		return nil, fmt.Errorf("%w: unsupported document type %q", errNotOpus, docType)
+	}
+
+	// the tracks are described before the first cluster
+	for {
+		id, size, err := d.readElementHeader()
+		if err != nil {
+			return nil, err
+		}
+
+		switch id {
+		case ebmlIDSegment:
+			continue
+		case ebmlIDTracks:
+			tracks, err := d.readElementData(size)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := d.selectTrack(tracks); err != nil {
+				return nil, err
+			}
+			return d, nil
+		case ebmlIDCluster:
+			return nil, fmt.Errorf("%w: missing tracks", errNotOpus)
+		default:
+			if err := d.skip(size); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (d *webmDemuxer) selectTrack(tracks []byte) error {
+	for _, entry := range findEBMLElements(tracks, ebmlIDTrackEntry) {
+		if findEBMLUint(entry, ebmlIDTrackType) != matroskaTrackTypeAudio {
+			continue
+		}
+
+		if codec := findEBMLString(entry, ebmlIDCodecID); codec != "A_OPUS" {
+			return fmt.Errorf("%w: audio codec %s", errNotOpus, codec)
+		}
+
+		audio := findEBMLElements(entry, ebmlIDAudio)
+		if len(audio) > 0 {
+			if rate := findEBMLFloat(audio[0], ebmlIDSamplingFrequency); rate != 0 && rate != sampleRate {
+				return fmt.Errorf("%w: sampling frequency %v", errNotOpus, rate)
+			}
+			if ch := findEBMLUint(audio[0], ebmlIDChannels); ch > channels {
+				return fmt.Errorf("%w: %d channels", errNotOpus, ch)
+			}
+		}
+
+		d.track = findEBMLUint(entry, ebmlIDTrackNumber)
+		return nil
+	}
+
+	return fmt.Errorf("%w: no audio track", errNotOpus)
+}
+
+func (d *webmDemuxer) ReadPacket() ([]byte, error) {
+	for {
+		id, size, err := d.readElementHeader()
+		if err != nil {
+			return nil, err
+		}
+
+		switch id {
+		case ebmlIDSegment, ebmlIDCluster, ebmlIDBlockGroup:
+			// the children are read as the following elements
+			continue
+		case ebmlIDSimpleBlock, ebmlIDBlock:
+			block, err := d.readElementData(size)
+			if err != nil {
+				return nil, err
+			}
+
+			packet, track, err := parseMatroskaBlock(block)
+			if err != nil {
+				return nil, err
+			}
+			if track == d.track {
+				return packet, nil
+			}
+		default:
+			if err := d.skip(size); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func (d *webmDemuxer) readElementHeader() (uint64, uint64, error) {
+	id, _, err := readEBMLVint(d.r, true)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	size, _, err := readEBMLVint(d.r, false)
+	if err != nil {
+		return 0, 0, unexpectedEOF(err)
+	}
+
+	return id, size, nil
+}
+
+func (d *webmDemuxer) readElementData(size uint64) ([]byte, error) {
+	if size == ebmlUnknownSize || size > maxEBMLElementSize {
+		return nil, fmt.Errorf("%w: element too large", errNotOpus)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	return data, nil
+}
+
+func (d *webmDemuxer) skip(size uint64) error {
+	if size == ebmlUnknownSize {
+		return fmt.Errorf("%w: element of unknown size", errNotOpus)
+	}
+
+	if _, err := io.CopyN(io.Discard, d.r, int64(size)); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	return nil
+}
+
+// parseMatroskaBlock returns the frame of a block without lacing.
+func parseMatroskaBlock(block []byte) ([]byte, uint64, error) {
+	track, n, err := readEBMLVint(bytes.NewReader(block), false)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: invalid block", errNotOpus)
+	}
+
+	// timecode (int16) and flags
+	if len(block) < n+3 {
+		return nil, 0, fmt.Errorf("%w: invalid block", errNotOpus)
+	}
+
+	flags := block[n+2]
+	if flags&0x06 != 0 {
+		return nil, 0, fmt.Errorf("%w: laced blocks", errNotOpus)
+	}
+
+	return block[n+3:], track, nil
+}
+
+// readEBMLVint reads a variable size integer. IDs keep the length marker,
+// sizes with all value bits set are returned as ebmlUnknownSize.
+func readEBMLVint(r io.ByteReader, keepMarker bool) (uint64, int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	length := 1
+	for mask := byte(0x80); length <= 8 && first&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, fmt.Errorf("%w: invalid variable size integer", errNotOpus)
+	}
+
+	value := uint64(first)
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+	allOnes := value == uint64(0xFF>>length)
+
+	for i := 1; i < length; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, unexpectedEOF(err)
+		}
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+
+	if !keepMarker && allOnes {
+		return ebmlUnknownSize, length, nil
+	}
+
+	return value, length, nil
+}
+
+// findEBMLElements returns the data of the direct children of data with the id.
+func findEBMLElements(data []byte, id uint64) [][]byte {
+	elements := make([][]byte, 0)
+
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		elementID, _, err := readEBMLVint(r, true)
+		if err != nil {
+			break
+		}
+		size, _, err := readEBMLVint(r, false)
+		if err != nil || size > uint64(r.Len()) {
+			break
+		}
+
+		offset := len(data) - r.Len()
+		if elementID == id {
+			elements = append(elements, data[offset:offset+int(size)])
+		}
+		r.Seek(int64(size), io.SeekCurrent)
+	}
+
+	return elements
+}
+
+func findEBMLUint(data []byte, id uint64) uint64 {
+	elements := findEBMLElements(data, id)
+	if len(elements) == 0 || len(elements[0]) > 8 {
+		return 0
+	}
+
+	value := uint64(0)
+	for _, b := range elements[0] {
+		value = value<<8 | uint64(b)
+	}
+
+	return value
+}
+
+func findEBMLFloat(data []byte, id uint64) float64 {
+	elements := findEBMLElements(data, id)
+	if len(elements) == 0 {
+		return 0
+	}
+
+	switch len(elements[0]) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(elements[0])))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(elements[0]))
+	default:
+		return 0
+	}
+}
+
+func findEBMLString(data []byte, id uint64) string {
+	elements := findEBMLElements(data, id)
+	if len(elements) == 0 {
+		return ""
+	}
+
+	return string(trimNull(elements[0]))
+}
+
+func trimNull(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+
+	return b
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
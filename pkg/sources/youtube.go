@@ -4,11 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"os/exec"
+	"math"
+	"net/url"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -25,12 +27,36 @@ const (
 	frameLength = 20 * time.Millisecond
 	pcmBufSize  = sampleRate * channels / (time.Second / frameLength)
 	opusBufSize = 1024
+
+	YtDlpSongType = "yt-dlp"
+
+	defaultYtDlpBinary   = "yt-dlp"
+	defaultFFmpegBinary  = "ffmpeg"
+	defaultFFprobeBinary = "ffprobe"
 )
 
+var ytDlpSearchPrefix = regexp.MustCompile(`^[a-z0-9]+search[0-9]*:`)
+
 type YoutubeFetcher struct {
 	Logger *slog.Logger
 
-	proxy *string
+	proxy          *string
+	searchBackends []string
+
+	ytDlpBinary  string
+	ffmpegBinary string
+
+	format        string
+	rateLimit     string
+	cookiesFile   string
+	netrcFile     string
+	extractorArgs []string
+	extraArgs     []string
+
+	sponsorBlockCategories []string
+
+	// supervisor runs the yt-dlp processes looking up songs, if set.
+	supervisor *ProcessSupervisor
 }
 
 type Option func(f *YoutubeFetcher)
@@ -41,9 +67,115 @@ func WithProxy(proxy string) Option {
 	}
 }
 
+// WithDefaultSearchBackends sets the yt-dlp search backends used for text
+// queries, tried in order until one returns playable songs.
+func WithDefaultSearchBackends(backends ...string) Option {
+	return func(f *YoutubeFetcher) {
+		f.searchBackends = backends
+	}
+}
+
+// WithYtDlpBinary sets the path of the yt-dlp executable. By default it is
+// looked up in PATH.
+func WithYtDlpBinary(path string) Option {
+	return func(f *YoutubeFetcher) {
+		if path != "" {
+			f.ytDlpBinary = path
+		}
+	}
+}
+
+// WithFFmpegBinary sets the path of the ffmpeg executable, which transcodes
+// audio not in Opus. By default it is looked up in PATH.
+func WithFFmpegBinary(path string) Option {
+	return func(f *YoutubeFetcher) {
+		if path != "" {
+			f.ffmpegBinary = path
+		}
+	}
+}
+
+// ffprobeBinaryFor returns the ffprobe installed next to the ffmpeg, e.g.
+// `/opt/ffmpeg/bin/ffprobe` for `/opt/ffmpeg/bin/ffmpeg`.
+func ffprobeBinaryFor(ffmpegBinary string) string {
+	dir, name := filepath.Split(ffmpegBinary)
+	if !strings.Contains(name, defaultFFmpegBinary) {
+		return defaultFFprobeBinary
+	}
+
+	return dir + strings.Replace(name, defaultFFmpegBinary, defaultFFprobeBinary, 1)
+}
+
+// WithFormat sets the yt-dlp format selection of the audio.
+func WithFormat(format string) Option {
+	return func(f *YoutubeFetcher) {
+		if format != "" {
+			f.format = format
+		}
+	}
+}
+
+// WithRateLimit limits the download rate of the audio, e.g. `2M`.
+func WithRateLimit(rate string) Option {
+	return func(f *YoutubeFetcher) {
+		f.rateLimit = rate
+	}
+}
+
+// WithCookiesFile sets the Netscape formatted cookies file used by yt-dlp.
+func WithCookiesFile(path string) Option {
+	return func(f *YoutubeFetcher) {
+		f.cookiesFile = path
+	}
+}
+
+// WithNetrcFile sets the .netrc file with the credentials of the extractors,
+// e.g. `machine youtube login ... password ...`.
+func WithNetrcFile(path string) Option {
+	return func(f *YoutubeFetcher) {
+		f.netrcFile = path
+	}
+}
+
+// WithExtractorArgs sets the per-extractor options, each formatted as
+// `extractor:key=value;key=value`.
+func WithExtractorArgs(args ...string) Option {
+	return func(f *YoutubeFetcher) {
+		f.extractorArgs = append(f.extractorArgs, args...)
+	}
+}
+
+// WithSponsorBlock fetches the SponsorBlock segments of the categories, e.g.
+// `sponsor` or `intro`, with the metadata of the songs.
+func WithSponsorBlock(categories ...string) Option {
+	return func(f *YoutubeFetcher) {
+		f.sponsorBlockCategories = categories
+	}
+}
+
+// WithExtraArgs adds arguments to every yt-dlp invocation.
+func WithExtraArgs(args ...string) Option {
+	return func(f *YoutubeFetcher) {
+		f.extraArgs = append(f.extraArgs, args...)
+	}
+}
+
+// WithLookupSupervisor runs the yt-dlp lookups, including the autocomplete
+// ones, with the limits of the supervisor, like the processes playing songs.
+func WithLookupSupervisor(supervisor *ProcessSupervisor) Option {
+	return func(f *YoutubeFetcher) {
+		f.supervisor = supervisor
+	}
+}
+
 func NewYoutubeFetcher(opts ...Option) *YoutubeFetcher {
 	f := &YoutubeFetcher{
-		Logger: slog.Default(),
+		Logger:         slog.Default(),
+		searchBackends: []string{"ytsearch"},
+		ytDlpBinary:    defaultYtDlpBinary,
+		ffmpegBinary:   defaultFFmpegBinary,
+		// Opus audio is preferred, as it can be passed through without encoding
+		format: "bestaudio[acodec=opus]/bestaudio/best",
 	}
 
 	for _, opt := range opts {
@@ -54,148 +186,225 @@ func NewYoutubeFetcher(opts ...Option) *YoutubeFetcher {
 }
 
 func (s *YoutubeFetcher) LookupSongs(ctx context.Context, input string) ([]*bot.Song, error) {
-	ytDlpPrintColumns := []string{"title", "original_url", "is_live", "duration", "thumbnail", "thumbnails"}
-	printColumns := strings.Join(ytDlpPrintColumns, ",")
-
-	args := []string{"--print", printColumns, "-U"}
+	songs, err := s.lookupOrSearch(ctx, input)
+	if err != nil {
+		return nil, err
+	}
 
-	if strings.HasPrefix(input, "https://") {
-		args = append(args, input)
-	} else {
-		args = append(args, fmt.Sprintf("scsearch:%s", input))
+	// a single song is resolved right away, playlists lazily
+	if len(songs) == 1 && songs[0].Partial {
+		return s.resolveSongs(ctx, songs[0])
 	}
 
-	if s.proxy != nil {
-		args = append(args, "--proxy", *s.proxy)
+	return songs, nil
+}
+
+// ResolveSong fetches the full metadata of a partial song from a playlist.
+func (s *YoutubeFetcher) ResolveSong(ctx context.Context, song *bot.Song) (*bot.Song, error) {
+	songs, err := s.resolveSongs(ctx, song)
+	if err != nil {
+		return nil, err
 	}
 
-	ytCmd := exec.CommandContext(ctx, "yt-dlp", args...)
+	return songs[0], nil
+}
 
-	ytOutBuf := &bytes.Buffer{}
-	ytCmd.Stdout = ytOutBuf
+func (s *YoutubeFetcher) resolveSongs(ctx context.Context, song *bot.Song) ([]*bot.Song, error) {
+	songs, err := s.lookup(ctx, song.URL, "--no-playlist")
+	if err != nil {
+		return nil, err
+	}
 
-	if err := ytCmd.Run(); err != nil {
-		return nil, fmt.Errorf("while executing yt-dlp command to get metadata: %w", err)
+	if len(songs) == 0 || songs[0].Partial {
+		return nil, fmt.Errorf("no metadata found for %s", song.URL)
 	}
 
-	linesPerSong := len(ytDlpPrintColumns)
-	ytOutLines := strings.Split(ytOutBuf.String(), "\n")
-	songCount := len(ytOutLines) / linesPerSong
+	return songs[:1], nil
+}
 
-	songs := make([]*bot.Song, 0, songCount)
-	for i := 0; i < songCount; i++ {
-		duration, _ := strconv.ParseFloat(ytOutLines[linesPerSong*i+3], 32)
+// relatedSongsLimit is the number of songs fetched from the mix of a video.
+const relatedSongsLimit = 10
 
-		var thumbnailURL *string = nil
-		if ytOutLines[linesPerSong*i+4] != "NA" {
-			thumbnailURL = &ytOutLines[linesPerSong*i+4]
-		} else if ytOutLines[linesPerSong*i+5] != "NA" {
-			thumbnail, err := getThumbnail(ytOutLines[linesPerSong*i+5])
-			if err != nil {
-				s.Logger.Error("failed to get thumbnail", "error", err)
-			}
-			if thumbnail != nil {
-				thumbnailURL = &thumbnail.URL
-			}
-		}
+// RelatedSongs returns the songs of the YouTube mix of the video, which
+// YouTube generates from videos related to it. Songs, which are not YouTube
+// videos, have no related songs.
+func (s *YoutubeFetcher) RelatedSongs(ctx context.Context, song *bot.Song) ([]*bot.Song, error) {
+	id, ok := youtubeVideoID(song.URL)
+	if !ok {
+		return nil, nil
+	}
 
-		song := &bot.Song{
-			Type:         "yt-dlp",
-			Title:        ytOutLines[linesPerSong*i],
-			URL:          ytOutLines[linesPerSong*i+1],
-			Playable:     ytOutLines[linesPerSong*i+2] == "False" || ytOutLines[3*i+2] == "NA",
-			ThumbnailURL: thumbnailURL,
-			Duration:     time.Second * time.Duration(duration),
+	mixURL := fmt.Sprintf("https://www.youtube.com/watch?v=%s&list=RD%s", id, id)
+	songs, err := s.lookup(ctx, mixURL, "--yes-playlist", "--playlist-end", strconv.Itoa(relatedSongsLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	// the mix starts with the video itself
+	related := make([]*bot.Song, 0, len(songs))
+	for _, candidate := range songs {
+		if candidateID, _ := youtubeVideoID(candidate.URL); candidateID != id {
+			related = append(related, candidate)
 		}
-		if !song.Playable {
+	}
+
+	return related, nil
+}
+
+// youtubeVideoID returns the ID of the video, if the URL is a YouTube video.
+func youtubeVideoID(rawURL string) (string, bool) {
+	u, err := url.Parse(normalizeURL(rawURL))
+	if err != nil || u.Host != "youtube.com" || u.Path != "/watch" {
+		return "", false
+	}
+
+	id := u.Query().Get("v")
+	return id, id != ""
+}
+
+func (s *YoutubeFetcher) lookupOrSearch(ctx context.Context, input string) ([]*bot.Song, error) {
+	if isURL(input) || ytDlpSearchPrefix.MatchString(input) {
+		return s.lookup(ctx, input)
+	}
+
+	var errs []error
+	for _, backend := range searchBackends(ctx, s.searchBackends) {
+		songs, err := s.lookup(ctx, searchQuery(ctx, backend, input))
+		if err != nil {
+			s.Logger.Info("search backend failed", "backend", backend, "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", backend, err))
 			continue
 		}
 
-		songs = append(songs, song)
+		if hasPlayable(songs) {
+			return songs, nil
+		}
 	}
 
-	return songs, nil
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return []*bot.Song{}, nil
 }
 
-func (s *YoutubeFetcher) GetAudio(ctx context.Context, song *bot.Song) (<-chan []byte, error) {
-	opusCh := make(chan []byte, 500)
+// lookup runs yt-dlp to get the metadata. Playlist entries are not
+// extracted, so they are returned as partial songs.
+func (s *YoutubeFetcher) lookup(ctx context.Context, input string, extraArgs ...string) ([]*bot.Song, error) {
+	args := []string{"--dump-json", "--flat-playlist", "--no-warnings"}
+	if len(s.sponsorBlockCategories) > 0 {
+		args = append(args, "--sponsorblock-mark", strings.Join(s.sponsorBlockCategories, ","))
+	}
+	args = append(args, s.commonArgs()...)
+	args = append(args, extraArgs...)
+	args = append(args, "--", input)
+
+	if s.supervisor != nil {
+		pipeline := s.supervisor.NewPipeline("lookup " + input)
+		defer pipeline.Close()
+		ctx = withPipeline(ctx, pipeline)
+	}
 
-	reader, writer := io.Pipe()
+	ytCmd := newCommand(ctx, s.ytDlpBinary, args...)
+	stderrBuf := &bytes.Buffer{}
+	ytCmd.Stderr = stderrBuf
 
-	go func() {
-		ytArgs := []string{"-U", "-x", "-o", "-", "--force-overwrites", "--http-chunk-size", "100K", "'" + song.URL + "'"}
+	out, err := outputCommand(ctx, ytCmd)
+	if err != nil {
+		return nil, classifyError(fmt.Errorf("while executing yt-dlp command to get metadata: %w", err), stderrBuf.String())
+	}
 
-		if s.proxy != nil {
-			ytArgs = append(ytArgs, "--proxy", *s.proxy)
-		}
+	songs, err := parseYtDlpOutput(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
 
-		ffmpegArgs := []string{"-i", "pipe:0"}
-		if song.StartPosition > 0 {
-			ffmpegArgs = append(ffmpegArgs, "-ss", song.StartPosition.String())
-		}
-		ffmpegArgs = append(ffmpegArgs, "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1")
+	return songs, nil
+}
 
-		downloadCmd := exec.CommandContext(ctx,
-			"sh", "-c", fmt.Sprintf("yt-dlp %s | ffmpeg %s",
-				strings.Join(ytArgs, " "),
-				strings.Join(ffmpegArgs, " ")))
+func (s *YoutubeFetcher) GetAudio(ctx context.Context, song *bot.Song) (*bot.AudioStream, error) {
+	ytArgs := []string{"-f", s.format, "-o", "-", "--http-chunk-size", "100K"}
+	if s.rateLimit != "" {
+		ytArgs = append(ytArgs, "--limit-rate", s.rateLimit)
+	}
+	ytArgs = append(ytArgs, s.commonArgs()...)
+	ytArgs = append(ytArgs, "--", song.URL)
 
-		stderrBuf := &bytes.Buffer{}
+	downloadCmd := newCommand(ctx, s.ytDlpBinary, ytArgs...)
+	stderrBuf := &bytes.Buffer{}
+	downloadCmd.Stderr = stderrBuf
 
-		downloadCmd.Stdout = writer
-		downloadCmd.Stderr = stderrBuf
+	stdout, err := downloadCmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("while creating yt-dlp pipe: %w", err)
+	}
 
-		if err := downloadCmd.Run(); err != nil {
-			s.Logger.Error("while executing get data pipe", "error", err, "stderr", stderrBuf.String())
-		}
+	if err := startCommand(ctx, downloadCmd); err != nil {
+		return nil, fmt.Errorf("while starting yt-dlp: %w", err)
+	}
 
-		if err := writer.Close(); err != nil {
-			s.Logger.Error("while flushing data pipe", "error", err)
-		}
-	}()
+	stream := bot.NewAudioStream()
 
 	go func() {
-		defer close(opusCh)
-		if err := encodeOpus(ctx, reader, opusCh); err != nil {
-			s.Logger.Error("while encoding to Opus", "error", err)
+		streamErr := streamOpus(ctx, stdout, song.StartPosition, stream, s.ffmpegBinary, s.Logger)
+
+		// yt-dlp cannot finish, until its output is read
+		io.Copy(io.Discard, stdout)
+
+		if err := waitCommand(ctx, downloadCmd); err != nil && ctx.Err() == nil {
+			stream.SetDiagnostics(diagnostics(stderrBuf.String()))
+			streamErr = classifyError(fmt.Errorf("while executing yt-dlp: %w", err), stderrBuf.String())
 		}
-	}()
 
-	return opusCh, nil
-}
+		if ctx.Err() != nil {
+			streamErr = nil
+		}
+		stream.Close(streamErr)
+	}()
 
-type thumnail struct {
-	URL        string `json:"url"`
-	Preference int    `json:"preference"`
+	return stream, nil
 }
 
-func getThumbnail(thumnailsStr string) (*thumnail, error) {
-	thumnailsStr = strings.ReplaceAll(thumnailsStr, "'", "\"")
-
-	var thumbnails []thumnail
-	if err := json.Unmarshal([]byte(thumnailsStr), &thumbnails); err != nil {
-		return nil, err
+// commonArgs returns the arguments of both the metadata and audio
+// invocations of yt-dlp.
+func (s *YoutubeFetcher) commonArgs() []string {
+	args := []string{}
+	if s.proxy != nil {
+		args = append(args, "--proxy", *s.proxy)
 	}
-
-	if len(thumbnails) == 0 {
-		return nil, nil
+	if s.cookiesFile != "" {
+		args = append(args, "--cookies", s.cookiesFile)
+	}
+	if s.netrcFile != "" {
+		args = append(args, "--netrc", "--netrc-location", s.netrcFile)
+	}
+	for _, extractorArgs := range s.extractorArgs {
+		args = append(args, "--extractor-args", extractorArgs)
 	}
 
-	tn := &thumbnails[0]
-	for i := range thumbnails {
-		t := thumbnails[i]
-		if t.Preference > tn.Preference {
-			tn = &t
+	return append(args, s.extraArgs...)
+}
+
+func isURL(input string) bool {
+	return strings.HasPrefix(input, "https://") || strings.HasPrefix(input, "http://")
+}
+
+func hasPlayable(songs []*bot.Song) bool {
+	for _, song := range songs {
+		if song.Playable {
+			return true
 		}
 	}
 
-	return tn, nil
+	return false
 }
 
-func encodeOpus(ctx context.Context, dca io.Reader, opusChan chan<- []byte) error {
-	enc, err := opus.NewEncoder(sampleRate, channels, opus.AppAudio)
+func encodeOpus(ctx context.Context, dca io.Reader, stream *bot.AudioStream) error {
+	profile := bot.EncoderProfileFromContext(ctx)
+
+	enc, err := newOpusEncoder(profile)
 	if err != nil {
-		return fmt.Errorf("while creating opus encoder: %w", err)
+		return err
 	}
 
 	for {
@@ -208,6 +417,10 @@ func encodeOpus(ctx context.Context, dca io.Reader, opusChan chan<- []byte) erro
 			return fmt.Errorf("while reading PCM: %w", err)
 		}
 
+		if profile.ChangesVolume() {
+			scaleVolume(pcmBuf, profile.Volume)
+		}
+
 		opusBuf := make([]byte, opusBufSize)
 
 		size, err := enc.Encode(pcmBuf, opusBuf)
@@ -215,10 +428,53 @@ func encodeOpus(ctx context.Context, dca io.Reader, opusChan chan<- []byte) erro
 			return fmt.Errorf("while encoding: %w", err)
 		}
 
-		select {
-		case <-ctx.Done():
+		if !stream.Send(ctx, opusBuf[0:size]) {
 			return nil
-		case opusChan <- opusBuf[0:size]:
 		}
 	}
 }
+
+// scaleVolume scales the PCM samples to the volume in percent, clipping the
+// ones, which do not fit.
+func scaleVolume(pcm []int16, volume int) {
+	for i, sample := range pcm {
+		scaled := int32(sample) * int32(volume) / 100
+		pcm[i] = int16(min(max(scaled, math.MinInt16), math.MaxInt16))
+	}
+}
+
+// newOpusEncoder creates an encoder configured with the profile.
+func newOpusEncoder(profile bot.EncoderProfile) (*opus.Encoder, error) {
+	application := opus.AppAudio
+	switch profile.Application {
+	case bot.EncoderApplicationVoIP:
+		application = opus.AppVoIP
+	case bot.EncoderApplicationLowDelay:
+		application = opus.AppRestrictedLowdelay
+	}
+
+	enc, err := opus.NewEncoder(sampleRate, channels, application)
+	if err != nil {
+		return nil, fmt.Errorf("while creating opus encoder: %w", err)
+	}
+
+	if profile.Bitrate > 0 {
+		if err := enc.SetBitrate(profile.Bitrate); err != nil {
+			return nil, fmt.Errorf("while setting bitrate: %w", err)
+		}
+	}
+
+	if err := enc.SetComplexity(profile.Complexity); err != nil {
+		return nil, fmt.Errorf("while setting complexity: %w", err)
+	}
+
+	if err := enc.SetInBandFEC(profile.InbandFEC); err != nil {
+		return nil, fmt.Errorf("while setting inband FEC: %w", err)
+	}
+
+	if err := enc.SetPacketLossPerc(profile.PacketLossPerc); err != nil {
+		return nil, fmt.Errorf("while setting expected packet loss: %w", err)
+	}
+
+	return enc, nil
+}
@@ -0,0 +1,408 @@
+package sources
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+	"github.com/Trojan295/discord-airplay/pkg/sources/sourcestest"
+	"golang.org/x/exp/slog"
+)
+
+func newTestYoutubeFetcher(opts ...Option) *YoutubeFetcher {
+	f := NewYoutubeFetcher(opts...)
+	f.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return f
+}
+
+// lastArgs returns the arguments after `--`, which end every yt-dlp call.
+func lastArgs(args []string) []string {
+	i := slices.Index(args, "--")
+	if i < 0 {
+		return nil
+	}
+	return args[i+1:]
+}
+
+func TestYoutubeFetcherLookupSongs(t *testing.T) {
+	bin := sourcestest.NewBin(t)
+	ytDlp := bin.Install("custom-yt-dlp", sourcestest.Script{
+		Stdout: sourcestest.YtDlpJSON(t, map[string]any{
+			"_type":       "video",
+			"title":       "Around the World",
+			"webpage_url": "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+			"duration":    429,
+			"thumbnail":   "https://i.ytimg.com/vi/K0HSD_i2DvA/maxresdefault.jpg",
+		}),
+	})
+
+	fetcher := newTestYoutubeFetcher(
+		WithYtDlpBinary(ytDlp),
+		WithCookiesFile("/etc/airplay/cookies.txt"),
+		WithSponsorBlock("sponsor", "intro"),
+	)
+
+	songs, err := fetcher.LookupSongs(context.Background(), "https://youtu.be/K0HSD_i2DvA")
+	if err != nil {
+		t.Fatalf("LookupSongs() error = %v", err)
+	}
+
+	if len(songs) != 1 || songs[0].Title != "Around the World" || songs[0].Duration != 429*time.Second || songs[0].Partial {
+		t.Fatalf("LookupSongs() = %s", dumpSongs(songs))
+	}
+
+	calls := bin.Calls("custom-yt-dlp")
+	if len(calls) != 1 {
+		t.Fatalf("yt-dlp was called %d times, want once", len(calls))
+	}
+	for _, arg := range []string{"--dump-json", "--flat-playlist", "--cookies", "/etc/airplay/cookies.txt", "--sponsorblock-mark", "sponsor,intro"} {
+		if !slices.Contains(calls[0], arg) {
+			t.Errorf("yt-dlp arguments %q miss %q", calls[0], arg)
+		}
+	}
+	if got := lastArgs(calls[0]); !slices.Equal(got, []string{"https://youtu.be/K0HSD_i2DvA"}) {
+		t.Errorf("yt-dlp input = %q, want the URL after --", got)
+	}
+}
+
+func TestYoutubeFetcherSearchFallback(t *testing.T) {
+	bin := sourcestest.NewBin(t)
+	bin.Install("yt-dlp", sourcestest.Script{
+		Stdout: sourcestest.YtDlpJSON(t, map[string]any{
+			"_type":       "video",
+			"title":       "Premiere",
+			"webpage_url": "https://www.youtube.com/watch?v=upcoming1",
+			"live_status": "is_upcoming",
+		}),
+	})
+
+	fetcher := newTestYoutubeFetcher(WithDefaultSearchBackends("ytsearch", "scsearch"))
+
+	songs, err := fetcher.LookupSongs(context.Background(), "-rf daft punk")
+	if err != nil {
+		t.Fatalf("LookupSongs() error = %v", err)
+	}
+	if len(songs) != 0 {
+		t.Errorf("LookupSongs() = %s, want no playable songs", dumpSongs(songs))
+	}
+
+	// the search without playable songs is retried with the fallback backend
+	calls := bin.Calls("yt-dlp")
+	if len(calls) != 2 {
+		t.Fatalf("yt-dlp was called %d times, want twice", len(calls))
+	}
+	if got := lastArgs(calls[0]); !slices.Equal(got, []string{"ytsearch:-rf daft punk"}) {
+		t.Errorf("first search = %q", got)
+	}
+	if got := lastArgs(calls[1]); !slices.Equal(got, []string{"scsearch:-rf daft punk"}) {
+		t.Errorf("fallback search = %q", got)
+	}
+}
+
+func TestYoutubeFetcherFlatPlaylist(t *testing.T) {
+	bin := sourcestest.NewBin(t)
+	bin.Install("yt-dlp", sourcestest.Script{
+		Stdout: sourcestest.YtDlpJSON(t,
+			map[string]any{
+				"_type":       "url",
+				"url":         "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+				"webpage_url": "https://www.youtube.com/playlist?list=PLexample",
+				"title":       "Around the World",
+				"thumbnails": []map[string]any{
+					{"url": "https://i.ytimg.com/vi/K0HSD_i2DvA/small.jpg", "preference": -1},
+					{"url": "https://i.ytimg.com/vi/K0HSD_i2DvA/large.jpg", "preference": 3},
+					{"url": "https://i.ytimg.com/vi/K0HSD_i2DvA/medium.jpg", "preference": 1},
+				},
+			},
+			map[string]any{
+				"_type":       "url",
+				"url":         "https://www.youtube.com/watch?v=FGBhQbmPwH8",
+				"webpage_url": "https://www.youtube.com/playlist?list=PLexample",
+				"title":       "One More Time",
+			},
+			map[string]any{
+				"_type": "playlist",
+				"title": "Homework",
+			},
+		),
+	})
+
+	fetcher := newTestYoutubeFetcher()
+
+	songs, err := fetcher.LookupSongs(context.Background(), "https://www.youtube.com/playlist?list=PLexample")
+	if err != nil {
+		t.Fatalf("LookupSongs() error = %v", err)
+	}
+
+	// the entries are resolved lazily, when they are played
+	if len(bin.Calls("yt-dlp")) != 1 {
+		t.Errorf("yt-dlp was called %d times, want once", len(bin.Calls("yt-dlp")))
+	}
+
+	wantURLs := []string{"https://www.youtube.com/watch?v=K0HSD_i2DvA", "https://www.youtube.com/watch?v=FGBhQbmPwH8"}
+	if len(songs) != len(wantURLs) {
+		t.Fatalf("LookupSongs() = %s, want %d songs", dumpSongs(songs), len(wantURLs))
+	}
+	for i, song := range songs {
+		if !song.Partial || song.URL != wantURLs[i] {
+			t.Errorf("LookupSongs()[%d] = %+v, want a partial song of %s", i, song, wantURLs[i])
+		}
+	}
+
+	if songs[0].ThumbnailURL == nil || *songs[0].ThumbnailURL != "https://i.ytimg.com/vi/K0HSD_i2DvA/large.jpg" {
+		t.Errorf("thumbnail = %v, want the one with the highest preference", songs[0].ThumbnailURL)
+	}
+	if songs[1].ThumbnailURL != nil {
+		t.Errorf("thumbnail = %v, want none", *songs[1].ThumbnailURL)
+	}
+
+	bin.Install("yt-dlp", sourcestest.Script{
+		Stdout: sourcestest.YtDlpJSON(t, map[string]any{
+			"_type":       "video",
+			"title":       "Around the World",
+			"webpage_url": "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+			"duration":    429,
+		}),
+	})
+
+	resolved, err := fetcher.ResolveSong(context.Background(), songs[0])
+	if err != nil {
+		t.Fatalf("ResolveSong() error = %v", err)
+	}
+	if resolved.Partial || resolved.Duration != 429*time.Second {
+		t.Errorf("ResolveSong() = %+v, want the full metadata", resolved)
+	}
+
+	calls := bin.Calls("yt-dlp")
+	if len(calls) != 2 || !slices.Contains(calls[1], "--no-playlist") {
+		t.Errorf("yt-dlp calls = %q, want the entry resolved with --no-playlist", calls)
+	}
+}
+
+func TestYoutubeFetcherLookupErrors(t *testing.T) {
+	tests := []struct {
+		stderr  string
+		wantErr error
+	}{
+		{stderr: "ERROR: [youtube] K0HSD_i2DvA: The uploader has not made this video available in your country", wantErr: bot.ErrGeoBlocked},
+		{stderr: "ERROR: [youtube] K0HSD_i2DvA: Sign in to confirm your age. This video may be inappropriate for some users.", wantErr: bot.ErrAgeRestricted},
+		{stderr: "ERROR: [youtube] K0HSD_i2DvA: Join this channel to get access to members-only content like this video", wantErr: bot.ErrLoginRequired},
+		{stderr: "ERROR: [youtube] K0HSD_i2DvA: Private video. Sign in if you've been granted access to this video", wantErr: bot.ErrLoginRequired},
+		{stderr: "ERROR: [youtube] K0HSD_i2DvA: Video unavailable. This video has been removed by the uploader", wantErr: bot.ErrRemoved},
+		{stderr: "ERROR: [youtube] K0HSD_i2DvA: Unable to download API page: <urlopen error [Errno -3] Temporary failure in name resolution>", wantErr: bot.ErrNetwork},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantErr.Error(), func(t *testing.T) {
+			bin := sourcestest.NewBin(t)
+			bin.Install("yt-dlp", sourcestest.Script{
+				Stderr:   tt.stderr,
+				ExitCode: 1,
+			})
+
+			_, err := newTestYoutubeFetcher().LookupSongs(context.Background(), "https://www.youtube.com/watch?v=K0HSD_i2DvA")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("LookupSongs() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unknown", func(t *testing.T) {
+		bin := sourcestest.NewBin(t)
+		bin.Install("yt-dlp", sourcestest.Script{
+			Stderr:   "ERROR: something unexpected",
+			ExitCode: 1,
+		})
+
+		_, err := newTestYoutubeFetcher().LookupSongs(context.Background(), "https://www.youtube.com/watch?v=K0HSD_i2DvA")
+		if err == nil || bot.IsPermanentAudioError(err) || errors.Is(err, bot.ErrNetwork) {
+			t.Errorf("LookupSongs() error = %v, want an unclassified error", err)
+		}
+	})
+}
+
+func readStream(t *testing.T, stream *bot.AudioStream) int {
+	t.Helper()
+
+	frames := 0
+	for range stream.Frames() {
+		frames++
+	}
+
+	return frames
+}
+
+func TestYoutubeFetcherGetAudio(t *testing.T) {
+	webm, err := os.ReadFile(filepath.Join("testdata", "opus_20ms.webm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		download      []byte
+		startPosition time.Duration
+		wantFrames    int
+		wantFFmpeg    []string
+	}{
+		{name: "passthrough", download: webm, wantFrames: 60},
+		{name: "passthrough with start position", download: webm, startPosition: 400 * time.Millisecond, wantFrames: 40},
+		{name: "transcode", download: []byte("ID3 mp3 audio"), wantFrames: 25, wantFFmpeg: []string{"-i", "pipe:0", "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1"}},
+		{name: "transcode with start position", download: []byte("ID3 mp3 audio"), startPosition: 90 * time.Second, wantFrames: 25, wantFFmpeg: []string{"-i", "pipe:0", "-ss", "90.000", "-f", "s16le", "-ar", "48000", "-ac", "2", "pipe:1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin := sourcestest.NewBin(t)
+			bin.Install("yt-dlp", sourcestest.Script{Stdout: tt.download})
+			ffmpeg := bin.Install("custom-ffmpeg", sourcestest.Script{
+				Stdout:    sourcestest.PCM(500 * time.Millisecond),
+				ReadStdin: true,
+			})
+
+			fetcher := newTestYoutubeFetcher(WithFFmpegBinary(ffmpeg), WithRateLimit("2M"))
+
+			stream, err := fetcher.GetAudio(context.Background(), &bot.Song{
+				URL:           "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+				StartPosition: tt.startPosition,
+			})
+			if err != nil {
+				t.Fatalf("GetAudio() error = %v", err)
+			}
+
+			if frames := readStream(t, stream); frames != tt.wantFrames {
+				t.Errorf("GetAudio() sent %d frames, want %d", frames, tt.wantFrames)
+			}
+			if err := stream.Err(); err != nil {
+				t.Errorf("stream error = %v", err)
+			}
+
+			ytDlpCalls := bin.Calls("yt-dlp")
+			if len(ytDlpCalls) != 1 || !slices.Contains(ytDlpCalls[0], "--limit-rate") || !slices.Equal(lastArgs(ytDlpCalls[0]), []string{"https://www.youtube.com/watch?v=K0HSD_i2DvA"}) {
+				t.Errorf("yt-dlp calls = %q", ytDlpCalls)
+			}
+
+			ffmpegCalls := bin.Calls("custom-ffmpeg")
+			if tt.wantFFmpeg == nil {
+				if len(ffmpegCalls) != 0 {
+					t.Errorf("ffmpeg was called for passed through audio: %q", ffmpegCalls)
+				}
+				return
+			}
+			if len(ffmpegCalls) != 1 || !slices.Equal(ffmpegCalls[0], tt.wantFFmpeg) {
+				t.Errorf("ffmpeg calls = %q, want %q", ffmpegCalls, tt.wantFFmpeg)
+			}
+		})
+	}
+}
+
+func TestYoutubeFetcherGetAudioErrors(t *testing.T) {
+	t.Run("yt-dlp", func(t *testing.T) {
+		bin := sourcestest.NewBin(t)
+		bin.Install("yt-dlp", sourcestest.Script{
+			Stderr:   "ERROR: [youtube] K0HSD_i2DvA: Video unavailable",
+			ExitCode: 1,
+		})
+		bin.Install("ffmpeg", sourcestest.Script{ReadStdin: true})
+
+		stream, err := newTestYoutubeFetcher().GetAudio(context.Background(), &bot.Song{URL: "https://www.youtube.com/watch?v=K0HSD_i2DvA"})
+		if err != nil {
+			t.Fatalf("GetAudio() error = %v", err)
+		}
+		readStream(t, stream)
+
+		if !errors.Is(stream.Err(), bot.ErrRemoved) {
+			t.Errorf("stream error = %v, want %v", stream.Err(), bot.ErrRemoved)
+		}
+		if stream.Diagnostics() == "" {
+			t.Error("stream diagnostics are empty, want the yt-dlp output")
+		}
+	})
+
+	t.Run("ffmpeg", func(t *testing.T) {
+		bin := sourcestest.NewBin(t)
+		bin.Install("yt-dlp", sourcestest.Script{Stdout: []byte("ID3 mp3 audio")})
+		bin.Install("ffmpeg", sourcestest.Script{
+			Stderr:    "pipe:0: Connection reset by peer",
+			ExitCode:  1,
+			ReadStdin: true,
+		})
+
+		stream, err := newTestYoutubeFetcher().GetAudio(context.Background(), &bot.Song{URL: "https://www.youtube.com/watch?v=K0HSD_i2DvA"})
+		if err != nil {
+			t.Fatalf("GetAudio() error = %v", err)
+		}
+		readStream(t, stream)
+
+		if !errors.Is(stream.Err(), bot.ErrNetwork) {
+			t.Errorf("stream error = %v, want %v", stream.Err(), bot.ErrNetwork)
+		}
+	})
+}
+
+func TestFFprobeBinaryFor(t *testing.T) {
+	tests := map[string]string{
+		"ffmpeg":                 "ffprobe",
+		"/opt/ffmpeg/bin/ffmpeg": "/opt/ffmpeg/bin/ffprobe",
+		"/usr/bin/ffmpeg-6":      "/usr/bin/ffprobe-6",
+		"/usr/local/bin/avconv":  "ffprobe",
+	}
+
+	for ffmpeg, want := range tests {
+		if got := ffprobeBinaryFor(ffmpeg); got != want {
+			t.Errorf("ffprobeBinaryFor(%s) = %s, want %s", ffmpeg, got, want)
+		}
+	}
+}
+
+func TestYoutubeFetcherRelatedSongs(t *testing.T) {
+	bin := sourcestest.NewBin(t)
+	bin.Install("yt-dlp", sourcestest.Script{
+		Stdout: sourcestest.YtDlpJSON(t,
+			map[string]any{
+				"_type": "url",
+				"url":   "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+				"title": "Around the World",
+			},
+			map[string]any{
+				"_type": "url",
+				"url":   "https://www.youtube.com/watch?v=FGBhQbmPwH8",
+				"title": "One More Time",
+			},
+		),
+	})
+
+	fetcher := newTestYoutubeFetcher()
+
+	songs, err := fetcher.RelatedSongs(context.Background(), &bot.Song{URL: "https://youtu.be/K0HSD_i2DvA"})
+	if err != nil {
+		t.Fatalf("RelatedSongs() error = %v", err)
+	}
+
+	// the video itself starts the mix
+	if len(songs) != 1 || songs[0].URL != "https://www.youtube.com/watch?v=FGBhQbmPwH8" || !songs[0].Partial {
+		t.Errorf("RelatedSongs() = %s, want the other song of the mix", dumpSongs(songs))
+	}
+
+	calls := bin.Calls("yt-dlp")
+	if len(calls) != 1 {
+		t.Fatalf("yt-dlp was called %d times, want once", len(calls))
+	}
+	if got := lastArgs(calls[0]); !slices.Equal(got, []string{"https://www.youtube.com/watch?v=K0HSD_i2DvA&list=RDK0HSD_i2DvA"}) {
+		t.Errorf("yt-dlp input = %q, want the mix of the video", got)
+	}
+
+	songs, err = fetcher.RelatedSongs(context.Background(), &bot.Song{URL: "https://soundcloud.com/daftpunk/around-the-world"})
+	if err != nil || len(songs) != 0 {
+		t.Errorf("RelatedSongs() of a SoundCloud song = %s, %v, want none", dumpSongs(songs), err)
+	}
+	if calls := bin.Calls("yt-dlp"); len(calls) != 1 {
+		t.Errorf("yt-dlp was called for a song without a mix")
+	}
+}
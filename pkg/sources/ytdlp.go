@@ -0,0 +1,208 @@
+package sources
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+// ytDlpInfo is the part of the yt-dlp info JSON, which is written with
+// `--dump-json`, used by the bot. Flat playlist entries have only some of
+// the fields set.
+type ytDlpInfo struct {
+	Type        string `json:"_type"`
+	Title       string `json:"title"`
+	WebpageURL  string `json:"webpage_url"`
+	OriginalURL string `json:"original_url"`
+	URL         string `json:"url"`
+
+	Artist   string   `json:"artist"`
+	Artists  []string `json:"artists"`
+	Creator  string   `json:"creator"`
+	Uploader string   `json:"uploader"`
+	Channel  string   `json:"channel"`
+	Album    string   `json:"album"`
+	Track    string   `json:"track"`
+
+	Duration   float64 `json:"duration"`
+	IsLive     bool    `json:"is_live"`
+	LiveStatus string  `json:"live_status"`
+	// UploadDate is formatted as YYYYMMDD.
+	UploadDate string `json:"upload_date"`
+
+	Thumbnail  string           `json:"thumbnail"`
+	Thumbnails []ytDlpThumbnail `json:"thumbnails"`
+	Chapters   []ytDlpChapter   `json:"chapters"`
+	// SponsorBlockChapters are set with `--sponsorblock-mark`.
+	SponsorBlockChapters []ytDlpSponsorBlockChapter `json:"sponsorblock_chapters"`
+}
+
+type ytDlpThumbnail struct {
+	URL        string `json:"url"`
+	Preference int    `json:"preference"`
+}
+
+type ytDlpChapter struct {
+	Title     string  `json:"title"`
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+}
+
+type ytDlpSponsorBlockChapter struct {
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Category  string  `json:"category"`
+}
+
+// parseYtDlpOutput parses the JSON lines written by yt-dlp with
+// `--dump-json`, one object per video.
+func parseYtDlpOutput(r io.Reader) ([]*bot.Song, error) {
+	decoder := json.NewDecoder(r)
+
+	songs := make([]*bot.Song, 0)
+	for {
+		var info ytDlpInfo
+		if err := decoder.Decode(&info); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("while decoding yt-dlp output: %w", err)
+		}
+
+		if info.Type == "playlist" {
+			continue
+		}
+
+		song := info.toSong()
+		if song.URL == "" {
+			continue
+		}
+
+		songs = append(songs, song)
+	}
+
+	return songs, nil
+}
+
+func (info *ytDlpInfo) toSong() *bot.Song {
+	song := &bot.Song{
+		Type:     YtDlpSongType,
+		Title:    info.Title,
+		Artist:   info.artist(),
+		Album:    info.Album,
+		Uploader: firstNonEmpty(info.Uploader, info.Channel),
+		URL:      firstNonEmpty(info.WebpageURL, info.OriginalURL, info.URL),
+		// upcoming streams and premieres cannot be played yet
+		Playable: info.LiveStatus != "is_upcoming",
+		Duration: time.Duration(info.Duration * float64(time.Second)),
+		Live:     info.IsLive || info.LiveStatus == "is_live",
+		// entries of a flat playlist only reference the video
+		Partial: info.Type == "url" || info.Type == "url_transparent",
+	}
+
+	if song.Partial {
+		// the page URLs of flat entries may point to the playlist
+		song.URL = firstNonEmpty(info.URL, info.WebpageURL, info.OriginalURL)
+	}
+
+	if song.Title == "" {
+		song.Title = info.Track
+	}
+
+	if thumbnailURL := info.thumbnailURL(); thumbnailURL != "" {
+		song.ThumbnailURL = &thumbnailURL
+	}
+
+	if uploadDate, err := time.Parse("20060102", info.UploadDate); err == nil {
+		song.UploadDate = uploadDate
+	}
+
+	for _, chapter := range info.Chapters {
+		song.Chapters = append(song.Chapters, bot.Chapter{
+			Title: chapter.Title,
+			Start: time.Duration(chapter.StartTime * float64(time.Second)),
+			End:   time.Duration(chapter.EndTime * float64(time.Second)),
+		})
+	}
+
+	for _, chapter := range info.SponsorBlockChapters {
+		song.Segments = append(song.Segments, bot.Segment{
+			Start:    time.Duration(chapter.StartTime * float64(time.Second)),
+			End:      time.Duration(chapter.EndTime * float64(time.Second)),
+			Category: chapter.Category,
+		})
+	}
+
+	return song
+}
+
+func (info *ytDlpInfo) artist() string {
+	if len(info.Artists) > 0 {
+		return strings.Join(info.Artists, ", ")
+	}
+
+	return firstNonEmpty(info.Artist, info.Creator)
+}
+
+// thumbnailURL returns the thumbnail chosen by yt-dlp or the one with the
+// highest preference.
+func (info *ytDlpInfo) thumbnailURL() string {
+	if info.Thumbnail != "" {
+		return info.Thumbnail
+	}
+
+	var best *ytDlpThumbnail
+	for i := range info.Thumbnails {
+		t := &info.Thumbnails[i]
+		if t.URL != "" && (best == nil || t.Preference > best.Preference) {
+			best = t
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+
+	return best.URL
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// readExtractorArgs reads the per-extractor options from the file, one
+// `extractor:key=value;key=value` per line. Empty lines and lines starting
+// with `#` are skipped.
+func readExtractorArgs(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("while reading extractor args: %w", err)
+	}
+
+	args := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if !strings.Contains(line, ":") {
+			return nil, fmt.Errorf("invalid extractor args %q, expected extractor:key=value", line)
+		}
+
+		args = append(args, line)
+	}
+
+	return args, nil
+}
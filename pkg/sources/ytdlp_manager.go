@@ -0,0 +1,142 @@
+package sources
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// YtDlpStatus describes the yt-dlp executable for diagnostics.
+type YtDlpStatus struct {
+	Binary  string
+	Version string
+	// UpdatedAt is the time of the last update check. UpdateErr is set, if it
+	// failed.
+	UpdatedAt time.Time
+	UpdateErr error
+}
+
+// YtDlpManager detects the version of yt-dlp and keeps it up to date. The
+// updates run on a schedule, instead of on every invocation, as YouTube
+// breaks older versions regularly.
+type YtDlpManager struct {
+	Logger *slog.Logger
+
+	binary string
+
+	mutex  sync.Mutex
+	status YtDlpStatus
+}
+
+func NewYtDlpManager(binary string) *YtDlpManager {
+	if binary == "" {
+		binary = defaultYtDlpBinary
+	}
+
+	return &YtDlpManager{
+		Logger: slog.Default(),
+		binary: binary,
+		status: YtDlpStatus{Binary: binary},
+	}
+}
+
+// DetectVersion runs yt-dlp to get its version.
+func (m *YtDlpManager) DetectVersion(ctx context.Context) (string, error) {
+	output, err := m.run(ctx, "--version")
+	if err != nil {
+		return "", fmt.Errorf("while getting yt-dlp version: %w", err)
+	}
+
+	version := strings.TrimSpace(output)
+
+	m.mutex.Lock()
+	m.status.Version = version
+	m.mutex.Unlock()
+
+	return version, nil
+}
+
+// Update updates yt-dlp to the latest release. Installations managed by a
+// package manager, like pip, cannot update themselves and return an error.
+func (m *YtDlpManager) Update(ctx context.Context) error {
+	output, updateErr := m.run(ctx, "--update")
+	if updateErr != nil {
+		updateErr = fmt.Errorf("while updating yt-dlp: %w: %s", updateErr, lastLine(output))
+	}
+
+	m.mutex.Lock()
+	m.status.UpdatedAt = time.Now()
+	m.status.UpdateErr = updateErr
+	previous := m.status.Version
+	m.mutex.Unlock()
+
+	if updateErr != nil {
+		return updateErr
+	}
+
+	version, err := m.DetectVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	if version != previous {
+		m.Logger.Info("updated yt-dlp", "previous", previous, "version", version)
+	}
+
+	return nil
+}
+
+// Run updates yt-dlp every interval until the context is done. The updates
+// are disabled, if the interval is not positive.
+func (m *YtDlpManager) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.Update(ctx); err != nil && ctx.Err() == nil {
+			m.Logger.Warn("failed to update yt-dlp", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *YtDlpManager) Status() YtDlpStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.status
+}
+
+// run runs yt-dlp and returns its combined output.
+func (m *YtDlpManager) run(ctx context.Context, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	output := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, m.binary, args...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := cmd.Run()
+	return output.String(), err
+}
+
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return lines[len(lines)-1]
+}
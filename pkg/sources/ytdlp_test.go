@@ -0,0 +1,158 @@
+package sources
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Trojan295/discord-airplay/pkg/bot"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestParseYtDlpOutput(t *testing.T) {
+	tests := []struct {
+		fixture string
+		want    []*bot.Song
+	}{
+		{
+			fixture: "video.jsonl",
+			want: []*bot.Song{
+				{
+					Type:         YtDlpSongType,
+					Title:        "Daft Punk - Around The World (Official Music Video)",
+					Artist:       "Daft Punk",
+					Album:        "Homework",
+					Uploader:     "Daft Punk",
+					URL:          "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+					Playable:     true,
+					ThumbnailURL: strPtr("https://i.ytimg.com/vi/K0HSD_i2DvA/maxresdefault.jpg"),
+					Duration:     429 * time.Second,
+					UploadDate:   time.Date(2014, 2, 27, 0, 0, 0, 0, time.UTC),
+					Chapters: []bot.Chapter{
+						{Title: "Intro", Start: 0, End: 60500 * time.Millisecond},
+						{Title: "Around the World", Start: 60500 * time.Millisecond, End: 429 * time.Second},
+					},
+					Segments: []bot.Segment{
+						{Start: 400 * time.Second, End: 429 * time.Second, Category: "outro"},
+					},
+				},
+			},
+		},
+		{
+			fixture: "flat_playlist.jsonl",
+			want: []*bot.Song{
+				{
+					Type:         YtDlpSongType,
+					Title:        "Daft Punk - Around The World",
+					Uploader:     "Daft Punk",
+					URL:          "https://www.youtube.com/watch?v=K0HSD_i2DvA",
+					Playable:     true,
+					ThumbnailURL: strPtr("https://i.ytimg.com/vi/K0HSD_i2DvA/hqdefault.jpg?sqp=large"),
+					Duration:     429 * time.Second,
+					Partial:      true,
+				},
+				{
+					Type:     YtDlpSongType,
+					Title:    "Daft Punk - One More Time",
+					Uploader: "Daft Punk",
+					URL:      "https://www.youtube.com/watch?v=FGBhQbmPwH8",
+					Playable: true,
+					Partial:  true,
+				},
+			},
+		},
+		{
+			fixture: "search.jsonl",
+			want: []*bot.Song{
+				{
+					Type:         YtDlpSongType,
+					Title:        "Queen – Bohemian Rhapsody (Official Video Remastered)",
+					Artist:       "Queen",
+					Uploader:     "Queen Official",
+					URL:          "https://www.youtube.com/watch?v=fJ9rUzIMcZQ",
+					Playable:     true,
+					ThumbnailURL: strPtr("https://i.ytimg.com/vi/fJ9rUzIMcZQ/maxresdefault.jpg"),
+					Duration:     354320 * time.Millisecond,
+					UploadDate:   time.Date(2008, 11, 22, 0, 0, 0, 0, time.UTC),
+				},
+				{
+					Type:         YtDlpSongType,
+					Title:        "Bohemian Rhapsody (Live Aid)",
+					Artist:       "Queen",
+					Uploader:     "Queen Official",
+					URL:          "https://www.youtube.com/watch?v=nKhN1t_7PEY",
+					Playable:     true,
+					ThumbnailURL: strPtr("https://i.ytimg.com/vi/nKhN1t_7PEY/hqdefault.jpg"),
+					Duration:     2 * time.Minute,
+				},
+			},
+		},
+		{
+			fixture: "live.jsonl",
+			want: []*bot.Song{
+				{
+					Type:         YtDlpSongType,
+					Title:        "lofi hip hop radio 📚 beats to relax/study to",
+					Uploader:     "Lofi Girl",
+					URL:          "https://www.youtube.com/watch?v=jfKfPfyJRdk",
+					Playable:     true,
+					ThumbnailURL: strPtr("https://i.ytimg.com/vi/jfKfPfyJRdk/maxresdefault_live.jpg"),
+					UploadDate:   time.Date(2022, 7, 12, 0, 0, 0, 0, time.UTC),
+					Live:         true,
+				},
+			},
+		},
+		{
+			fixture: "upcoming.jsonl",
+			want: []*bot.Song{
+				{
+					Type:     YtDlpSongType,
+					Title:    "Album Premiere",
+					Uploader: "Label",
+					URL:      "https://www.youtube.com/watch?v=upcoming1",
+					Playable: false,
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			file, err := os.Open(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			songs, err := parseYtDlpOutput(file)
+			if err != nil {
+				t.Fatalf("parseYtDlpOutput() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(songs, tt.want) {
+				t.Errorf("parseYtDlpOutput() = %s, want %s", dumpSongs(songs), dumpSongs(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseYtDlpOutputInvalidJSON(t *testing.T) {
+	if _, err := parseYtDlpOutput(strings.NewReader("{\"title\": \"a\"}\nWARNING: not json\n")); err == nil {
+		t.Error("parseYtDlpOutput() error = nil, want an error")
+	}
+}
+
+func dumpSongs(songs []*bot.Song) string {
+	data, err := json.MarshalIndent(songs, "", "  ")
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}